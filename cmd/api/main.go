@@ -1,16 +1,32 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/billing"
 	"github.com/nantestech/note-api/internal/infra/postgres"
+	"github.com/nantestech/note-api/internal/llm"
+	"github.com/nantestech/note-api/internal/mail"
+	"github.com/nantestech/note-api/internal/metering"
+	"github.com/nantestech/note-api/internal/notifications"
 	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/auth/apikeys"
 	auth "github.com/nantestech/note-api/internal/users/auth/google"
+	"github.com/nantestech/note-api/internal/users/auth/magiclink"
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	"github.com/nantestech/note-api/internal/users/auth/oauthserver"
+	"github.com/nantestech/note-api/internal/users/auth/password"
+	"github.com/nantestech/note-api/internal/users/auth/providers"
+	"github.com/nantestech/note-api/internal/users/auth/session"
+	"github.com/nantestech/note-api/internal/users/auth/webauthn"
 	"github.com/nantestech/note-api/pkg/jwt"
 	"gorm.io/gorm"
 )
@@ -24,6 +40,7 @@ func main() {
 	}
 
 	router := gin.Default()
+	setupTrustedProxies(router)
 	setupMiddlewares(router)
 	router.GET("/healthcheck", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -38,6 +55,19 @@ func main() {
 	}
 }
 
+// setupTrustedProxies only believes X-Forwarded-For from the proxies in
+// TRUSTED_PROXIES, so clients can't pick the IP that rate limits and
+// magic links see. With none set, the peer's address is the client's.
+func setupTrustedProxies(router *gin.Engine) {
+	var proxies []string
+	if value := getEnv("TRUSTED_PROXIES", ""); value != "" {
+		proxies = strings.Split(value, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+}
+
 func setupMiddlewares(router *gin.Engine) {
 	router.Use(middleware.CORSMiddleware())
 }
@@ -47,28 +77,252 @@ func setupRoutes(router *gin.Engine) {
 	db := setupDB()
 	userRepo := users.NewUserRepository(db)
 	jwtConfig := setupJWT()
-	googleAuthConfig := setupGoogleAuthConfig()
-	googleAuthService := auth.NewGoogleAuthService(googleAuthConfig, jwtConfig, userRepo)
-	googleAuthHandler := auth.NewGoogleAuthHandler(googleAuthService, userRepo, jwtConfig)
+	mfaService := mfa.NewMFAService(mfa.NewMFARepository(db), userRepo, getEnv("MFA_ISSUER", "Note"))
+	webAuthnService := webauthn.NewWebAuthnService(setupWebAuthnConfig(), webauthn.NewWebAuthnRepository(db), userRepo)
+	stepUpMiddleware := webauthn.NewStepUpMiddleware(webAuthnService)
+	tokenIssuer := mfa.NewTokenIssuer(jwtConfig, mfa.AnyEnabled(mfaService, webAuthnService))
+	mfaHandler := mfa.NewMFAHandler(mfaService, jwtConfig)
+	googleAuthService := auth.NewGoogleAuthService(setupGoogleAuthConfig())
+	identityRepo := users.NewIdentityRepository(db)
+	authService := providers.NewAuthService(setupAuthProviders(googleAuthService), userRepo, identityRepo, providers.AnySignInMethod(providers.PasswordSignIn(userRepo), webAuthnService))
+	authHandler := providers.NewAuthHandler(authService, tokenIssuer)
+	identityHandler := providers.NewIdentityHandler(authService)
+	googleAuthHandler := auth.NewGoogleAuthHandler(googleAuthService, authService, jwtConfig, tokenIssuer)
 	auth.GoogleAuthRoutes(router, googleAuthHandler)
+	providers.AuthRoutes(router, authHandler)
+
+	outboxRepo := mail.NewOutboxRepository(db)
+	smtpConfig := setupSMTPConfig()
+	outboxService := mail.NewOutboxService(outboxRepo, mail.NewSMTPMailer(smtpConfig), smtpConfig.From)
+	go outboxService.Run(context.Background())
+	mailRenderer, err := mail.NewTemplateRenderer(getEnv("MAIL_DEFAULT_LOCALE", "en"))
+	if err != nil {
+		log.Fatalf("Failed to load mail templates: %v", err)
+	}
+	unsubscribeSigner := mail.NewUnsubscribeSigner(jwtConfig, getEnv("APP_BASE_URL", "http://localhost:8080"))
+	emailDeliverer := mail.NewNotificationDeliverer(outboxService, mailRenderer, userRepo, unsubscribeSigner, getEnv("MAIL_DEFAULT_LOCALE", "en"))
+
+	passwordService, err := password.NewPasswordService(setupPasswordConfig(), jwtConfig.SecretKey, userRepo, password.NewResetTokenRepository(db), setupBreachChecker(), outboxService, mailRenderer)
+	if err != nil {
+		log.Fatalf("Failed to configure password sign-in: %v", err)
+	}
+	password.PasswordRoutes(router, password.NewPasswordHandler(passwordService, tokenIssuer))
+	magicLinkConfig := setupMagicLinkConfig()
+	magicLinkService := magiclink.NewMagicLinkService(magicLinkConfig, magiclink.NewMagicLinkRepository(db), userRepo, outboxService, mailRenderer)
+	magiclink.MagicLinkRoutes(router, magiclink.NewMagicLinkHandler(magicLinkService, magicLinkConfig, tokenIssuer))
+
+	notificationRepo := notifications.NewNotificationRepository(db)
+	notificationService := notifications.NewNotificationService(notificationRepo, emailDeliverer)
+	notificationHandler := notifications.NewNotificationHandler(notificationService)
+	mailHandler := mail.NewMailHandler(unsubscribeSigner, notificationService)
+	mail.MailRoutes(router, mailHandler)
+
+	meteringRepo := metering.NewMeteringRepository(db)
+	meteringService := metering.NewMeteringService(meteringRepo)
+	meteringHandler := metering.NewMeteringHandler(meteringService)
+	quotaMiddleware := metering.NewQuotaMiddleware(meteringService)
+
+	planService := billing.NewPlanService(billing.NewPlanRepository(db), userRepo)
+	billingRepo := billing.NewBillingRepository(db)
+	billingService := billing.NewBillingService(billing.NewStripeProvider(setupStripeConfig()), billingRepo, userRepo, planService)
+	billingHandler := billing.NewBillingHandler(billingService, planService)
+	sessionHandler := session.NewSessionHandler(userRepo, jwtConfig)
+
+	// No endpoint uses the LLM yet; build it anyway so bad settings fail at startup.
+	setupLLM(metering.NewLLMUsageRecorder(meteringService))
 
-	authMiddleware := middleware.NewAuthMiddleware(jwtConfig)
+	apiKeyService := apikeys.NewAPIKeyService(apikeys.NewAPIKeyRepository(db), userRepo)
+	oauthConfig := setupOAuthServerConfig()
+	oauthService := oauthserver.NewOAuthService(oauthConfig, jwtConfig, oauthserver.NewOAuthRepository(db), userRepo)
+	authMiddleware := middleware.NewAuthMiddleware(jwtConfig, apiKeyService, oauthService)
 	api := router.Group("/api")
 	api.Use(authMiddleware.Authenticate())
 	{
 		api.GET("/auth/validate-jwt", auth.ValidateJWT())
+		session.SessionRoutes(api, sessionHandler)
+		providers.IdentityRoutes(api, identityHandler)
+		apikeys.APIKeyRoutes(api, apikeys.NewAPIKeyHandler(apiKeyService))
+		metering.MeteringRoutes(api, meteringHandler)
 	}
+	// Only resource routes count as API calls, so users who used up the
+	// quota can still check their usage, upgrade and manage their account.
+	metered := api.Group("", quotaMiddleware.Enforce(metering.MetricAPICalls))
+	{
+		notifications.NotificationRoutes(metered, notificationHandler)
+	}
+	billing.BillingRoutes(router, api, billingHandler)
+	mfa.MFARoutes(router, api, mfaHandler, stepUpMiddleware)
+	webauthn.WebAuthnRoutes(router, api, webauthn.NewWebAuthnHandler(webAuthnService, jwtConfig), stepUpMiddleware)
+	oauthserver.OAuthRoutes(router, api, oauthserver.NewOAuthHandler(oauthService, oauthConfig), oauthserver.NewClientHandler(oauthService))
 
 }
 
 func setupGoogleAuthConfig() auth.GoogleAuthConfig {
 	googleAuthConfig := auth.GoogleAuthConfig{
-		ClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
-		ClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+		ClientID:          getEnv("GOOGLE_CLIENT_ID", ""),
+		ClientSecret:      getEnv("GOOGLE_CLIENT_SECRET", ""),
+		RedirectURL:       getEnv("GOOGLE_REDIRECT_URL", "http://localhost:8080/auth/google/callback"),
+		AuthURL:           getEnv("GOOGLE_AUTH_URL", "https://accounts.google.com/o/oauth2/v2/auth"),
+		TokenURL:          getEnv("GOOGLE_TOKEN_URL", "https://oauth2.googleapis.com/token"),
+		JWKSURL:           getEnv("GOOGLE_JWKS_URL", "https://www.googleapis.com/oauth2/v3/certs"),
+		TokenInfoFallback: getEnv("GOOGLE_TOKENINFO_FALLBACK", "false") == "true",
+		TokenInfoURL:      getEnv("GOOGLE_TOKENINFO_URL", "https://oauth2.googleapis.com/tokeninfo"),
 	}
 	return googleAuthConfig
 }
 
+// setupAuthProviders registers Google and every other provider that has a
+// client ID configured.
+func setupAuthProviders(google providers.Provider) *providers.Registry {
+	registered := []providers.Provider{google}
+
+	if clientID := getEnv("GITHUB_CLIENT_ID", ""); clientID != "" {
+		registered = append(registered, providers.NewGitHubProvider(providers.GitHubConfig{
+			ClientID:     clientID,
+			ClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("GITHUB_REDIRECT_URL", ""),
+		}))
+	}
+
+	if clientID := getEnv("MICROSOFT_CLIENT_ID", ""); clientID != "" {
+		registered = append(registered, providers.NewMicrosoftProvider(providers.MicrosoftConfig{
+			TenantID:     getEnv("MICROSOFT_TENANT_ID", "common"),
+			ClientID:     clientID,
+			ClientSecret: getEnv("MICROSOFT_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("MICROSOFT_REDIRECT_URL", ""),
+		}))
+	}
+
+	if clientID := getEnv("OIDC_CLIENT_ID", ""); clientID != "" {
+		registered = append(registered, providers.NewOIDCProvider(providers.OIDCConfig{
+			Name:         getEnv("OIDC_PROVIDER_NAME", "oidc"),
+			IssuerURL:    getEnv("OIDC_ISSUER_URL", ""),
+			ClientID:     clientID,
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+		}))
+	}
+
+	registry := providers.NewRegistry(registered...)
+	log.Printf("Sign-in providers: %v", registry.Names())
+	return registry
+}
+
+func setupPasswordConfig() password.Config {
+	passwordConfig := password.Config{
+		Params: password.Params{
+			Memory:      uint32(getEnvAsInt("PASSWORD_ARGON2_MEMORY_KB", int(password.DefaultParams.Memory))),
+			Iterations:  uint32(getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", int(password.DefaultParams.Iterations))),
+			Parallelism: uint8(getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", int(password.DefaultParams.Parallelism))),
+			SaltLength:  password.DefaultParams.SaltLength,
+			KeyLength:   password.DefaultParams.KeyLength,
+		},
+		MinLength:       getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		VerificationTTL: time.Duration(getEnvAsInt("PASSWORD_VERIFICATION_TTL_HOURS", 48)) * time.Hour,
+		ResetTTL:        time.Duration(getEnvAsInt("PASSWORD_RESET_TTL_MINUTES", 30)) * time.Minute,
+		BaseURL:         getEnv("APP_BASE_URL", "http://localhost:8080"),
+		ResetURL:        getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		Locale:          getEnv("MAIL_DEFAULT_LOCALE", "en"),
+	}
+	return passwordConfig
+}
+
+func setupMagicLinkConfig() magiclink.Config {
+	magicLinkConfig := magiclink.Config{
+		TTL:         time.Duration(getEnvAsInt("MAGIC_LINK_TTL_MINUTES", 15)) * time.Minute,
+		BindIP:      getEnv("MAGIC_LINK_BIND_IP", "false") == "true",
+		MaxPerEmail: getEnvAsInt("MAGIC_LINK_MAX_PER_EMAIL", 5),
+		MaxPerIP:    getEnvAsInt("MAGIC_LINK_MAX_PER_IP", 20),
+		RateWindow:  time.Duration(getEnvAsInt("MAGIC_LINK_RATE_WINDOW_MINUTES", 60)) * time.Minute,
+		BaseURL:     getEnv("APP_BASE_URL", "http://localhost:8080"),
+		Locale:      getEnv("MAIL_DEFAULT_LOCALE", "en"),
+	}
+	return magicLinkConfig
+}
+
+func setupWebAuthnConfig() webauthn.Config {
+	webAuthnConfig := webauthn.Config{
+		RPID:        getEnv("WEBAUTHN_RP_ID", "localhost"),
+		RPName:      getEnv("WEBAUTHN_RP_NAME", "Note"),
+		Origins:     strings.Split(getEnv("WEBAUTHN_ORIGINS", "http://localhost:3000"), ","),
+		Attestation: getEnv("WEBAUTHN_ATTESTATION", "none"),
+		Timeout:     time.Duration(getEnvAsInt("WEBAUTHN_TIMEOUT_SECONDS", 300)) * time.Second,
+	}
+	return webAuthnConfig
+}
+
+func setupOAuthServerConfig() oauthserver.Config {
+	oauthConfig := oauthserver.Config{
+		Issuer:          getEnv("APP_BASE_URL", "http://localhost:8080"),
+		ConsentURL:      getEnv("OAUTH_CONSENT_URL", "http://localhost:3000/oauth/consent"),
+		CodeTTL:         time.Duration(getEnvAsInt("OAUTH_CODE_TTL_SECONDS", 300)) * time.Second,
+		AccessTokenTTL:  time.Duration(getEnvAsInt("OAUTH_ACCESS_TOKEN_TTL_MINUTES", 60)) * time.Minute,
+		RefreshTokenTTL: time.Duration(getEnvAsInt("OAUTH_REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour,
+	}
+	return oauthConfig
+}
+
+// setupBreachChecker checks new passwords against the Pwned Passwords range
+// files in PASSWORD_BREACH_RANGES_DIR, when set.
+func setupBreachChecker() password.BreachChecker {
+	dir := getEnv("PASSWORD_BREACH_RANGES_DIR", "")
+	if dir == "" {
+		log.Printf("PASSWORD_BREACH_RANGES_DIR is not set, breached passwords are not rejected")
+		return password.NoBreachChecker()
+	}
+	return password.NewRangeChecker(dir)
+}
+
+func setupStripeConfig() billing.StripeConfig {
+	stripeConfig := billing.StripeConfig{
+		SecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
+		WebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		PriceID:       getEnv("STRIPE_PRICE_ID", ""),
+		SuccessURL:    getEnv("BILLING_SUCCESS_URL", "http://localhost:3000/billing/success"),
+		CancelURL:     getEnv("BILLING_CANCEL_URL", "http://localhost:3000/billing/cancel"),
+		BaseURL:       getEnv("STRIPE_BASE_URL", "https://api.stripe.com"),
+	}
+	if stripeConfig.WebhookSecret == "" {
+		log.Printf("STRIPE_WEBHOOK_SECRET is not set, billing webhooks are rejected")
+	}
+	return stripeConfig
+}
+
+func setupLLM(recorder llm.UsageRecorder) llm.Client {
+	llmConfig := llm.Config{
+		Provider:       llm.Provider(getEnv("LLM_PROVIDER", "")),
+		APIKey:         getEnv("LLM_API_KEY", ""),
+		BaseURL:        getEnv("LLM_BASE_URL", "https://generativelanguage.googleapis.com/"),
+		Model:          getEnv("LLM_MODEL_NAME", "gemini-2.0-flash-lite"),
+		EmbeddingModel: getEnv("LLM_EMBEDDING_MODEL", ""),
+		Timeout:        time.Duration(getEnvAsInt("LLM_TIMEOUT_SECONDS", 60)) * time.Second,
+		MaxRetries:     getEnvAsInt("LLM_MAX_RETRIES", 3),
+		Recorder:       recorder,
+	}
+	if llmConfig.APIKey == "" {
+		log.Printf("LLM_API_KEY is not set, AI features are disabled")
+		return nil
+	}
+
+	llmClient, err := llm.NewClient(llmConfig)
+	if err != nil {
+		log.Fatalf("Failed to configure LLM client: %v", err)
+	}
+	log.Printf("LLM client configured for model %s", llmConfig.Model)
+	return llmClient
+}
+
+func setupSMTPConfig() mail.SMTPConfig {
+	smtpConfig := mail.SMTPConfig{
+		Host:     getEnv("SMTP_HOST", "localhost"),
+		Port:     getEnvAsInt("SMTP_PORT", 1025),
+		Username: getEnv("SMTP_USERNAME", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+		From:     getEnv("SMTP_FROM", "Note <no-reply@note.local>"),
+	}
+	return smtpConfig
+}
+
 func setupDB() *gorm.DB {
 	dbConfig := postgres.Config{
 		Host:     getEnv("DB_HOST", "localhost"),
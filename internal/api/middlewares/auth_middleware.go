@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users"
 	"github.com/nantestech/note-api/pkg/jwt"
 )
 
@@ -13,11 +16,19 @@ type AuthMiddleware interface {
 }
 
 type authMiddleware struct {
-	jwtConfig jwt.Config
+	jwtConfig   jwt.Config
+	apiKeys     APIKeyVerifier
+	oauthTokens OAuthTokenVerifier
 }
 
-func NewAuthMiddleware(jwtConfig jwt.Config) AuthMiddleware {
-	return &authMiddleware{jwtConfig: jwtConfig}
+// NewAuthMiddleware accepts session tokens, API keys when apiKeys isn't
+// nil, and OAuth access tokens when oauthTokens isn't nil.
+func NewAuthMiddleware(jwtConfig jwt.Config, apiKeys APIKeyVerifier, oauthTokens OAuthTokenVerifier) AuthMiddleware {
+	return &authMiddleware{
+		jwtConfig:   jwtConfig,
+		apiKeys:     apiKeys,
+		oauthTokens: oauthTokens,
+	}
 }
 
 func (m *authMiddleware) Authenticate() gin.HandlerFunc {
@@ -36,22 +47,100 @@ func (m *authMiddleware) Authenticate() gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
+		if strings.HasPrefix(tokenString, APIKeyPrefix) {
+			m.authenticateAPIKey(c, tokenString)
+			return
+		}
+
 		claims, err := jwt.ValidateToken(m.jwtConfig, tokenString)
+		if errors.Is(err, jwt.ErrWrongTokenType) && m.oauthTokens != nil {
+			if accessClaims, err := jwt.ValidateOAuthAccessToken(m.jwtConfig, tokenString); err == nil {
+				m.authenticateOAuthToken(c, accessClaims)
+				return
+			}
+		}
+		if errors.Is(err, jwt.ErrWrongTokenType) {
+			// The sign-in isn't finished until the second factor is checked.
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication required", "mfaRequired": true})
+			return
+		}
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			return
 		}
 
-		// Make user info available in request context
-		c.Set("userID", claims.UserID)
-		c.Set("email", claims.Email)
-		c.Set("name", claims.Name)
-		c.Set("isPremium", claims.IsPremium)
+		setAuthContext(c, claims)
+	}
+}
+
+// authenticateAPIKey accepts a personal API key. Routes check its scopes
+// with RequireScope; the others only take keys with the admin scope.
+func (m *authMiddleware) authenticateAPIKey(c *gin.Context, key string) {
+	if m.apiKeys == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		return
+	}
+
+	claims, err := m.apiKeys.Verify(c.Request.Context(), key)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Check if user ID in token matches route parameter
-		userIDParam := c.Param("userId")
-		if userIDParam != "" && userIDParam != claims.UserID.String() {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	c.Set(scopeGrantedKey, users.GrantsScope(claims.Scopes, users.ScopeAdmin))
+	setAuthContext(c, claims)
+}
+
+// authenticateOAuthToken accepts an access token issued to a third-party
+// app, unless the user has since revoked the app's access. Like API keys,
+// it may only use routes whose scope the user consented to.
+func (m *authMiddleware) authenticateOAuthToken(c *gin.Context, claims *jwt.Claims) {
+	err := m.oauthTokens.Verify(c.Request.Context(), claims)
+	if errors.Is(err, ErrRevokedOAuthToken) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Set(scopeGrantedKey, users.GrantsScope(claims.Scopes, users.ScopeAdmin))
+	setAuthContext(c, claims)
+}
+
+func setAuthContext(c *gin.Context, claims *jwt.Claims) {
+	// Make user info available in request context
+	c.Set("userID", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("name", claims.Name)
+	c.Set(claimsKey, claims)
+
+	// Check if user ID in token matches route parameter
+	userIDParam := c.Param("userId")
+	if userIDParam != "" && userIDParam != claims.UserID.String() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	c.Next()
+}
+
+// RequireFreshLogin rejects requests whose token comes from a sign-in
+// longer than maxAge ago, so that a stolen or forgotten session can't be
+// used for sensitive changes. Clients should sign in again and retry.
+func RequireFreshLogin(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaims(c)
+		if !ok || !claims.AuthenticatedWithin(maxAge, time.Now()) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":          "Recent sign-in required",
+				"reauthenticate": true,
+			})
 			return
 		}
 
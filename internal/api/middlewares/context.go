@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+const (
+	claimsKey = "claims"
+	// scopeGrantedKey is set once a scoped request may use the route.
+	scopeGrantedKey = "scopeGranted"
+)
+
+// GetUserID returns the ID of the user authenticated by authMiddleware.
+// Requests with an API key or OAuth token that may not use the route have
+// none.
+func GetUserID(c *gin.Context) (uuid.UUID, bool) {
+	if !isAllowed(c) {
+		return uuid.Nil, false
+	}
+	return GetCallerID(c)
+}
+
+// GetCallerID returns the ID of the user a request comes from, even when
+// it's made with an API key or OAuth token that may not use the route. It's for
+// accounting such as quotas; everything else should use GetUserID.
+func GetCallerID(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("userID")
+	if !exists {
+		return uuid.Nil, false
+	}
+
+	userID, ok := value.(uuid.UUID)
+	return userID, ok
+}
+
+// GetClaims returns the claims of the token authMiddleware accepted.
+// Requests with an API key or OAuth token that may not use the route have
+// none.
+func GetClaims(c *gin.Context) (*jwt.Claims, bool) {
+	if !isAllowed(c) {
+		return nil, false
+	}
+	return getClaims(c)
+}
+
+func getClaims(c *gin.Context) (*jwt.Claims, bool) {
+	value, exists := c.Get(claimsKey)
+	if !exists {
+		return nil, false
+	}
+
+	claims, ok := value.(*jwt.Claims)
+	return claims, ok
+}
+
+// isAllowed reports false for scoped requests that no RequireScope has
+// let through, unless they have the admin scope.
+func isAllowed(c *gin.Context) bool {
+	claims, ok := getClaims(c)
+	return !ok || !claims.IsScoped() || c.GetBool(scopeGrantedKey)
+}
+
+// SetClaims makes claims available to GetClaims, for code that
+// authenticates requests without authMiddleware.
+func SetClaims(c *gin.Context, claims *jwt.Claims) {
+	c.Set(claimsKey, claims)
+}
+
+// IsPremium reports whether the authenticated user is premium right now.
+// Like GetCallerID, it describes the account even for scoped requests
+// that may not use the route.
+func IsPremium(c *gin.Context) bool {
+	claims, ok := getClaims(c)
+	return ok && claims.PremiumAt(time.Now())
+}
+
+// HasEntitlement reports whether the authenticated user's plan includes e.
+func HasEntitlement(c *gin.Context, e users.Entitlement) bool {
+	claims, ok := GetClaims(c)
+	return ok && claims.HasEntitlementAt(e, time.Now())
+}
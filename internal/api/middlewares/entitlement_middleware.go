@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+// RequireEntitlement rejects requests from users whose plan doesn't include
+// entitlement with 402 Payment Required, as upgrading would grant it.
+func RequireEntitlement(entitlement users.Entitlement) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasEntitlement(c, entitlement) {
+			c.AbortWithStatusJSON(http.StatusPaymentRequired, gin.H{
+				"error":       "Your plan does not include this feature",
+				"entitlement": entitlement,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+// APIKeyPrefix starts every personal API key, which tells them from JWTs
+// in the Authorization header.
+const APIKeyPrefix = "nk_"
+
+var (
+	ErrInvalidAPIKey     = errors.New("invalid or expired API key")
+	ErrRevokedOAuthToken = errors.New("OAuth access token has been revoked")
+)
+
+// APIKeyVerifier looks up personal API keys for authMiddleware.
+type APIKeyVerifier interface {
+	// Verify returns the claims of a request made with key, or
+	// ErrInvalidAPIKey when it's unknown, revoked or expired.
+	Verify(ctx context.Context, key string) (*jwt.Claims, error)
+}
+
+// OAuthTokenVerifier checks OAuth access tokens for authMiddleware.
+type OAuthTokenVerifier interface {
+	// Verify returns ErrRevokedOAuthToken when the grant claims were
+	// issued for has been revoked.
+	Verify(ctx context.Context, claims *jwt.Claims) error
+}
+
+// RequireScope lets API keys and OAuth access tokens with scope use the
+// route, and rejects others with 403 Forbidden. Session tokens aren't
+// limited by scopes.
+func RequireScope(scope users.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := getClaims(c)
+		if ok && claims.IsScoped() {
+			if !users.GrantsScope(claims.Scopes, scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Token lacks the required scope",
+					"scope": scope,
+				})
+				return
+			}
+			c.Set(scopeGrantedKey, true)
+		}
+
+		c.Next()
+	}
+}
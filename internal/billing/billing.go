@@ -0,0 +1,97 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnknownCustomer  = errors.New("unknown billing customer")
+	// ErrWebhookNotConfigured means there is no webhook secret to check
+	// signatures with, so no webhook can be trusted.
+	ErrWebhookNotConfigured = errors.New("webhook secret is not configured")
+)
+
+type EventType string
+
+const (
+	EventCheckoutCompleted     EventType = "checkout.session.completed"
+	EventInvoicePaid           EventType = "invoice.paid"
+	EventInvoicePaymentFailed  EventType = "invoice.payment_failed"
+	EventSubscriptionCancelled EventType = "customer.subscription.deleted"
+)
+
+// Event is a provider webhook normalized to the fields billing acts on.
+type Event struct {
+	ID             string
+	Type           EventType
+	CustomerID     string
+	SubscriptionID string
+	UserID         *uuid.UUID
+	PlanCode       string
+	PeriodEnd      *time.Time
+}
+
+type CheckoutRequest struct {
+	UserID   uuid.UUID
+	Email    string
+	PlanCode string
+	PriceID  string
+}
+
+type CheckoutSession struct {
+	ID  string
+	URL string
+}
+
+// Provider is a payment provider that sells the premium subscription.
+type Provider interface {
+	Name() string
+	CreateCheckoutSession(ctx context.Context, request CheckoutRequest) (*CheckoutSession, error)
+	ParseWebhook(payload []byte, signature string) (*Event, error)
+}
+
+type Transition string
+
+const (
+	TransitionCustomerLinked   Transition = "customer_linked"
+	TransitionPremiumExtended  Transition = "premium_extended"
+	TransitionPaymentFailed    Transition = "payment_failed"
+	TransitionPremiumCancelled Transition = "premium_cancelled"
+	TransitionIgnored          Transition = "ignored"
+)
+
+type Customer struct {
+	UserID         uuid.UUID `gorm:"primaryKey"`
+	Provider       string
+	CustomerID     string
+	SubscriptionID string
+	PlanCode       string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (Customer) TableName() string {
+	return "billing_customers"
+}
+
+// ProcessedEvent records every webhook event that was handled, which makes
+// handling idempotent by event ID and keeps a log of premium transitions.
+type ProcessedEvent struct {
+	ID                 string `gorm:"primaryKey"`
+	Provider           string
+	Type               EventType
+	UserID             *uuid.UUID
+	Transition         Transition
+	PremiumUntilBefore *time.Time
+	PremiumUntilAfter  *time.Time
+	ReceivedAt         time.Time
+}
+
+func (ProcessedEvent) TableName() string {
+	return "billing_events"
+}
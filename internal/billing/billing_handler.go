@@ -0,0 +1,182 @@
+package billing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+const maxWebhookBytes = 1 << 20
+
+type BillingHandler struct {
+	billingService BillingService
+	planService    PlanService
+}
+
+func NewBillingHandler(billingService BillingService, planService PlanService) *BillingHandler {
+	return &BillingHandler{
+		billingService: billingService,
+		planService:    planService,
+	}
+}
+
+func (h *BillingHandler) HandleCreateCheckout(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The body is optional; without a plan the default plan is sold.
+	var request CreateCheckoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	session, err := h.billingService.CreateCheckout(c.Request.Context(), userID, request.PlanCode)
+	if err != nil {
+		if errors.Is(err, ErrPlanNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, CheckoutResponse{SessionID: session.ID, URL: session.URL})
+}
+
+func (h *BillingHandler) HandleListPlans(c *gin.Context) {
+	plans, err := h.planService.Plans(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]PlanResponse, 0, len(plans))
+	for _, plan := range plans {
+		response = append(response, newPlanResponse(plan))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *BillingHandler) HandleStartTrial(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request StartTrialRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	user, err := h.planService.StartTrial(c.Request.Context(), userID, request.PlanCode)
+	if err != nil {
+		respondPlanError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPremiumResponse(user))
+}
+
+func (h *BillingHandler) HandleRedeemPromo(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request RedeemPromoRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.planService.RedeemPromo(c.Request.Context(), userID, request.Code)
+	if err != nil {
+		respondPlanError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPremiumResponse(user))
+}
+
+func (h *BillingHandler) HandleHistory(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	changes, err := h.planService.History(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]PlanChangeResponse, 0, len(changes))
+	for _, change := range changes {
+		response = append(response, newPlanChangeResponse(change))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func respondPlanError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrPromoInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTrialUnavailable), errors.Is(err, ErrPromoAlreadyApplied):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func newPremiumResponse(user *users.User) PremiumResponse {
+	return PremiumResponse{
+		IsPremium:    user.IsPremium(),
+		PremiumUntil: user.PremiumUntil,
+		GraceUntil:   user.GraceUntil,
+	}
+}
+
+func (h *BillingHandler) HandleWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.billingService.HandleWebhook(c.Request.Context(), payload, c.GetHeader("Stripe-Signature"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidSignature) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrWebhookNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		// Any other error makes the provider retry the event later.
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
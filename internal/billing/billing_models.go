@@ -0,0 +1,68 @@
+package billing
+
+import "time"
+
+type CreateCheckoutRequest struct {
+	PlanCode string `json:"planCode"`
+}
+
+type CheckoutResponse struct {
+	SessionID string `json:"sessionId"`
+	URL       string `json:"url"`
+}
+
+type PlanResponse struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	Term      Term   `json:"term"`
+	TrialDays int    `json:"trialDays"`
+	GraceDays int    `json:"graceDays"`
+}
+
+type StartTrialRequest struct {
+	PlanCode string `json:"planCode"`
+}
+
+type RedeemPromoRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// PremiumResponse is the user's premium after a change. Tokens issued
+// before it still carry the old state until they are refreshed.
+type PremiumResponse struct {
+	IsPremium    bool       `json:"isPremium"`
+	PremiumUntil *time.Time `json:"premiumUntil"`
+	GraceUntil   *time.Time `json:"graceUntil"`
+}
+
+type PlanChangeResponse struct {
+	Kind               PlanChangeKind `json:"kind"`
+	PlanCode           string         `json:"planCode,omitempty"`
+	Reference          string         `json:"reference,omitempty"`
+	PremiumUntilBefore *time.Time     `json:"premiumUntilBefore"`
+	PremiumUntilAfter  *time.Time     `json:"premiumUntilAfter"`
+	GraceUntil         *time.Time     `json:"graceUntil"`
+	CreatedAt          time.Time      `json:"createdAt"`
+}
+
+func newPlanResponse(p *Plan) PlanResponse {
+	return PlanResponse{
+		Code:      p.Code,
+		Name:      p.Name,
+		Term:      p.Term,
+		TrialDays: p.TrialDays,
+		GraceDays: p.GraceDays,
+	}
+}
+
+func newPlanChangeResponse(c *PlanChange) PlanChangeResponse {
+	return PlanChangeResponse{
+		Kind:               c.Kind,
+		PlanCode:           c.PlanCode,
+		Reference:          c.Reference,
+		PremiumUntilBefore: c.PremiumUntilBefore,
+		PremiumUntilAfter:  c.PremiumUntilAfter,
+		GraceUntil:         c.GraceUntil,
+		CreatedAt:          c.CreatedAt,
+	}
+}
@@ -0,0 +1,62 @@
+package billing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nantestech/note-api/internal/users"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	ClaimEvent(ctx context.Context, event *ProcessedEvent) (bool, error)
+	UpdateEvent(ctx context.Context, event *ProcessedEvent) error
+	SaveCustomer(ctx context.Context, customer *Customer) error
+	GetCustomerByCustomerID(ctx context.Context, customerID string) (*Customer, error)
+	Transaction(ctx context.Context, fn func(repo Repository, planRepo PlanRepository, userRepo users.Repository) error) error
+}
+
+type billingRepository struct {
+	db *gorm.DB
+}
+
+// ClaimEvent stores event unless an event with the same ID was stored
+// before, and reports whether this call stored it.
+func (r *billingRepository) ClaimEvent(ctx context.Context, event *ProcessedEvent) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *billingRepository) UpdateEvent(ctx context.Context, event *ProcessedEvent) error {
+	return r.db.WithContext(ctx).Save(event).Error
+}
+
+func (r *billingRepository) SaveCustomer(ctx context.Context, customer *Customer) error {
+	return r.db.WithContext(ctx).Save(customer).Error
+}
+
+func (r *billingRepository) GetCustomerByCustomerID(ctx context.Context, customerID string) (*Customer, error) {
+	var customer Customer
+	err := r.db.WithContext(ctx).Where("customer_id = ?", customerID).First(&customer).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// Transaction calls fn with repositories bound to one transaction, which
+// is committed when fn returns nil. A webhook event claimed in it is
+// released when it rolls back, so the provider's retry is processed again.
+func (r *billingRepository) Transaction(ctx context.Context, fn func(repo Repository, planRepo PlanRepository, userRepo users.Repository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&billingRepository{db: tx}, &planRepository{db: tx}, users.NewUserRepository(tx))
+	})
+}
+
+func NewBillingRepository(db *gorm.DB) Repository {
+	return &billingRepository{db: db}
+}
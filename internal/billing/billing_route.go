@@ -0,0 +1,19 @@
+package billing
+
+import "github.com/gin-gonic/gin"
+
+// BillingRoutes registers the webhook on router, outside authentication,
+// and the user endpoints on the authenticated api group.
+func BillingRoutes(router *gin.Engine, api *gin.RouterGroup, billingHandler *BillingHandler) {
+
+	router.POST("/billing/webhook", billingHandler.HandleWebhook)
+
+	billing := api.Group("/billing")
+	{
+		billing.GET("/plans", billingHandler.HandleListPlans)
+		billing.POST("/checkout", billingHandler.HandleCreateCheckout)
+		billing.POST("/trial", billingHandler.HandleStartTrial)
+		billing.POST("/promo", billingHandler.HandleRedeemPromo)
+		billing.GET("/history", billingHandler.HandleHistory)
+	}
+}
@@ -0,0 +1,211 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+type BillingService interface {
+	CreateCheckout(ctx context.Context, userID uuid.UUID, planCode string) (*CheckoutSession, error)
+	HandleWebhook(ctx context.Context, payload []byte, signature string) error
+}
+
+type billingService struct {
+	provider    Provider
+	repo        Repository
+	userRepo    users.Repository
+	planService PlanService
+}
+
+func NewBillingService(provider Provider, repo Repository, userRepo users.Repository, planService PlanService) BillingService {
+	return &billingService{
+		provider:    provider,
+		repo:        repo,
+		userRepo:    userRepo,
+		planService: planService,
+	}
+}
+
+func (s *billingService) CreateCheckout(ctx context.Context, userID uuid.UUID, planCode string) (*CheckoutSession, error) {
+	plan, err := s.planService.Plan(ctx, planCode)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+
+	return s.provider.CreateCheckoutSession(ctx, CheckoutRequest{
+		UserID:   user.ID,
+		Email:    user.Email,
+		PlanCode: plan.Code,
+		PriceID:  plan.PriceID,
+	})
+}
+
+func (s *billingService) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	event, err := s.provider.ParseWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+
+	processed := &ProcessedEvent{
+		ID:         event.ID,
+		Provider:   s.provider.Name(),
+		Type:       event.Type,
+		Transition: TransitionIgnored,
+		ReceivedAt: time.Now(),
+	}
+
+	// The claim and the change share a transaction, so an event is
+	// either recorded with its change or not at all, and the provider's
+	// retry gets another go when handling fails or the process dies.
+	claimed := false
+	err = s.repo.Transaction(ctx, func(repo Repository, planRepo PlanRepository, userRepo users.Repository) error {
+		claimed, err = repo.ClaimEvent(ctx, processed)
+		if err != nil || !claimed {
+			return err
+		}
+
+		tx := &billingService{provider: s.provider, repo: repo, userRepo: userRepo, planService: NewPlanService(planRepo, userRepo)}
+		if err := tx.apply(ctx, event, processed); err != nil {
+			return err
+		}
+		return repo.UpdateEvent(ctx, processed)
+	})
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Printf("Billing event %s (%s) was already processed, skipping", event.ID, event.Type)
+		return nil
+	}
+
+	log.Printf("Billing event %s (%s): %s for user %s, premium until %s -> %s",
+		event.ID, event.Type, processed.Transition, formatUserID(processed.UserID),
+		formatTime(processed.PremiumUntilBefore), formatTime(processed.PremiumUntilAfter))
+	return nil
+}
+
+func (s *billingService) apply(ctx context.Context, event *Event, processed *ProcessedEvent) error {
+	switch event.Type {
+	case EventCheckoutCompleted:
+		if event.UserID == nil {
+			return errors.New("checkout session has no user reference")
+		}
+		processed.UserID = event.UserID
+		processed.Transition = TransitionCustomerLinked
+		return s.repo.SaveCustomer(ctx, &Customer{
+			UserID:         *event.UserID,
+			Provider:       s.provider.Name(),
+			CustomerID:     event.CustomerID,
+			SubscriptionID: event.SubscriptionID,
+			PlanCode:       planCodeOrDefault(event.PlanCode),
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		})
+
+	case EventInvoicePaid:
+		return s.updateUser(ctx, event, processed, TransitionPremiumExtended, func(user *users.User, planCode string) error {
+			return s.planService.Renew(ctx, user, planCode, event.PeriodEnd, event.ID)
+		})
+
+	case EventInvoicePaymentFailed:
+		return s.updateUser(ctx, event, processed, TransitionPaymentFailed, func(user *users.User, planCode string) error {
+			return s.planService.StartGrace(ctx, user, planCode, event.ID)
+		})
+
+	case EventSubscriptionCancelled:
+		return s.updateUser(ctx, event, processed, TransitionPremiumCancelled, func(user *users.User, planCode string) error {
+			return s.planService.Cancel(ctx, user, planCode, event.ID)
+		})
+	}
+
+	return nil
+}
+
+// updateUser applies change to the user the event belongs to and records
+// the premium state before and after it.
+func (s *billingService) updateUser(ctx context.Context, event *Event, processed *ProcessedEvent, transition Transition, change func(user *users.User, planCode string) error) error {
+	user, planCode, err := s.userFor(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	processed.UserID = &user.ID
+	processed.Transition = transition
+	processed.PremiumUntilBefore = copyTime(user.PremiumEndsAt())
+
+	if err := change(user, planCode); err != nil {
+		return err
+	}
+
+	processed.PremiumUntilAfter = copyTime(user.PremiumEndsAt())
+	return nil
+}
+
+// userFor returns the user an event belongs to and the plan they
+// subscribed to.
+func (s *billingService) userFor(ctx context.Context, event *Event) (*users.User, string, error) {
+	userID := event.UserID
+	planCode := event.PlanCode
+
+	if event.CustomerID != "" {
+		customer, err := s.repo.GetCustomerByCustomerID(ctx, event.CustomerID)
+		if err != nil {
+			return nil, "", err
+		}
+		if customer != nil {
+			userID = &customer.UserID
+			if planCode == "" {
+				planCode = customer.PlanCode
+			}
+		}
+	}
+
+	if userID == nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownCustomer, event.CustomerID)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, *userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if user == nil {
+		return nil, "", fmt.Errorf("%w: user %s not found", ErrUnknownCustomer, userID)
+	}
+	return user, planCode, nil
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "none"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatUserID(id *uuid.UUID) string {
+	if id == nil {
+		return "unknown"
+	}
+	return id.String()
+}
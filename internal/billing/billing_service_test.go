@@ -0,0 +1,357 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider returns the queued event for any payload
+type fakeProvider struct {
+	event *Event
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) CreateCheckoutSession(_ context.Context, request CheckoutRequest) (*CheckoutSession, error) {
+	return &CheckoutSession{ID: "cs_" + request.UserID.String(), URL: "https://pay.test"}, nil
+}
+
+func (p *fakeProvider) ParseWebhook(_ []byte, signature string) (*Event, error) {
+	if signature != "ok" {
+		return nil, ErrInvalidSignature
+	}
+	return p.event, nil
+}
+
+// mockRepository rolls back the events and customers it stored, and the
+// plan changes its plans stored, when a transaction fails.
+type mockRepository struct {
+	events         map[string]*ProcessedEvent
+	customers      map[string]*Customer
+	plans          *mockPlanRepository
+	updateEventErr error
+}
+
+func newMockRepository(plans *mockPlanRepository) *mockRepository {
+	return &mockRepository{events: make(map[string]*ProcessedEvent), customers: make(map[string]*Customer), plans: plans}
+}
+
+func (m *mockRepository) ClaimEvent(_ context.Context, event *ProcessedEvent) (bool, error) {
+	if _, exists := m.events[event.ID]; exists {
+		return false, nil
+	}
+	m.events[event.ID] = event
+	return true, nil
+}
+
+func (m *mockRepository) UpdateEvent(_ context.Context, event *ProcessedEvent) error {
+	if m.updateEventErr != nil {
+		return m.updateEventErr
+	}
+	m.events[event.ID] = event
+	return nil
+}
+
+func (m *mockRepository) Transaction(_ context.Context, fn func(repo Repository, planRepo PlanRepository, userRepo users.Repository) error) error {
+	events := maps.Clone(m.events)
+	customers := maps.Clone(m.customers)
+	changes := len(m.plans.changes)
+	if err := fn(m, m.plans, m.plans.userRepo); err != nil {
+		m.events, m.customers, m.plans.changes = events, customers, m.plans.changes[:changes]
+		return err
+	}
+	return nil
+}
+
+func (m *mockRepository) SaveCustomer(_ context.Context, customer *Customer) error {
+	m.customers[customer.CustomerID] = customer
+	return nil
+}
+
+func (m *mockRepository) GetCustomerByCustomerID(_ context.Context, customerID string) (*Customer, error) {
+	return m.customers[customerID], nil
+}
+
+type mockPlanRepository struct {
+	plans       map[string]*Plan
+	promos      map[string]*PromoCode
+	redemptions map[string]bool
+	changes     []*PlanChange
+	// userRepo is what transactions hand out for saving users.
+	userRepo users.Repository
+	// beforeTransaction, when set, runs as a transaction starts, standing
+	// in for a request that changed the user just before.
+	beforeTransaction func()
+}
+
+func newMockPlanRepository(userRepo users.Repository) *mockPlanRepository {
+	return &mockPlanRepository{
+		plans: map[string]*Plan{
+			"premium_monthly": {Code: "premium_monthly", Term: TermMonthly, TrialDays: 14, GraceDays: 7, Active: true},
+			"premium_yearly":  {Code: "premium_yearly", Term: TermYearly, PriceID: "price_yearly", GraceDays: 14, Active: true},
+		},
+		promos:      make(map[string]*PromoCode),
+		redemptions: make(map[string]bool),
+		userRepo:    userRepo,
+	}
+}
+
+func (m *mockPlanRepository) ListPlans(_ context.Context) ([]*Plan, error) {
+	plans := make([]*Plan, 0, len(m.plans))
+	for _, plan := range m.plans {
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func (m *mockPlanRepository) GetPlan(_ context.Context, code string) (*Plan, error) {
+	return m.plans[code], nil
+}
+
+func (m *mockPlanRepository) RedeemPromo(_ context.Context, code string, userID uuid.UUID, apply func(repo PlanRepository, userRepo users.Repository, promo *PromoCode) error) error {
+	promo := m.promos[code]
+	if promo == nil || !promo.Redeemable(time.Now()) {
+		return ErrPromoInvalid
+	}
+	if m.beforeTransaction != nil {
+		m.beforeTransaction()
+	}
+	key := code + "/" + userID.String()
+	if m.redemptions[key] {
+		return ErrPromoAlreadyApplied
+	}
+	if err := apply(m, m.userRepo, promo); err != nil {
+		return err
+	}
+	m.redemptions[key] = true
+	promo.Redemptions++
+	return nil
+}
+
+func (m *mockPlanRepository) Transaction(_ context.Context, fn func(repo PlanRepository, userRepo users.Repository) error) error {
+	if m.beforeTransaction != nil {
+		m.beforeTransaction()
+	}
+	return fn(m, m.userRepo)
+}
+
+func (m *mockPlanRepository) AddChange(_ context.Context, change *PlanChange) error {
+	m.changes = append(m.changes, change)
+	return nil
+}
+
+func (m *mockPlanRepository) HasChange(_ context.Context, userID uuid.UUID, kind PlanChangeKind) (bool, error) {
+	for _, change := range m.changes {
+		if change.UserID == userID && change.Kind == kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockPlanRepository) ListChanges(_ context.Context, userID uuid.UUID) ([]*PlanChange, error) {
+	var changes []*PlanChange
+	for i := len(m.changes) - 1; i >= 0; i-- {
+		if m.changes[i].UserID == userID {
+			changes = append(changes, m.changes[i])
+		}
+	}
+	return changes, nil
+}
+
+func setupService(t *testing.T) (*billingService, *fakeProvider, *mockRepository, *userstest.UserRepository, *users.User) {
+	t.Helper()
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	userRepo := userstest.NewUserRepository(user)
+	provider := &fakeProvider{}
+	planRepo := newMockPlanRepository(userRepo)
+	repo := newMockRepository(planRepo)
+	planService := NewPlanService(planRepo, userRepo)
+	service := NewBillingService(provider, repo, userRepo, planService).(*billingService)
+	return service, provider, repo, userRepo, user
+}
+
+func TestWebhookLifecycle(t *testing.T) {
+	// Arrange
+	service, provider, repo, _, user := setupService(t)
+	ctx := context.Background()
+	periodEnd := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+
+	// Act & Assert: checkout links the customer
+	provider.event = &Event{ID: "evt_1", Type: EventCheckoutCompleted, CustomerID: "cus_1", UserID: &user.ID}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+	assert.Equal(t, user.ID, repo.customers["cus_1"].UserID)
+	assert.Equal(t, TransitionCustomerLinked, repo.events["evt_1"].Transition)
+
+	// Act & Assert: paid invoice extends premium to the period end
+	provider.event = &Event{ID: "evt_2", Type: EventInvoicePaid, CustomerID: "cus_1", PeriodEnd: &periodEnd}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+	assert.True(t, user.IsPremium())
+	assert.Equal(t, periodEnd, *user.PremiumUntil)
+	assert.Equal(t, TransitionPremiumExtended, repo.events["evt_2"].Transition)
+	assert.Nil(t, repo.events["evt_2"].PremiumUntilBefore)
+	assert.Equal(t, periodEnd, *repo.events["evt_2"].PremiumUntilAfter)
+
+	// Act & Assert: failed payment starts the plan's grace period
+	provider.event = &Event{ID: "evt_3", Type: EventInvoicePaymentFailed, CustomerID: "cus_1"}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+	assert.True(t, user.IsPremium())
+	assert.Equal(t, periodEnd.Add(7*24*time.Hour), *user.GraceUntil)
+	assert.Equal(t, TransitionPaymentFailed, repo.events["evt_3"].Transition)
+
+	// Act & Assert: cancelled subscription ends premium
+	provider.event = &Event{ID: "evt_4", Type: EventSubscriptionCancelled, CustomerID: "cus_1"}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+	assert.False(t, user.IsPremium())
+	assert.Nil(t, user.GraceUntil)
+	assert.Equal(t, TransitionPremiumCancelled, repo.events["evt_4"].Transition)
+}
+
+func TestRetriedPaymentFailuresKeepGrace(t *testing.T) {
+	// Arrange
+	service, provider, _, _, user := setupService(t)
+	ctx := context.Background()
+	lapsedAt := time.Now().Add(-24 * time.Hour)
+	user.PremiumUntil = &lapsedAt
+	provider.event = &Event{ID: "evt_1", Type: EventInvoicePaymentFailed, UserID: &user.ID}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+	// Three days pass before the provider retries the payment.
+	threeDays := 3 * 24 * time.Hour
+	lapsedAt = lapsedAt.Add(-threeDays)
+	graceUntil := user.GraceUntil.Add(-threeDays)
+	user.PremiumUntil = &lapsedAt
+	user.GraceUntil = &graceUntil
+
+	// Act
+	provider.event = &Event{ID: "evt_2", Type: EventInvoicePaymentFailed, UserID: &user.ID}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+
+	// Assert
+	assert.Equal(t, graceUntil, *user.GraceUntil, "A retried payment that fails again doesn't extend grace")
+	assert.Equal(t, lapsedAt.Add(7*24*time.Hour), *user.GraceUntil)
+}
+
+func TestWebhookUsesSubscribedPlan(t *testing.T) {
+	// Arrange
+	service, provider, _, _, user := setupService(t)
+	ctx := context.Background()
+	provider.event = &Event{ID: "evt_1", Type: EventCheckoutCompleted, CustomerID: "cus_1", UserID: &user.ID, PlanCode: "premium_yearly"}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+
+	// Act
+	provider.event = &Event{ID: "evt_2", Type: EventInvoicePaid, CustomerID: "cus_1"}
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+
+	// Assert
+	expected := time.Now().Add(365 * 24 * time.Hour)
+	assert.WithinDuration(t, expected, *user.PremiumUntil, 2*time.Second, "Invoices without a period fall back to the plan's term")
+}
+
+func TestCreateCheckoutUsesPlanPrice(t *testing.T) {
+	// Arrange
+	service, _, _, _, user := setupService(t)
+	provider := &recordingProvider{}
+	service.provider = provider
+
+	// Act
+	_, err := service.CreateCheckout(context.Background(), user.ID, "premium_yearly")
+	_, unknownErr := service.CreateCheckout(context.Background(), user.ID, "lifetime")
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "price_yearly", provider.request.PriceID)
+	assert.Equal(t, "premium_yearly", provider.request.PlanCode)
+	assert.ErrorIs(t, unknownErr, ErrPlanNotFound)
+}
+
+type recordingProvider struct {
+	fakeProvider
+	request CheckoutRequest
+}
+
+func (p *recordingProvider) CreateCheckoutSession(ctx context.Context, request CheckoutRequest) (*CheckoutSession, error) {
+	p.request = request
+	return p.fakeProvider.CreateCheckoutSession(ctx, request)
+}
+
+func TestWebhookIsIdempotent(t *testing.T) {
+	// Arrange
+	service, provider, _, userRepo, user := setupService(t)
+	ctx := context.Background()
+	provider.event = &Event{ID: "evt_1", Type: EventInvoicePaid, UserID: &user.ID}
+
+	// Act
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+	require.NoError(t, service.HandleWebhook(ctx, nil, "ok"))
+
+	// Assert
+	assert.Equal(t, 1, userRepo.Updates)
+}
+
+func TestWebhookFailureCanBeRetried(t *testing.T) {
+	// Arrange
+	service, provider, repo, userRepo, user := setupService(t)
+	ctx := context.Background()
+	provider.event = &Event{ID: "evt_1", Type: EventInvoicePaid, UserID: &user.ID}
+	userRepo.UpdateErr = errors.New("database unavailable")
+
+	// Act
+	firstErr := service.HandleWebhook(ctx, nil, "ok")
+	userRepo.UpdateErr = nil
+	retryErr := service.HandleWebhook(ctx, nil, "ok")
+
+	// Assert
+	assert.Error(t, firstErr)
+	assert.NoError(t, retryErr)
+	assert.Equal(t, TransitionPremiumExtended, repo.events["evt_1"].Transition)
+	assert.Equal(t, 1, userRepo.Updates)
+}
+
+func TestWebhookRecordsEventWithChange(t *testing.T) {
+	// Arrange
+	service, provider, repo, _, user := setupService(t)
+	ctx := context.Background()
+	provider.event = &Event{ID: "evt_1", Type: EventInvoicePaid, UserID: &user.ID}
+	repo.updateEventErr = errors.New("database unavailable")
+
+	// Act
+	firstErr := service.HandleWebhook(ctx, nil, "ok")
+	repo.updateEventErr = nil
+	retryErr := service.HandleWebhook(ctx, nil, "ok")
+
+	// Assert
+	assert.Error(t, firstErr)
+	assert.NoError(t, retryErr)
+	assert.Equal(t, TransitionPremiumExtended, repo.events["evt_1"].Transition)
+	assert.Len(t, repo.plans.changes, 1, "A failed event shouldn't leave its change behind")
+}
+
+func TestWebhookUnknownCustomer(t *testing.T) {
+	// Arrange
+	service, provider, repo, _, _ := setupService(t)
+	provider.event = &Event{ID: "evt_1", Type: EventInvoicePaid, CustomerID: "cus_unknown"}
+
+	// Act
+	err := service.HandleWebhook(context.Background(), nil, "ok")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrUnknownCustomer)
+	assert.Empty(t, repo.events, "Failed events should be released for retry")
+}
+
+func TestWebhookInvalidSignature(t *testing.T) {
+	service, _, _, _, _ := setupService(t)
+
+	err := service.HandleWebhook(context.Background(), nil, "forged")
+
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
@@ -0,0 +1,124 @@
+package billing
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultPlanCode is the plan of subscriptions that don't name one, such as
+// those created before plans existed.
+const DefaultPlanCode = "premium_monthly"
+
+// defaultGraceDays applies when the plan of a subscription isn't known.
+const defaultGraceDays = 7
+
+var (
+	ErrPlanNotFound        = errors.New("plan not found")
+	ErrTrialUnavailable    = errors.New("trial is not available")
+	ErrPromoInvalid        = errors.New("promo code is invalid or expired")
+	ErrPromoAlreadyApplied = errors.New("promo code was already redeemed")
+)
+
+type Term string
+
+const (
+	TermMonthly Term = "monthly"
+	TermYearly  Term = "yearly"
+)
+
+// Duration is how much premium one payment of the term buys, used when the
+// provider doesn't say when the paid period ends.
+func (t Term) Duration() time.Duration {
+	if t == TermYearly {
+		return 365 * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+type Plan struct {
+	Code      string `gorm:"primaryKey"`
+	Name      string
+	Term      Term
+	PriceID   string
+	TrialDays int
+	GraceDays int
+	Active    bool
+	CreatedAt time.Time
+}
+
+func (Plan) TableName() string {
+	return "plans"
+}
+
+func (p *Plan) TrialDuration() time.Duration {
+	return time.Duration(p.TrialDays) * 24 * time.Hour
+}
+
+func (p *Plan) GracePeriod() time.Duration {
+	return time.Duration(p.GraceDays) * 24 * time.Hour
+}
+
+// PromoCode grants Days of premium on top of any premium the user already
+// has. MaxRedemptions of zero means unlimited.
+type PromoCode struct {
+	Code           string `gorm:"primaryKey"`
+	Days           int
+	MaxRedemptions int
+	Redemptions    int
+	ExpiresAt      *time.Time
+	Active         bool
+	CreatedAt      time.Time
+}
+
+func (PromoCode) TableName() string {
+	return "promo_codes"
+}
+
+func (p *PromoCode) Redeemable(now time.Time) bool {
+	if !p.Active || p.Days <= 0 {
+		return false
+	}
+	if p.ExpiresAt != nil && !p.ExpiresAt.After(now) {
+		return false
+	}
+	return p.MaxRedemptions == 0 || p.Redemptions < p.MaxRedemptions
+}
+
+type PromoRedemption struct {
+	Code       string    `gorm:"primaryKey"`
+	UserID     uuid.UUID `gorm:"primaryKey"`
+	RedeemedAt time.Time
+}
+
+func (PromoRedemption) TableName() string {
+	return "promo_redemptions"
+}
+
+type PlanChangeKind string
+
+const (
+	PlanChangeTrialStarted  PlanChangeKind = "trial_started"
+	PlanChangePromoRedeemed PlanChangeKind = "promo_redeemed"
+	PlanChangeRenewed       PlanChangeKind = "renewed"
+	PlanChangeGraceStarted  PlanChangeKind = "grace_started"
+	PlanChangeCancelled     PlanChangeKind = "cancelled"
+)
+
+// PlanChange is one entry in the history of a user's premium.
+type PlanChange struct {
+	ID                 uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID             uuid.UUID
+	Kind               PlanChangeKind
+	PlanCode           string
+	Reference          string
+	PremiumUntilBefore *time.Time
+	PremiumUntilAfter  *time.Time
+	GraceUntil         *time.Time
+	CreatedAt          time.Time
+}
+
+func (PlanChange) TableName() string {
+	return "plan_changes"
+}
@@ -0,0 +1,120 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PlanRepository interface {
+	ListPlans(ctx context.Context) ([]*Plan, error)
+	GetPlan(ctx context.Context, code string) (*Plan, error)
+	RedeemPromo(ctx context.Context, code string, userID uuid.UUID, apply func(repo PlanRepository, userRepo users.Repository, promo *PromoCode) error) error
+	Transaction(ctx context.Context, fn func(repo PlanRepository, userRepo users.Repository) error) error
+	AddChange(ctx context.Context, change *PlanChange) error
+	HasChange(ctx context.Context, userID uuid.UUID, kind PlanChangeKind) (bool, error)
+	ListChanges(ctx context.Context, userID uuid.UUID) ([]*PlanChange, error)
+}
+
+type planRepository struct {
+	db *gorm.DB
+}
+
+func (r *planRepository) ListPlans(ctx context.Context) ([]*Plan, error) {
+	var plans []*Plan
+	err := r.db.WithContext(ctx).Where("active").Order("code").Find(&plans).Error
+	return plans, err
+}
+
+func (r *planRepository) GetPlan(ctx context.Context, code string) (*Plan, error) {
+	var plan Plan
+	err := r.db.WithContext(ctx).Where("code = ?", code).First(&plan).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// RedeemPromo records that userID redeemed code and calls apply in the same
+// transaction, with repositories bound to it, so the redemption is rolled
+// back when apply fails. The promo row is locked, which keeps
+// MaxRedemptions exact under concurrency.
+func (r *planRepository) RedeemPromo(ctx context.Context, code string, userID uuid.UUID, apply func(repo PlanRepository, userRepo users.Repository, promo *PromoCode) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var promo PromoCode
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&promo).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPromoInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if !promo.Redeemable(now) {
+			return ErrPromoInvalid
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&PromoRedemption{
+			Code:       promo.Code,
+			UserID:     userID,
+			RedeemedAt: now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPromoAlreadyApplied
+		}
+
+		err = tx.Model(&PromoCode{}).Where("code = ?", promo.Code).
+			Update("redemptions", gorm.Expr("redemptions + 1")).Error
+		if err != nil {
+			return err
+		}
+		promo.Redemptions++
+
+		return apply(&planRepository{db: tx}, users.NewUserRepository(tx), &promo)
+	})
+}
+
+// Transaction calls fn with repositories bound to one transaction, which
+// is committed when fn returns nil.
+func (r *planRepository) Transaction(ctx context.Context, fn func(repo PlanRepository, userRepo users.Repository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&planRepository{db: tx}, users.NewUserRepository(tx))
+	})
+}
+
+func (r *planRepository) AddChange(ctx context.Context, change *PlanChange) error {
+	return r.db.WithContext(ctx).Create(change).Error
+}
+
+func (r *planRepository) HasChange(ctx context.Context, userID uuid.UUID, kind PlanChangeKind) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&PlanChange{}).
+		Where("user_id = ? AND kind = ?", userID, kind).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *planRepository) ListChanges(ctx context.Context, userID uuid.UUID) ([]*PlanChange, error) {
+	var changes []*PlanChange
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&changes).Error
+	return changes, err
+}
+
+func NewPlanRepository(db *gorm.DB) PlanRepository {
+	return &planRepository{db: db}
+}
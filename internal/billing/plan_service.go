@@ -0,0 +1,226 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+// PlanService changes a user's premium and keeps the history of those
+// changes. Renew, StartGrace and Cancel act on a user billing has already
+// loaded for a webhook event.
+type PlanService interface {
+	Plans(ctx context.Context) ([]*Plan, error)
+	Plan(ctx context.Context, code string) (*Plan, error)
+	StartTrial(ctx context.Context, userID uuid.UUID, planCode string) (*users.User, error)
+	RedeemPromo(ctx context.Context, userID uuid.UUID, code string) (*users.User, error)
+	Renew(ctx context.Context, user *users.User, planCode string, periodEnd *time.Time, reference string) error
+	StartGrace(ctx context.Context, user *users.User, planCode string, reference string) error
+	Cancel(ctx context.Context, user *users.User, planCode string, reference string) error
+	History(ctx context.Context, userID uuid.UUID) ([]*PlanChange, error)
+}
+
+type planService struct {
+	repo     PlanRepository
+	userRepo users.Repository
+}
+
+func NewPlanService(repo PlanRepository, userRepo users.Repository) PlanService {
+	return &planService{
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+func (s *planService) Plans(ctx context.Context) ([]*Plan, error) {
+	return s.repo.ListPlans(ctx)
+}
+
+// Plan returns the active plan with code, or ErrPlanNotFound.
+func (s *planService) Plan(ctx context.Context, code string) (*Plan, error) {
+	code = planCodeOrDefault(code)
+	plan, err := s.repo.GetPlan(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil || !plan.Active {
+		return nil, fmt.Errorf("%w: %s", ErrPlanNotFound, code)
+	}
+	return plan, nil
+}
+
+// StartTrial gives the plan's free trial to a user who never had one and
+// isn't premium already.
+func (s *planService) StartTrial(ctx context.Context, userID uuid.UUID, planCode string) (*users.User, error) {
+	plan, err := s.Plan(ctx, planCode)
+	if err != nil {
+		return nil, err
+	}
+	if plan.TrialDays <= 0 {
+		return nil, ErrTrialUnavailable
+	}
+
+	// The checks and the change share a transaction, on the user's locked
+	// row, and the database allows one trial per user, so concurrent
+	// requests can't both start one.
+	var user *users.User
+	err = s.repo.Transaction(ctx, func(repo PlanRepository, userRepo users.Repository) error {
+		user, err = lockUser(ctx, userRepo, userID)
+		if err != nil {
+			return err
+		}
+		if user.IsPremium() {
+			return ErrTrialUnavailable
+		}
+
+		hadTrial, err := repo.HasChange(ctx, userID, PlanChangeTrialStarted)
+		if err != nil {
+			return err
+		}
+		if hadTrial {
+			return ErrTrialUnavailable
+		}
+
+		return applyChange(ctx, repo, userRepo, user, PlanChangeTrialStarted, plan.Code, "", func(user *users.User) {
+			user.ExtendPremium(plan.TrialDuration())
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *planService) RedeemPromo(ctx context.Context, userID uuid.UUID, code string) (*users.User, error) {
+	var user *users.User
+	err := s.repo.RedeemPromo(ctx, code, userID, func(repo PlanRepository, userRepo users.Repository, promo *PromoCode) error {
+		var err error
+		user, err = lockUser(ctx, userRepo, userID)
+		if err != nil {
+			return err
+		}
+		return applyChange(ctx, repo, userRepo, user, PlanChangePromoRedeemed, "", promo.Code, func(user *users.User) {
+			user.ExtendPremium(time.Duration(promo.Days) * 24 * time.Hour)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Renew extends premium to periodEnd, the end of the period the provider
+// was paid for, or by the plan's term when the provider doesn't say.
+func (s *planService) Renew(ctx context.Context, user *users.User, planCode string, periodEnd *time.Time, reference string) error {
+	planCode = planCodeOrDefault(planCode)
+	plan, err := s.repo.GetPlan(ctx, planCode)
+	if err != nil {
+		return err
+	}
+	term := TermMonthly
+	if plan != nil {
+		term = plan.Term
+	}
+
+	return s.change(ctx, user, PlanChangeRenewed, planCode, reference, func(user *users.User) {
+		if periodEnd != nil {
+			user.ExtendPremiumUntil(*periodEnd)
+			return
+		}
+		user.ExtendPremium(term.Duration())
+	})
+}
+
+// StartGrace keeps the user premium for the plan's grace period after a
+// failed payment, giving the provider time to retry it.
+func (s *planService) StartGrace(ctx context.Context, user *users.User, planCode string, reference string) error {
+	planCode = planCodeOrDefault(planCode)
+	plan, err := s.repo.GetPlan(ctx, planCode)
+	if err != nil {
+		return err
+	}
+	grace := time.Duration(defaultGraceDays) * 24 * time.Hour
+	if plan != nil {
+		grace = plan.GracePeriod()
+	}
+
+	return s.change(ctx, user, PlanChangeGraceStarted, planCode, reference, func(user *users.User) {
+		user.StartGracePeriod(grace)
+	})
+}
+
+func (s *planService) Cancel(ctx context.Context, user *users.User, planCode string, reference string) error {
+	return s.change(ctx, user, PlanChangeCancelled, planCodeOrDefault(planCode), reference, func(user *users.User) {
+		user.CancelPremium()
+	})
+}
+
+func (s *planService) History(ctx context.Context, userID uuid.UUID) ([]*PlanChange, error) {
+	return s.repo.ListChanges(ctx, userID)
+}
+
+// change applies apply to the user's locked row, then saves the user and
+// records the change in one transaction. user is updated to the saved
+// copy, so changes made since it was loaded aren't overwritten.
+func (s *planService) change(ctx context.Context, user *users.User, kind PlanChangeKind, planCode, reference string, apply func(user *users.User)) error {
+	var locked *users.User
+	err := s.repo.Transaction(ctx, func(repo PlanRepository, userRepo users.Repository) error {
+		var err error
+		locked, err = lockUser(ctx, userRepo, user.ID)
+		if err != nil {
+			return err
+		}
+		return applyChange(ctx, repo, userRepo, locked, kind, planCode, reference, apply)
+	})
+	if err != nil {
+		return err
+	}
+	*user = *locked
+	return nil
+}
+
+// applyChange is change with repositories bound to a transaction the
+// caller has already started and a user it has locked.
+func applyChange(ctx context.Context, repo PlanRepository, userRepo users.Repository, user *users.User, kind PlanChangeKind, planCode, reference string, apply func(user *users.User)) error {
+	before := copyTime(user.PremiumUntil)
+	apply(user)
+
+	if err := userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	return repo.AddChange(ctx, &PlanChange{
+		ID:                 uuid.New(),
+		UserID:             user.ID,
+		Kind:               kind,
+		PlanCode:           planCode,
+		Reference:          reference,
+		PremiumUntilBefore: before,
+		PremiumUntilAfter:  copyTime(user.PremiumUntil),
+		GraceUntil:         copyTime(user.GraceUntil),
+		CreatedAt:          time.Now(),
+	})
+}
+
+// lockUser reads the user through a repository bound to a transaction and
+// locks their row until it ends.
+func lockUser(ctx context.Context, userRepo users.Repository, userID uuid.UUID) (*users.User, error) {
+	user, err := userRepo.GetByIDForUpdate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+	return user, nil
+}
+
+func planCodeOrDefault(code string) string {
+	if code == "" {
+		return DefaultPlanCode
+	}
+	return code
+}
@@ -0,0 +1,214 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPlanService(t *testing.T) (PlanService, *mockPlanRepository, *users.User) {
+	t.Helper()
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	userRepo := userstest.NewUserRepository(user)
+	repo := newMockPlanRepository(userRepo)
+	return NewPlanService(repo, userRepo), repo, user
+}
+
+func TestStartTrial(t *testing.T) {
+	// Arrange
+	service, repo, user := setupPlanService(t)
+	ctx := context.Background()
+
+	// Act
+	updated, err := service.StartTrial(ctx, user.ID, "")
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, updated.IsPremium())
+	assert.WithinDuration(t, time.Now().Add(14*24*time.Hour), *updated.PremiumUntil, 2*time.Second)
+	require.Len(t, repo.changes, 1)
+	assert.Equal(t, PlanChangeTrialStarted, repo.changes[0].Kind)
+	assert.Equal(t, "premium_monthly", repo.changes[0].PlanCode)
+}
+
+func TestStartTrialOncePerUser(t *testing.T) {
+	// Arrange
+	service, _, user := setupPlanService(t)
+	ctx := context.Background()
+	_, err := service.StartTrial(ctx, user.ID, "")
+	require.NoError(t, err)
+	user.CancelPremium()
+
+	// Act
+	_, err = service.StartTrial(ctx, user.ID, "")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTrialUnavailable)
+}
+
+func TestStartTrialUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		planCode string
+		premium  bool
+		expected error
+	}{
+		{name: "Plan without trial", planCode: "premium_yearly", expected: ErrTrialUnavailable},
+		{name: "Unknown plan", planCode: "lifetime", expected: ErrPlanNotFound},
+		{name: "Already premium", planCode: "premium_monthly", premium: true, expected: ErrTrialUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			service, _, user := setupPlanService(t)
+			if tt.premium {
+				user.ExtendPremium(24 * time.Hour)
+			}
+
+			// Act
+			_, err := service.StartTrial(context.Background(), user.ID, tt.planCode)
+
+			// Assert
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
+
+func TestRedeemPromoStacksOnPremium(t *testing.T) {
+	// Arrange
+	service, repo, user := setupPlanService(t)
+	ctx := context.Background()
+	repo.promos["LAUNCH30"] = &PromoCode{Code: "LAUNCH30", Days: 30, Active: true}
+	premiumUntil := time.Now().Add(10 * 24 * time.Hour)
+	user.PremiumUntil = &premiumUntil
+
+	// Act
+	updated, err := service.RedeemPromo(ctx, user.ID, "LAUNCH30")
+	_, againErr := service.RedeemPromo(ctx, user.ID, "LAUNCH30")
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, premiumUntil.Add(30*24*time.Hour), *updated.PremiumUntil)
+	assert.ErrorIs(t, againErr, ErrPromoAlreadyApplied)
+	assert.Equal(t, 1, repo.promos["LAUNCH30"].Redemptions)
+	assert.Equal(t, "LAUNCH30", repo.changes[0].Reference)
+}
+
+func TestPlanChangesKeepConcurrentChanges(t *testing.T) {
+	premiumUntil := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		change   func(service PlanService, user *users.User) (*users.User, error)
+		expected time.Time
+	}{
+		{
+			name: "Redeeming a promo",
+			change: func(service PlanService, user *users.User) (*users.User, error) {
+				return service.RedeemPromo(context.Background(), user.ID, "LAUNCH30")
+			},
+			expected: premiumUntil.Add(30 * 24 * time.Hour),
+		},
+		{
+			name: "Renewing",
+			change: func(service PlanService, user *users.User) (*users.User, error) {
+				return user, service.Renew(context.Background(), user, "", nil, "evt_1")
+			},
+			expected: premiumUntil.Add(30 * 24 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			user := users.NewUser("Jane", "Doe", "jane@example.com")
+			userRepo := userstest.NewUserRepository(user)
+			repo := newMockPlanRepository(userRepo)
+			repo.promos["LAUNCH30"] = &PromoCode{Code: "LAUNCH30", Days: 30, Active: true}
+			service := NewPlanService(repo, userRepo)
+			loaded, err := userRepo.GetByID(context.Background(), user.ID)
+			require.NoError(t, err)
+			repo.beforeTransaction = func() {
+				user.PremiumUntil = &premiumUntil
+				repo.beforeTransaction = nil
+			}
+
+			// Act
+			updated, err := tt.change(service, loaded)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, *updated.PremiumUntil, "The change should build on the user as saved, not as loaded")
+			assert.Equal(t, tt.expected, *user.PremiumUntil)
+		})
+	}
+}
+
+func TestRedeemPromoRollsBackWhenSavingFails(t *testing.T) {
+	// Arrange
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	userRepo := userstest.NewUserRepository(user)
+	userRepo.UpdateErr = errors.New("database unavailable")
+	repo := newMockPlanRepository(userRepo)
+	repo.promos["LAUNCH30"] = &PromoCode{Code: "LAUNCH30", Days: 30, Active: true}
+	service := NewPlanService(repo, userRepo)
+
+	// Act
+	_, err := service.RedeemPromo(context.Background(), user.ID, "LAUNCH30")
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, 0, repo.promos["LAUNCH30"].Redemptions)
+	assert.Empty(t, repo.changes)
+}
+
+func TestPromoCodeRedeemable(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		promo    PromoCode
+		expected bool
+	}{
+		{name: "Active code", promo: PromoCode{Days: 7, Active: true}, expected: true},
+		{name: "Inactive code", promo: PromoCode{Days: 7}, expected: false},
+		{name: "Expired code", promo: PromoCode{Days: 7, Active: true, ExpiresAt: &past}, expected: false},
+		{name: "Fully redeemed", promo: PromoCode{Days: 7, Active: true, MaxRedemptions: 2, Redemptions: 2}, expected: false},
+		{name: "Redemptions left", promo: PromoCode{Days: 7, Active: true, MaxRedemptions: 2, Redemptions: 1}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.promo.Redeemable(now))
+		})
+	}
+}
+
+func TestHistoryIsNewestFirst(t *testing.T) {
+	// Arrange
+	service, repo, user := setupPlanService(t)
+	ctx := context.Background()
+	repo.promos["WELCOME"] = &PromoCode{Code: "WELCOME", Days: 7, Active: true}
+	_, err := service.StartTrial(ctx, user.ID, "")
+	require.NoError(t, err)
+	_, err = service.RedeemPromo(ctx, user.ID, "WELCOME")
+	require.NoError(t, err)
+
+	// Act
+	history, err := service.History(ctx, user.ID)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, PlanChangePromoRedeemed, history[0].Kind)
+	assert.Equal(t, PlanChangeTrialStarted, history[1].Kind)
+	assert.Equal(t, history[1].PremiumUntilAfter, history[0].PremiumUntilBefore)
+}
@@ -0,0 +1,247 @@
+package billing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const webhookTolerance = 5 * time.Minute
+
+type StripeConfig struct {
+	SecretKey     string
+	WebhookSecret string
+	PriceID       string
+	SuccessURL    string
+	CancelURL     string
+	BaseURL       string
+}
+
+// stripeProvider talks to the Stripe API, or to anything that speaks it
+// such as stripe-mock.
+type stripeProvider struct {
+	config     StripeConfig
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+func NewStripeProvider(config StripeConfig) Provider {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.stripe.com"
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	return &stripeProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+	}
+}
+
+func (p *stripeProvider) Name() string {
+	return "stripe"
+}
+
+func (p *stripeProvider) CreateCheckoutSession(ctx context.Context, request CheckoutRequest) (*CheckoutSession, error) {
+	priceID := request.PriceID
+	if priceID == "" {
+		priceID = p.config.PriceID
+	}
+
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("line_items[0][price]", priceID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", p.config.SuccessURL)
+	form.Set("cancel_url", p.config.CancelURL)
+	form.Set("client_reference_id", request.UserID.String())
+	form.Set("customer_email", request.Email)
+	form.Set("metadata[user_id]", request.UserID.String())
+	form.Set("subscription_data[metadata][user_id]", request.UserID.String())
+	if request.PlanCode != "" {
+		form.Set("metadata[plan_code]", request.PlanCode)
+		form.Set("subscription_data[metadata][plan_code]", request.PlanCode)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.BaseURL+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.config.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var stripeErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &stripeErr)
+		return nil, fmt.Errorf("failed to create checkout session: %s %s", resp.Status, stripeErr.Error.Message)
+	}
+
+	var session struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(body, &session); err != nil {
+		return nil, err
+	}
+
+	return &CheckoutSession{ID: session.ID, URL: session.URL}, nil
+}
+
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object stripeObject `json:"object"`
+	} `json:"data"`
+}
+
+type stripeObject struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	Subscription      string            `json:"subscription"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Metadata          map[string]string `json:"metadata"`
+	PeriodEnd         int64             `json:"period_end"`
+	Lines             struct {
+		Data []struct {
+			Period struct {
+				End int64 `json:"end"`
+			} `json:"period"`
+		} `json:"data"`
+	} `json:"lines"`
+	SubscriptionDetails struct {
+		Metadata map[string]string `json:"metadata"`
+	} `json:"subscription_details"`
+}
+
+func (p *stripeProvider) ParseWebhook(payload []byte, signature string) (*Event, error) {
+	if err := p.verifySignature(payload, signature); err != nil {
+		return nil, err
+	}
+
+	var raw stripeEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+
+	object := raw.Data.Object
+	event := &Event{
+		ID:             raw.ID,
+		Type:           EventType(raw.Type),
+		CustomerID:     object.Customer,
+		SubscriptionID: object.Subscription,
+	}
+
+	switch event.Type {
+	case EventCheckoutCompleted:
+		event.UserID = parseUserID(object.ClientReferenceID, object.Metadata["user_id"])
+		event.PlanCode = object.Metadata["plan_code"]
+	case EventInvoicePaid, EventInvoicePaymentFailed:
+		event.UserID = parseUserID(object.SubscriptionDetails.Metadata["user_id"])
+		event.PlanCode = object.SubscriptionDetails.Metadata["plan_code"]
+		// An invoice pays for the period of its subscription line item,
+		// which ends later than the invoice's own period.
+		periodEnd := object.PeriodEnd
+		for _, line := range object.Lines.Data {
+			periodEnd = max(periodEnd, line.Period.End)
+		}
+		if periodEnd > 0 {
+			end := time.Unix(periodEnd, 0)
+			event.PeriodEnd = &end
+		}
+	case EventSubscriptionCancelled:
+		event.SubscriptionID = object.ID
+		event.UserID = parseUserID(object.Metadata["user_id"])
+		event.PlanCode = object.Metadata["plan_code"]
+	}
+
+	return event, nil
+}
+
+// verifySignature checks a Stripe-Signature header of the form
+// "t=<unix>,v1=<hex hmac>" against the webhook secret. Without a secret
+// anyone could sign, so every webhook is rejected.
+func (p *stripeProvider) verifySignature(payload []byte, header string) error {
+	if p.config.WebhookSecret == "" {
+		return ErrWebhookNotConfigured
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, item := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := p.now().Sub(time.Unix(unix, 0))
+	if age > webhookTolerance || age < -webhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := SignStripePayload(p.config.WebhookSecret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// SignStripePayload computes the v1 signature Stripe sends for payload.
+func SignStripePayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func parseUserID(candidates ...string) *uuid.UUID {
+	for _, candidate := range candidates {
+		if id, err := uuid.Parse(candidate); err == nil {
+			return &id
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package billing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func signedHeader(payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + SignStripePayload(testWebhookSecret, timestamp, payload)
+}
+
+func TestCreateCheckoutSession(t *testing.T) {
+	// Arrange
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		received = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"cs_test_123","url":"https://checkout.stripe.test/cs_test_123"}`))
+	}))
+	defer server.Close()
+
+	provider := NewStripeProvider(StripeConfig{
+		SecretKey:  "sk_test",
+		PriceID:    "price_premium",
+		SuccessURL: "https://note.local/ok",
+		CancelURL:  "https://note.local/cancel",
+		BaseURL:    server.URL,
+	})
+	userID := uuid.New()
+
+	// Act
+	session, err := provider.CreateCheckoutSession(context.Background(), CheckoutRequest{UserID: userID, Email: "jane@example.com"})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "cs_test_123", session.ID)
+	assert.Equal(t, "https://checkout.stripe.test/cs_test_123", session.URL)
+	assert.Equal(t, "/v1/checkout/sessions", received.URL.Path)
+	assert.Equal(t, "Bearer sk_test", received.Header.Get("Authorization"))
+	assert.Equal(t, "subscription", received.PostForm.Get("mode"))
+	assert.Equal(t, "price_premium", received.PostForm.Get("line_items[0][price]"))
+	assert.Equal(t, userID.String(), received.PostForm.Get("client_reference_id"))
+	assert.Equal(t, userID.String(), received.PostForm.Get("subscription_data[metadata][user_id]"))
+}
+
+func TestCreateCheckoutSessionError(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"No such price"}}`))
+	}))
+	defer server.Close()
+	provider := NewStripeProvider(StripeConfig{BaseURL: server.URL})
+
+	// Act
+	_, err := provider.CreateCheckoutSession(context.Background(), CheckoutRequest{UserID: uuid.New()})
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No such price")
+}
+
+func TestParseWebhookSignature(t *testing.T) {
+	provider := NewStripeProvider(StripeConfig{WebhookSecret: testWebhookSecret})
+	payload := []byte(`{"id":"evt_1","type":"invoice.paid","data":{"object":{"customer":"cus_1"}}}`)
+
+	tests := []struct {
+		name      string
+		signature string
+		valid     bool
+	}{
+		{name: "Valid", signature: signedHeader(payload, time.Now()), valid: true},
+		{name: "Several signatures", signature: signedHeader(payload, time.Now()) + ",v1=deadbeef", valid: true},
+		{name: "Too old", signature: signedHeader(payload, time.Now().Add(-10*time.Minute)), valid: false},
+		{name: "Wrong secret", signature: "t=" + strconv.FormatInt(time.Now().Unix(), 10) + ",v1=" + SignStripePayload("other", strconv.FormatInt(time.Now().Unix(), 10), payload), valid: false},
+		{name: "Missing", signature: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.ParseWebhook(payload, tt.signature)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestParseWebhookWithoutSecret(t *testing.T) {
+	// Arrange
+	provider := NewStripeProvider(StripeConfig{})
+	payload := []byte(`{"id":"evt_1","type":"invoice.paid","data":{"object":{"customer":"cus_1"}}}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := "t=" + timestamp + ",v1=" + SignStripePayload("", timestamp, payload)
+
+	// Act
+	_, err := provider.ParseWebhook(payload, signature)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrWebhookNotConfigured)
+}
+
+func TestParseWebhookEvents(t *testing.T) {
+	provider := NewStripeProvider(StripeConfig{WebhookSecret: testWebhookSecret})
+	userID := uuid.New()
+	periodEnd := time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		payload  string
+		expected Event
+	}{
+		{
+			name:    "Checkout completed",
+			payload: `{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","customer":"cus_1","subscription":"sub_1","client_reference_id":"` + userID.String() + `"}}}`,
+			expected: Event{
+				ID: "evt_1", Type: EventCheckoutCompleted, CustomerID: "cus_1", SubscriptionID: "sub_1", UserID: &userID,
+			},
+		},
+		{
+			name:    "Invoice paid uses the line period",
+			payload: `{"id":"evt_2","type":"invoice.paid","data":{"object":{"id":"in_1","customer":"cus_1","subscription":"sub_1","period_end":1700000000,"lines":{"data":[{"period":{"end":` + strconv.FormatInt(periodEnd.Unix(), 10) + `}}]}}}}`,
+			expected: Event{
+				ID: "evt_2", Type: EventInvoicePaid, CustomerID: "cus_1", SubscriptionID: "sub_1", PeriodEnd: &periodEnd,
+			},
+		},
+		{
+			name:    "Subscription deleted",
+			payload: `{"id":"evt_3","type":"customer.subscription.deleted","data":{"object":{"id":"sub_1","customer":"cus_1","metadata":{"user_id":"` + userID.String() + `"}}}}`,
+			expected: Event{
+				ID: "evt_3", Type: EventSubscriptionCancelled, CustomerID: "cus_1", SubscriptionID: "sub_1", UserID: &userID,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(tt.payload)
+
+			event, err := provider.ParseWebhook(payload, signedHeader(payload, time.Now()))
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected.ID, event.ID)
+			assert.Equal(t, tt.expected.Type, event.Type)
+			assert.Equal(t, tt.expected.CustomerID, event.CustomerID)
+			assert.Equal(t, tt.expected.SubscriptionID, event.SubscriptionID)
+			assert.Equal(t, tt.expected.UserID, event.UserID)
+			if tt.expected.PeriodEnd != nil {
+				require.NotNil(t, event.PeriodEnd)
+				assert.True(t, tt.expected.PeriodEnd.Equal(*event.PeriodEnd))
+			}
+		})
+	}
+}
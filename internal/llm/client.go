@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Provider string
+
+const (
+	ProviderGemini Provider = "gemini"
+	ProviderOpenAI Provider = "openai"
+)
+
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+var (
+	ErrMissingAPIKey       = errors.New("llm: missing API key")
+	ErrUnsupportedProvider = errors.New("llm: unsupported provider")
+	ErrEmptyResponse       = errors.New("llm: empty response")
+)
+
+type Message struct {
+	Role    Role
+	Content string
+}
+
+type ChatRequest struct {
+	Messages    []Message
+	Model       string
+	Temperature *float64
+	MaxTokens   int
+}
+
+type ChatResponse struct {
+	Content      string
+	Model        string
+	FinishReason string
+	Usage        Usage
+}
+
+type EmbedRequest struct {
+	Inputs []string
+	Model  string
+}
+
+type EmbedResponse struct {
+	Embeddings [][]float32
+	Model      string
+	Usage      Usage
+}
+
+// StreamHandler receives each piece of generated text as it arrives.
+// Returning an error stops the stream.
+type StreamHandler func(delta string) error
+
+type Client interface {
+	Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error)
+	ChatStream(ctx context.Context, request ChatRequest, handler StreamHandler) (*ChatResponse, error)
+	Embed(ctx context.Context, request EmbedRequest) (*EmbedResponse, error)
+}
+
+type Config struct {
+	Provider       Provider
+	APIKey         string
+	BaseURL        string
+	Model          string
+	EmbeddingModel string
+	Timeout        time.Duration
+	MaxRetries     int
+	Recorder       UsageRecorder
+}
+
+// APIError is a non-2xx response from the provider.
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("llm: provider returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// NewClient builds the client for config.Provider. When no provider is set
+// it is inferred from the base URL, defaulting to the OpenAI-compatible API.
+func NewClient(config Config) (Client, error) {
+	if config.APIKey == "" {
+		return nil, ErrMissingAPIKey
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 60 * time.Second
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.Provider == "" {
+		config.Provider = inferProvider(config.BaseURL)
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	transport := &transport{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: config.Timeout,
+			},
+		},
+		timeout:    config.Timeout,
+		maxRetries: config.MaxRetries,
+	}
+
+	switch config.Provider {
+	case ProviderGemini:
+		return newGeminiClient(config, transport), nil
+	case ProviderOpenAI:
+		return newOpenAIClient(config, transport), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, config.Provider)
+	}
+}
+
+func inferProvider(baseURL string) Provider {
+	if strings.Contains(baseURL, "generativelanguage.googleapis.com") {
+		return ProviderGemini
+	}
+	return ProviderOpenAI
+}
+
+func modelOrDefault(requested, fallback string) string {
+	if requested != "" {
+		return requested
+	}
+	return fallback
+}
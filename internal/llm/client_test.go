@@ -0,0 +1,256 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nantestech/note-api/internal/llm/llmtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	retryBaseDelay = time.Millisecond
+}
+
+type providerCase struct {
+	name     string
+	provider Provider
+	baseURL  func(server *llmtest.Server) string
+}
+
+var providerCases = []providerCase{
+	{name: "Gemini", provider: ProviderGemini, baseURL: (*llmtest.Server).GeminiBaseURL},
+	{name: "OpenAI", provider: ProviderOpenAI, baseURL: (*llmtest.Server).OpenAIBaseURL},
+}
+
+func newTestClient(t *testing.T, tc providerCase, recorder UsageRecorder) (Client, *llmtest.Server) {
+	server := llmtest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(Config{
+		Provider:   tc.provider,
+		APIKey:     "test-key",
+		BaseURL:    tc.baseURL(server),
+		Model:      "test-model",
+		Timeout:    5 * time.Second,
+		MaxRetries: 2,
+		Recorder:   recorder,
+	})
+	require.NoError(t, err)
+	return client, server
+}
+
+var conversation = []Message{
+	{Role: RoleSystem, Content: "You are terse"},
+	{Role: RoleUser, Content: "Say hello"},
+}
+
+func TestChat(t *testing.T) {
+	for _, tc := range providerCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			counter := NewCounter()
+			client, server := newTestClient(t, tc, counter)
+			server.SetReply("Hello there")
+
+			// Act
+			response, err := client.Chat(context.Background(), ChatRequest{Messages: conversation})
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, "Hello there", response.Content)
+			assert.Equal(t, "test-model", response.Model)
+			assert.Equal(t, Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}, response.Usage)
+			assert.Equal(t, response.Usage, counter.ByModel()["test-model"])
+
+			requests := server.Requests()
+			require.Len(t, requests, 1)
+			assert.True(t, requests[0].Header.Get("x-goog-api-key") == "test-key" ||
+				requests[0].Header.Get("Authorization") == "Bearer test-key")
+		})
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	for _, tc := range providerCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			counter := NewCounter()
+			client, server := newTestClient(t, tc, counter)
+			server.SetReply("one two three")
+			var deltas []string
+
+			// Act
+			response, err := client.ChatStream(context.Background(), ChatRequest{Messages: conversation}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, []string{"one ", "two ", "three"}, deltas)
+			assert.Equal(t, "one two three", response.Content)
+			assert.Equal(t, 3, response.Usage.CompletionTokens)
+			assert.NotEmpty(t, response.FinishReason)
+			assert.Equal(t, 8, counter.Total().TotalTokens)
+		})
+	}
+}
+
+func TestChatStreamHandlerErrorStops(t *testing.T) {
+	for _, tc := range providerCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			client, server := newTestClient(t, tc, nil)
+			server.SetReply("one two three")
+			stop := errors.New("client went away")
+			calls := 0
+
+			// Act
+			_, err := client.ChatStream(context.Background(), ChatRequest{Messages: conversation}, func(string) error {
+				calls++
+				return stop
+			})
+
+			// Assert
+			assert.ErrorIs(t, err, stop)
+			assert.Equal(t, 1, calls)
+		})
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	for _, tc := range providerCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			client, server := newTestClient(t, tc, nil)
+			server.SetEmbedding([]float32{1, 0, 0.5})
+
+			// Act
+			response, err := client.Embed(context.Background(), EmbedRequest{Inputs: []string{"first chunk", "second chunk"}})
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, [][]float32{{1, 0, 0.5}, {1, 0, 0.5}}, response.Embeddings)
+			assert.NotEmpty(t, response.Model)
+		})
+	}
+}
+
+func TestRetriesTransientErrors(t *testing.T) {
+	for _, tc := range providerCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			client, server := newTestClient(t, tc, nil)
+			server.FailNext(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+			// Act
+			response, err := client.Chat(context.Background(), ChatRequest{Messages: conversation})
+
+			// Assert
+			require.NoError(t, err)
+			assert.NotEmpty(t, response.Content)
+			assert.Len(t, server.Requests(), 3)
+		})
+	}
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	// Arrange
+	client, server := newTestClient(t, providerCases[0], nil)
+	server.FailNext(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+
+	// Act
+	_, err := client.Chat(context.Background(), ChatRequest{Messages: conversation})
+
+	// Assert
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Len(t, server.Requests(), 3)
+}
+
+func TestDoesNotRetryClientErrors(t *testing.T) {
+	// Arrange
+	client, server := newTestClient(t, providerCases[1], nil)
+	server.FailNext(http.StatusBadRequest)
+
+	// Act
+	_, err := client.Chat(context.Background(), ChatRequest{Messages: conversation})
+
+	// Assert
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "Bad Request", apiErr.Message)
+	assert.Len(t, server.Requests(), 1)
+}
+
+func TestGeminiRequestMapsRoles(t *testing.T) {
+	// Arrange
+	client, server := newTestClient(t, providerCases[0], nil)
+	messages := append(conversation, Message{Role: RoleAssistant, Content: "Hello"}, Message{Role: RoleUser, Content: "Again"})
+
+	// Act
+	_, err := client.Chat(context.Background(), ChatRequest{Messages: messages, MaxTokens: 10})
+	require.NoError(t, err)
+
+	// Assert
+	var body geminiGenerateRequest
+	require.NoError(t, json.Unmarshal(server.Requests()[0].Body, &body))
+	assert.Equal(t, "You are terse", body.SystemInstruction.Parts[0].Text)
+	roles := make([]string, 0, len(body.Contents))
+	for _, content := range body.Contents {
+		roles = append(roles, content.Role)
+	}
+	assert.Equal(t, []string{"user", "model", "user"}, roles)
+	assert.Equal(t, 10, body.GenerationConfig.MaxOutputTokens)
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expected    any
+		expectedErr error
+	}{
+		{name: "Missing key", config: Config{BaseURL: "https://api.openai.com/v1"}, expectedErr: ErrMissingAPIKey},
+		{name: "Infers Gemini", config: Config{APIKey: "k", BaseURL: "https://generativelanguage.googleapis.com/"}, expected: &geminiClient{}},
+		{name: "Defaults to OpenAI", config: Config{APIKey: "k", BaseURL: "http://localhost:11434/v1"}, expected: &openAIClient{}},
+		{name: "Unknown provider", config: Config{APIKey: "k", Provider: "acme"}, expectedErr: ErrUnsupportedProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.config)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.IsType(t, tt.expected, client)
+		})
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	// Arrange
+	stream := "event: message\ndata: {\"a\":1}\n\n: comment\ndata: line one\ndata: line two\n\ndata: last"
+	var events []string
+
+	// Act
+	err := readSSE(strings.NewReader(stream), func(data []byte) error {
+		events = append(events, string(data))
+		return nil
+	})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"a":1}`, "line one\nline two", "last"}, events)
+}
@@ -0,0 +1,225 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+const defaultGeminiEmbeddingModel = "text-embedding-004"
+
+type geminiClient struct {
+	config    Config
+	transport *transport
+}
+
+func newGeminiClient(config Config, transport *transport) Client {
+	if config.EmbeddingModel == "" {
+		config.EmbeddingModel = defaultGeminiEmbeddingModel
+	}
+	return &geminiClient{config: config, transport: transport}
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+}
+
+type geminiGenerateRequest struct {
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent         `json:"contents"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type geminiGenerateResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata"`
+	ModelVersion  string               `json:"modelVersion"`
+}
+
+func (r *geminiGenerateResponse) text() string {
+	// Only one candidate is ever requested.
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+func (r *geminiGenerateResponse) finishReason() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	return r.Candidates[0].FinishReason
+}
+
+func (r *geminiGenerateResponse) usage() Usage {
+	if r.UsageMetadata == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     r.UsageMetadata.PromptTokenCount,
+		CompletionTokens: r.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      r.UsageMetadata.TotalTokenCount,
+	}
+}
+
+func (c *geminiClient) Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error) {
+	model := modelOrDefault(request.Model, c.config.Model)
+
+	var response geminiGenerateResponse
+	err := c.transport.postJSON(ctx, c.url(model, "generateContent"), c.headers(), c.generateRequest(request), &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Candidates) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	result := &ChatResponse{
+		Content:      response.text(),
+		Model:        model,
+		FinishReason: response.finishReason(),
+		Usage:        response.usage(),
+	}
+	record(ctx, c.config.Recorder, model, result.Usage)
+	return result, nil
+}
+
+func (c *geminiClient) ChatStream(ctx context.Context, request ChatRequest, handler StreamHandler) (*ChatResponse, error) {
+	model := modelOrDefault(request.Model, c.config.Model)
+
+	resp, err := c.transport.post(ctx, c.url(model, "streamGenerateContent")+"?alt=sse", c.headers(), c.generateRequest(request))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &ChatResponse{Model: model}
+	var content strings.Builder
+	err = readSSE(resp.Body, func(data []byte) error {
+		var chunk geminiGenerateResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return err
+		}
+
+		// Every chunk carries the running usage, so the last one wins.
+		if chunk.UsageMetadata != nil {
+			result.Usage = chunk.usage()
+		}
+		if reason := chunk.finishReason(); reason != "" {
+			result.FinishReason = reason
+		}
+
+		delta := chunk.text()
+		if delta == "" {
+			return nil
+		}
+		content.WriteString(delta)
+		return handler(delta)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = content.String()
+	record(ctx, c.config.Recorder, model, result.Usage)
+	return result, nil
+}
+
+func (c *geminiClient) Embed(ctx context.Context, request EmbedRequest) (*EmbedResponse, error) {
+	model := modelOrDefault(request.Model, c.config.EmbeddingModel)
+
+	type embedContentRequest struct {
+		Model   string        `json:"model"`
+		Content geminiContent `json:"content"`
+	}
+	body := struct {
+		Requests []embedContentRequest `json:"requests"`
+	}{}
+	for _, input := range request.Inputs {
+		body.Requests = append(body.Requests, embedContentRequest{
+			Model:   "models/" + model,
+			Content: geminiContent{Parts: []geminiPart{{Text: input}}},
+		})
+	}
+
+	var response struct {
+		Embeddings []struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	}
+	err := c.transport.postJSON(ctx, c.url(model, "batchEmbedContents"), c.headers(), body, &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) != len(request.Inputs) {
+		return nil, ErrEmptyResponse
+	}
+
+	result := &EmbedResponse{Model: model, Embeddings: make([][]float32, 0, len(response.Embeddings))}
+	for _, embedding := range response.Embeddings {
+		result.Embeddings = append(result.Embeddings, embedding.Values)
+	}
+
+	// The embeddings API doesn't report token counts.
+	return result, nil
+}
+
+func (c *geminiClient) generateRequest(request ChatRequest) geminiGenerateRequest {
+	var generateRequest geminiGenerateRequest
+
+	var system []geminiPart
+	for _, message := range request.Messages {
+		switch message.Role {
+		case RoleSystem:
+			system = append(system, geminiPart{Text: message.Content})
+		case RoleAssistant:
+			generateRequest.Contents = append(generateRequest.Contents, geminiContent{Role: "model", Parts: []geminiPart{{Text: message.Content}}})
+		default:
+			generateRequest.Contents = append(generateRequest.Contents, geminiContent{Role: "user", Parts: []geminiPart{{Text: message.Content}}})
+		}
+	}
+	if len(system) > 0 {
+		generateRequest.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if request.Temperature != nil || request.MaxTokens > 0 {
+		generateRequest.GenerationConfig = &geminiGenerationConfig{
+			Temperature:     request.Temperature,
+			MaxOutputTokens: request.MaxTokens,
+		}
+	}
+
+	return generateRequest
+}
+
+func (c *geminiClient) url(model, method string) string {
+	return c.config.BaseURL + "/v1beta/models/" + model + ":" + method
+}
+
+func (c *geminiClient) headers() map[string]string {
+	return map[string]string{"x-goog-api-key": c.config.APIKey}
+}
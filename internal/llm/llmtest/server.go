@@ -0,0 +1,269 @@
+// Package llmtest provides an in-process stand-in for the Gemini and
+// OpenAI-compatible HTTP APIs, so LLM code can be tested offline.
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+type Request struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Server answers every chat request with the configured reply and every
+// embedding request with the configured vector. Token counts are the number
+// of words in and out.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	reply     string
+	embedding []float32
+	failures  []int
+	requests  []Request
+}
+
+func NewServer() *Server {
+	s := &Server{
+		reply:     "Hello from the fake LLM",
+		embedding: []float32{0.1, 0.2, 0.3},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// GeminiBaseURL is the value to use for LLM_BASE_URL with the Gemini client.
+func (s *Server) GeminiBaseURL() string {
+	return s.URL + "/"
+}
+
+// OpenAIBaseURL is the value to use for LLM_BASE_URL with the OpenAI client.
+func (s *Server) OpenAIBaseURL() string {
+	return s.URL + "/v1"
+}
+
+func (s *Server) SetReply(reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reply = reply
+}
+
+func (s *Server) SetEmbedding(embedding []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embedding = embedding
+}
+
+// FailNext makes the next requests fail with the given status codes, one
+// status per request.
+func (s *Server) FailNext(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statuses...)
+}
+
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	var failure int
+	if len(s.failures) > 0 {
+		failure, s.failures = s.failures[0], s.failures[1:]
+	}
+	reply, embedding := s.reply, s.embedding
+	s.mu.Unlock()
+
+	if failure != 0 {
+		writeJSON(w, failure, map[string]any{"error": map[string]any{"message": http.StatusText(failure)}})
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, ":generateContent"):
+		writeJSON(w, http.StatusOK, geminiResponse(reply, countWords(body), true))
+	case strings.HasSuffix(path, ":streamGenerateContent"):
+		s.streamGemini(w, reply, countWords(body))
+	case strings.HasSuffix(path, ":batchEmbedContents"):
+		s.embedGemini(w, body, embedding)
+	case strings.HasSuffix(path, "/chat/completions"):
+		var request struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		_ = json.Unmarshal(body, &request)
+		if request.Stream {
+			s.streamOpenAI(w, request.Model, reply, countWords(body))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"model": request.Model,
+			"choices": []any{map[string]any{
+				"message":       map[string]any{"role": "assistant", "content": reply},
+				"finish_reason": "stop",
+			}},
+			"usage": openAIUsage(countWords(body), len(strings.Fields(reply))),
+		})
+	case strings.HasSuffix(path, "/embeddings"):
+		s.embedOpenAI(w, body, embedding)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) streamGemini(w http.ResponseWriter, reply string, promptTokens int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	words := strings.SplitAfter(reply, " ")
+	completionTokens := 0
+	for i, word := range words {
+		// Like Gemini, each chunk reports the usage so far.
+		completionTokens += len(strings.Fields(word))
+		chunk := geminiResponse(word, promptTokens, i == len(words)-1)
+		chunk["usageMetadata"] = geminiUsage(promptTokens, completionTokens)
+		writeEvent(w, chunk)
+	}
+}
+
+func (s *Server) streamOpenAI(w http.ResponseWriter, model, reply string, promptTokens int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, word := range strings.SplitAfter(reply, " ") {
+		writeEvent(w, map[string]any{
+			"model":   model,
+			"choices": []any{map[string]any{"delta": map[string]any{"content": word}}},
+		})
+	}
+	writeEvent(w, map[string]any{
+		"model":   model,
+		"choices": []any{map[string]any{"delta": map[string]any{}, "finish_reason": "stop"}},
+	})
+	writeEvent(w, map[string]any{
+		"model":   model,
+		"choices": []any{},
+		"usage":   openAIUsage(promptTokens, len(strings.Fields(reply))),
+	})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (s *Server) embedGemini(w http.ResponseWriter, body []byte, embedding []float32) {
+	var request struct {
+		Requests []any `json:"requests"`
+	}
+	_ = json.Unmarshal(body, &request)
+
+	embeddings := make([]any, 0, len(request.Requests))
+	for range request.Requests {
+		embeddings = append(embeddings, map[string]any{"values": embedding})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"embeddings": embeddings})
+}
+
+func (s *Server) embedOpenAI(w http.ResponseWriter, body []byte, embedding []float32) {
+	var request struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	_ = json.Unmarshal(body, &request)
+
+	data := make([]any, 0, len(request.Input))
+	tokens := 0
+	for i, input := range request.Input {
+		data = append(data, map[string]any{"index": i, "embedding": embedding})
+		tokens += len(strings.Fields(input))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"model": request.Model,
+		"data":  data,
+		"usage": map[string]any{"prompt_tokens": tokens, "total_tokens": tokens},
+	})
+}
+
+func geminiResponse(text string, promptTokens int, withFinish bool) map[string]any {
+	candidate := map[string]any{
+		"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": text}}},
+	}
+	if withFinish {
+		candidate["finishReason"] = "STOP"
+	}
+	return map[string]any{
+		"candidates":    []any{candidate},
+		"usageMetadata": geminiUsage(promptTokens, len(strings.Fields(text))),
+	}
+}
+
+func geminiUsage(promptTokens, completionTokens int) map[string]any {
+	return map[string]any{
+		"promptTokenCount":     promptTokens,
+		"candidatesTokenCount": completionTokens,
+		"totalTokenCount":      promptTokens + completionTokens,
+	}
+}
+
+func openAIUsage(promptTokens, completionTokens int) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+}
+
+// countWords counts the words of every "text" or "content" string in a
+// request body.
+func countWords(body []byte) int {
+	var decoded any
+	if json.Unmarshal(body, &decoded) != nil {
+		return 0
+	}
+
+	var count func(value any, key string) int
+	count = func(value any, key string) int {
+		switch v := value.(type) {
+		case map[string]any:
+			total := 0
+			for k, child := range v {
+				total += count(child, k)
+			}
+			return total
+		case []any:
+			total := 0
+			for _, child := range v {
+				total += count(child, key)
+			}
+			return total
+		case string:
+			if key == "text" || key == "content" {
+				return len(strings.Fields(v))
+			}
+		}
+		return 0
+	}
+	return count(decoded, "")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeEvent(w http.ResponseWriter, body any) {
+	data, _ := json.Marshal(body)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+const defaultOpenAIEmbeddingModel = "text-embedding-3-small"
+
+// openAIClient talks to any OpenAI-compatible chat completions API.
+type openAIClient struct {
+	config    Config
+	transport *transport
+}
+
+func newOpenAIClient(config Config, transport *transport) Client {
+	if config.EmbeddingModel == "" {
+		config.EmbeddingModel = defaultOpenAIEmbeddingModel
+	}
+	return &openAIClient{config: config, transport: transport}
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIChatRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openAIMessage      `json:"messages"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *openAIUsage) usage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+type openAIChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+func (c *openAIClient) Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error) {
+	body := c.chatRequest(request)
+
+	var response openAIChatResponse
+	err := c.transport.postJSON(ctx, c.config.BaseURL+"/chat/completions", c.headers(), body, &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	result := &ChatResponse{
+		Content:      response.Choices[0].Message.Content,
+		Model:        modelOrDefault(response.Model, body.Model),
+		FinishReason: response.Choices[0].FinishReason,
+		Usage:        response.Usage.usage(),
+	}
+	record(ctx, c.config.Recorder, result.Model, result.Usage)
+	return result, nil
+}
+
+func (c *openAIClient) ChatStream(ctx context.Context, request ChatRequest, handler StreamHandler) (*ChatResponse, error) {
+	body := c.chatRequest(request)
+	body.Stream = true
+	body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+
+	resp, err := c.transport.post(ctx, c.config.BaseURL+"/chat/completions", c.headers(), body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &ChatResponse{Model: body.Model}
+	var content strings.Builder
+	err = readSSE(resp.Body, func(data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+
+		var chunk openAIChatResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return err
+		}
+
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		// With include_usage the final chunk has usage and no choices.
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage.usage()
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			result.FinishReason = reason
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		if delta == "" {
+			return nil
+		}
+		content.WriteString(delta)
+		return handler(delta)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = content.String()
+	record(ctx, c.config.Recorder, result.Model, result.Usage)
+	return result, nil
+}
+
+func (c *openAIClient) Embed(ctx context.Context, request EmbedRequest) (*EmbedResponse, error) {
+	model := modelOrDefault(request.Model, c.config.EmbeddingModel)
+
+	body := struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{Model: model, Input: request.Inputs}
+
+	var response struct {
+		Model string `json:"model"`
+		Data  []struct {
+			Embedding []float32 `json:"embedding"`
+			Index     int       `json:"index"`
+		} `json:"data"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	err := c.transport.postJSON(ctx, c.config.BaseURL+"/embeddings", c.headers(), body, &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Data) != len(request.Inputs) {
+		return nil, ErrEmptyResponse
+	}
+
+	sort.Slice(response.Data, func(i, j int) bool {
+		return response.Data[i].Index < response.Data[j].Index
+	})
+
+	result := &EmbedResponse{
+		Model:      modelOrDefault(response.Model, model),
+		Embeddings: make([][]float32, 0, len(response.Data)),
+		Usage:      response.Usage.usage(),
+	}
+	for _, item := range response.Data {
+		result.Embeddings = append(result.Embeddings, item.Embedding)
+	}
+
+	record(ctx, c.config.Recorder, result.Model, result.Usage)
+	return result, nil
+}
+
+func (c *openAIClient) chatRequest(request ChatRequest) openAIChatRequest {
+	body := openAIChatRequest{
+		Model:       modelOrDefault(request.Model, c.config.Model),
+		Temperature: request.Temperature,
+		MaxTokens:   request.MaxTokens,
+	}
+	for _, message := range request.Messages {
+		body.Messages = append(body.Messages, openAIMessage{Role: string(message.Role), Content: message.Content})
+	}
+	return body
+}
+
+func (c *openAIClient) headers() map[string]string {
+	return map[string]string{"Authorization": "Bearer " + c.config.APIKey}
+}
@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// UsageRecorder is told about the tokens spent by every successful call.
+type UsageRecorder interface {
+	Record(ctx context.Context, model string, usage Usage)
+}
+
+// Counter is an in-memory UsageRecorder that keeps running totals per model.
+type Counter struct {
+	mu      sync.Mutex
+	byModel map[string]Usage
+}
+
+func NewCounter() *Counter {
+	return &Counter{byModel: make(map[string]Usage)}
+}
+
+func (c *Counter) Record(_ context.Context, model string, usage Usage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byModel[model] = c.byModel[model].Add(usage)
+}
+
+func (c *Counter) Total() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var total Usage
+	for _, usage := range c.byModel {
+		total = total.Add(usage)
+	}
+	return total
+}
+
+func (c *Counter) ByModel() map[string]Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[string]Usage, len(c.byModel))
+	for model, usage := range c.byModel {
+		result[model] = usage
+	}
+	return result
+}
+
+func record(ctx context.Context, recorder UsageRecorder, model string, usage Usage) {
+	if recorder != nil {
+		recorder.Record(ctx, model, usage)
+	}
+}
@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Unsubscriber turns off email for a category of mail.
+type Unsubscriber interface {
+	Unsubscribe(ctx context.Context, userID uuid.UUID, category string) error
+}
+
+type MailHandler struct {
+	signer       *UnsubscribeSigner
+	unsubscriber Unsubscriber
+}
+
+func NewMailHandler(signer *UnsubscribeSigner, unsubscriber Unsubscriber) *MailHandler {
+	return &MailHandler{
+		signer:       signer,
+		unsubscriber: unsubscriber,
+	}
+}
+
+// confirmUnsubscribePage asks before unsubscribing, since link scanners
+// and prefetchers follow the links in emails without the user.
+var confirmUnsubscribePage = htmltemplate.Must(htmltemplate.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<p>Stop receiving {{.Category}} emails?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+// HandleUnsubscribePage shows the confirmation for an unsubscribe link,
+// which posts to HandleUnsubscribe. It changes nothing itself.
+func (h *MailHandler) HandleUnsubscribePage(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing token parameter"})
+		return
+	}
+
+	_, category, err := h.signer.Verify(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	_ = confirmUnsubscribePage.Execute(c.Writer, map[string]string{
+		"Action":   "/mail/unsubscribe?token=" + url.QueryEscape(token),
+		"Category": category,
+	})
+}
+
+// HandleUnsubscribe unsubscribes from the confirmation page and from mail
+// clients' one-click unsubscribe (RFC 8058), which both post.
+func (h *MailHandler) HandleUnsubscribe(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing token parameter"})
+		return
+	}
+
+	userID, category, err := h.signer.Verify(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.unsubscriber.Unsubscribe(c.Request.Context(), userID, category); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed", "category": category})
+}
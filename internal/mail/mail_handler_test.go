@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingUnsubscriber struct {
+	calls []string
+}
+
+func (u *recordingUnsubscriber) Unsubscribe(_ context.Context, userID uuid.UUID, category string) error {
+	u.calls = append(u.calls, userID.String()+":"+category)
+	return nil
+}
+
+func TestUnsubscribe(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		body             string
+		expectedStatus   int
+		expectedBody     string
+		expectedUnsubbed bool
+	}{
+		{name: "Following the link only asks to confirm", method: http.MethodGet, expectedStatus: http.StatusOK, expectedBody: `<form method="post"`},
+		{name: "Confirming unsubscribes", method: http.MethodPost, expectedStatus: http.StatusOK, expectedBody: "Unsubscribed", expectedUnsubbed: true},
+		{name: "One-click unsubscribe", method: http.MethodPost, body: "List-Unsubscribe=One-Click", expectedStatus: http.StatusOK, expectedBody: "Unsubscribed", expectedUnsubbed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			signer := NewUnsubscribeSigner(jwt.Config{SecretKey: "secret"}, "https://note.local")
+			unsubscriber := &recordingUnsubscriber{}
+			router := gin.New()
+			MailRoutes(router, NewMailHandler(signer, unsubscriber))
+			userID := uuid.New()
+			request := httptest.NewRequest(tt.method, strings.TrimPrefix(signer.URL(userID, "digest"), "https://note.local"), strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			recorder := httptest.NewRecorder()
+
+			// Act
+			router.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), tt.expectedBody)
+			if tt.expectedUnsubbed {
+				assert.Equal(t, []string{userID.String() + ":digest"}, unsubscriber.calls)
+			} else {
+				assert.Empty(t, unsubscriber.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package mail
+
+import "github.com/gin-gonic/gin"
+
+func MailRoutes(router *gin.Engine, mailHandler *MailHandler) {
+
+	mail := router.Group("/mail")
+	{
+		// GET only asks to confirm, so that following a link changes
+		// nothing. The confirmation and one-click unsubscribe both POST.
+		mail.GET("/unsubscribe", mailHandler.HandleUnsubscribePage)
+		mail.POST("/unsubscribe", mailHandler.HandleUnsubscribe)
+	}
+}
@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrInvalidMessage = errors.New("mail message needs a recipient and a subject")
+
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+func (m Message) Validate() error {
+	if m.To == "" || m.Subject == "" {
+		return ErrInvalidMessage
+	}
+	return nil
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nantestech/note-api/internal/notifications"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+type notificationDeliverer struct {
+	outbox   OutboxService
+	renderer Renderer
+	userRepo users.Repository
+	signer   *UnsubscribeSigner
+	locale   string
+}
+
+// NewNotificationDeliverer sends notifications by email through the outbox.
+func NewNotificationDeliverer(outbox OutboxService, renderer Renderer, userRepo users.Repository, signer *UnsubscribeSigner, locale string) notifications.Deliverer {
+	return &notificationDeliverer{
+		outbox:   outbox,
+		renderer: renderer,
+		userRepo: userRepo,
+		signer:   signer,
+		locale:   locale,
+	}
+}
+
+func (d *notificationDeliverer) Deliver(ctx context.Context, notification *notifications.Notification) error {
+	user, err := d.userRepo.GetByID(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", notification.UserID)
+	}
+
+	category := string(notification.Type)
+	content, err := d.renderer.Render(TemplateNotification, d.locale, NotificationData{
+		Name:           user.FirstName,
+		Title:          notification.Title,
+		Body:           notification.Body,
+		Link:           notification.Link,
+		UnsubscribeURL: d.signer.URL(user.ID, category),
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.outbox.Enqueue(ctx, &user.ID, Message{
+		To:      user.Email,
+		Subject: content.Subject,
+		Text:    content.Text,
+		HTML:    content.HTML,
+		Headers: d.signer.Headers(user.ID, category),
+	})
+}
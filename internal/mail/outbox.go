@@ -0,0 +1,107 @@
+package mail
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	OutboxFailed  OutboxStatus = "failed"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = 6 * time.Hour
+)
+
+type OutboxMessage struct {
+	ID            uuid.UUID
+	UserID        *uuid.UUID
+	Sender        string
+	Recipient     string
+	Subject       string
+	TextBody      string
+	HTMLBody      string
+	Headers       map[string]string `gorm:"serializer:json"`
+	Status        OutboxStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+func (OutboxMessage) TableName() string {
+	return "mail_outbox"
+}
+
+func NewOutboxMessage(userID *uuid.UUID, message Message) *OutboxMessage {
+	now := time.Now()
+	return &OutboxMessage{
+		ID:            uuid.New(),
+		UserID:        userID,
+		Sender:        message.From,
+		Recipient:     message.To,
+		Subject:       message.Subject,
+		TextBody:      message.Text,
+		HTMLBody:      message.HTML,
+		Headers:       message.Headers,
+		Status:        OutboxPending,
+		Attempts:      0,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+func (m *OutboxMessage) Message() Message {
+	return Message{
+		From:    m.Sender,
+		To:      m.Recipient,
+		Subject: m.Subject,
+		Text:    m.TextBody,
+		HTML:    m.HTMLBody,
+		Headers: m.Headers,
+	}
+}
+
+func (m *OutboxMessage) MarkSent(now time.Time) {
+	m.Attempts++
+	m.Status = OutboxSent
+	m.SentAt = &now
+	m.LastError = ""
+}
+
+// MarkFailed records a failed attempt and schedules the next one, giving up
+// after maxAttempts.
+func (m *OutboxMessage) MarkFailed(err error, now time.Time, maxAttempts int) {
+	m.Attempts++
+	m.LastError = err.Error()
+	if m.Attempts >= maxAttempts {
+		m.Status = OutboxFailed
+		return
+	}
+	m.NextAttemptAt = now.Add(Backoff(m.Attempts))
+}
+
+// Backoff returns the delay before retry number attempt: 30s, 1m, 2m, ...
+// capped at six hours.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := baseBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository interface {
+	Add(ctx context.Context, message *OutboxMessage) error
+	Update(ctx context.Context, message *OutboxMessage) error
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*OutboxMessage, error)
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func (r *outboxRepository) Add(ctx context.Context, message *OutboxMessage) error {
+	return r.db.WithContext(ctx).Create(message).Error
+}
+
+func (r *outboxRepository) Update(ctx context.Context, message *OutboxMessage) error {
+	return r.db.WithContext(ctx).Save(message).Error
+}
+
+// ClaimDue locks due messages with SKIP LOCKED and pushes their next attempt
+// past the lease, so concurrent dispatchers never pick the same message.
+func (r *outboxRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*OutboxMessage, error) {
+	var messages []*OutboxMessage
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		ids := make([]any, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+
+		return tx.Model(&OutboxMessage{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error
+	})
+
+	return messages, err
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDispatchInterval = 10 * time.Second
+	defaultBatchSize        = 20
+	claimLease              = 5 * time.Minute
+)
+
+// OutboxService persists outgoing mail and delivers it in the background,
+// retrying failed sends with exponential backoff.
+type OutboxService interface {
+	Enqueue(ctx context.Context, userID *uuid.UUID, message Message) error
+	DispatchDue(ctx context.Context) (int, error)
+	Run(ctx context.Context)
+}
+
+type outboxService struct {
+	repo        OutboxRepository
+	mailer      Mailer
+	from        string
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func NewOutboxService(repo OutboxRepository, mailer Mailer, from string) OutboxService {
+	return &outboxService{
+		repo:        repo,
+		mailer:      mailer,
+		from:        from,
+		interval:    defaultDispatchInterval,
+		batchSize:   defaultBatchSize,
+		maxAttempts: DefaultMaxAttempts,
+	}
+}
+
+func (s *outboxService) Enqueue(ctx context.Context, userID *uuid.UUID, message Message) error {
+	if message.From == "" {
+		message.From = s.from
+	}
+	if err := message.Validate(); err != nil {
+		return err
+	}
+
+	return s.repo.Add(ctx, NewOutboxMessage(userID, message))
+}
+
+func (s *outboxService) DispatchDue(ctx context.Context) (int, error) {
+	messages, err := s.repo.ClaimDue(ctx, time.Now(), claimLease, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, message := range messages {
+		err := s.mailer.Send(ctx, message.Message())
+		if err != nil {
+			message.MarkFailed(err, time.Now(), s.maxAttempts)
+			log.Printf("Failed to send mail %s to %s (attempt %d): %v", message.ID, message.Recipient, message.Attempts, err)
+		} else {
+			message.MarkSent(time.Now())
+			sent++
+		}
+
+		if err := s.repo.Update(ctx, message); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+func (s *outboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.DispatchDue(ctx); err != nil {
+			log.Printf("Failed to dispatch mail outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockOutboxRepository struct {
+	messages map[string]*OutboxMessage
+}
+
+func newMockOutboxRepository() *mockOutboxRepository {
+	return &mockOutboxRepository{messages: make(map[string]*OutboxMessage)}
+}
+
+func (m *mockOutboxRepository) Add(_ context.Context, message *OutboxMessage) error {
+	m.messages[message.ID.String()] = message
+	return nil
+}
+
+func (m *mockOutboxRepository) Update(_ context.Context, message *OutboxMessage) error {
+	m.messages[message.ID.String()] = message
+	return nil
+}
+
+func (m *mockOutboxRepository) ClaimDue(_ context.Context, now time.Time, lease time.Duration, limit int) ([]*OutboxMessage, error) {
+	var due []*OutboxMessage
+	for _, message := range m.messages {
+		if len(due) == limit {
+			break
+		}
+		if message.Status == OutboxPending && !message.NextAttemptAt.After(now) {
+			message.NextAttemptAt = now.Add(lease)
+			due = append(due, message)
+		}
+	}
+	return due, nil
+}
+
+type fakeMailer struct {
+	sent []Message
+	err  error
+}
+
+func (f *fakeMailer) Send(_ context.Context, message Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, message)
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 0, expected: 30 * time.Second},
+		{attempt: 1, expected: 30 * time.Second},
+		{attempt: 2, expected: time.Minute},
+		{attempt: 5, expected: 8 * time.Minute},
+		{attempt: 20, expected: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Backoff(tt.attempt), "attempt %d", tt.attempt)
+	}
+}
+
+func TestMarkFailedGivesUp(t *testing.T) {
+	// Arrange
+	message := NewOutboxMessage(nil, Message{To: "jane@example.com", Subject: "Hi"})
+	now := time.Now()
+
+	// Act
+	message.MarkFailed(errors.New("connection refused"), now, 2)
+	firstRetry := message.NextAttemptAt
+	message.MarkFailed(errors.New("connection refused"), now, 2)
+
+	// Assert
+	assert.Equal(t, now.Add(30*time.Second), firstRetry)
+	assert.Equal(t, OutboxFailed, message.Status)
+	assert.Equal(t, 2, message.Attempts)
+	assert.Equal(t, "connection refused", message.LastError)
+}
+
+func TestDispatchDue(t *testing.T) {
+	// Arrange
+	repo := newMockOutboxRepository()
+	mailer := &fakeMailer{}
+	service := NewOutboxService(repo, mailer, "no-reply@note.local")
+	ctx := context.Background()
+	require.NoError(t, service.Enqueue(ctx, nil, Message{To: "jane@example.com", Subject: "Hi", Text: "Hello"}))
+
+	// Act
+	sent, err := service.DispatchDue(ctx)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "no-reply@note.local", mailer.sent[0].From)
+	for _, message := range repo.messages {
+		assert.Equal(t, OutboxSent, message.Status)
+		assert.NotNil(t, message.SentAt)
+	}
+}
+
+func TestDispatchDueSchedulesRetry(t *testing.T) {
+	// Arrange
+	repo := newMockOutboxRepository()
+	mailer := &fakeMailer{err: errors.New("421 try again later")}
+	service := NewOutboxService(repo, mailer, "no-reply@note.local")
+	ctx := context.Background()
+	require.NoError(t, service.Enqueue(ctx, nil, Message{To: "jane@example.com", Subject: "Hi"}))
+
+	// Act
+	sent, err := service.DispatchDue(ctx)
+	require.NoError(t, err)
+	sentAgain, err := service.DispatchDue(ctx)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 0, sentAgain, "Message should wait for its backoff")
+	for _, message := range repo.messages {
+		assert.Equal(t, OutboxPending, message.Status)
+		assert.Equal(t, 1, message.Attempts)
+		assert.True(t, message.NextAttemptAt.After(time.Now()))
+	}
+}
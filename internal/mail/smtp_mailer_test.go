@@ -0,0 +1,182 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer accepts a single message and hands its envelope and
+// data back over a channel
+type fakeSMTPServer struct {
+	listener net.Listener
+	received chan receivedMail
+}
+
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSMTPServer{listener: listener, received: make(chan receivedMail, 1)}
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var current receivedMail
+	reply("220 fake ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimSpace(line)
+		upper := strings.ToUpper(command)
+
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			current.from = strings.Trim(command[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			current.to = append(current.to, strings.Trim(command[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			current.data = data.String()
+			s.received <- current
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	// Arrange
+	server := newFakeSMTPServer(t)
+	mailer := NewSMTPMailer(SMTPConfig{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		From: "Note <no-reply@note.local>",
+	})
+	message := Message{
+		To:      "jane@example.com",
+		Subject: "Olá, Jane",
+		Text:    "Plain body",
+		HTML:    "<p>HTML body</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://note.local/u>"},
+	}
+
+	// Act
+	err := mailer.Send(context.Background(), message)
+
+	// Assert
+	require.NoError(t, err)
+	select {
+	case received := <-server.received:
+		assert.Equal(t, "no-reply@note.local", received.from)
+		assert.Equal(t, []string{"jane@example.com"}, received.to)
+
+		parsed, err := mail.ReadMessage(strings.NewReader(received.data))
+		require.NoError(t, err)
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		require.NoError(t, err)
+		assert.Equal(t, "Olá, Jane", subject)
+		assert.Equal(t, "<https://note.local/u>", parsed.Header.Get("List-Unsubscribe"))
+		assert.Contains(t, parsed.Header.Get("Content-Type"), "multipart/alternative")
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not received")
+	}
+}
+
+func TestSMTPMailerRejectsInvalidMessage(t *testing.T) {
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: 1, From: "no-reply@note.local"})
+
+	err := mailer.Send(context.Background(), Message{To: "jane@example.com"})
+
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestBuildMIMEParts(t *testing.T) {
+	// Arrange
+	message := Message{
+		From:    "no-reply@note.local",
+		To:      "jane@example.com",
+		Subject: "Hello",
+		Text:    "Plain body",
+		HTML:    "<p>HTML body</p>",
+	}
+
+	// Act
+	raw, err := buildMIME(message, time.Now())
+	require.NoError(t, err)
+
+	// Assert
+	parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	require.NoError(t, err)
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var contentTypes, bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+
+	assert.Equal(t, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}, contentTypes)
+	assert.Equal(t, []string{"Plain body", "<p>HTML body</p>"}, bodies)
+}
@@ -0,0 +1,145 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+type Template string
+
+const (
+	TemplateInvitation    Template = "invitation"
+	TemplateReminder      Template = "reminder"
+	TemplateDigest        Template = "digest"
+	TemplateNotification  Template = "notification"
+	TemplateVerifyEmail   Template = "verify_email"
+	TemplatePasswordReset Template = "password_reset"
+	TemplateMagicLink     Template = "magic_link"
+)
+
+var ErrTemplateNotFound = errors.New("mail template not found")
+
+//go:embed templates
+var templateFS embed.FS
+
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Renderer interface {
+	Render(name Template, locale string, data any) (*Content, error)
+}
+
+// templateRenderer loads templates/<name>.<locale>.txt and .html pairs. The
+// subject comes from a "subject" block defined in the text template.
+type templateRenderer struct {
+	defaultLocale string
+	text          map[string]*texttemplate.Template
+	html          map[string]*htmltemplate.Template
+}
+
+func NewTemplateRenderer(defaultLocale string) (Renderer, error) {
+	renderer := &templateRenderer{
+		defaultLocale: defaultLocale,
+		text:          make(map[string]*texttemplate.Template),
+		html:          make(map[string]*htmltemplate.Template),
+	}
+
+	err := fs.WalkDir(templateFS, "templates", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		content, err := templateFS.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(path, "templates/")
+		switch {
+		case strings.HasSuffix(name, ".txt"):
+			key := strings.TrimSuffix(name, ".txt")
+			parsed, err := texttemplate.New(key).Parse(string(content))
+			if err != nil {
+				return err
+			}
+			renderer.text[key] = parsed
+		case strings.HasSuffix(name, ".html"):
+			key := strings.TrimSuffix(name, ".html")
+			parsed, err := htmltemplate.New(key).Parse(string(content))
+			if err != nil {
+				return err
+			}
+			renderer.html[key] = parsed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renderer, nil
+}
+
+func (r *templateRenderer) Render(name Template, locale string, data any) (*Content, error) {
+	key, ok := r.resolve(name, locale)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	textTemplate := r.text[key]
+
+	var subject bytes.Buffer
+	if err := textTemplate.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	var text bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return nil, err
+	}
+
+	content := &Content{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+
+	if htmlTemplate, ok := r.html[key]; ok {
+		var html bytes.Buffer
+		if err := htmlTemplate.Execute(&html, data); err != nil {
+			return nil, err
+		}
+		content.HTML = html.String()
+	}
+
+	return content, nil
+}
+
+// resolve picks the most specific locale available: "pt-BR", then "pt",
+// then the default locale.
+func (r *templateRenderer) resolve(name Template, locale string) (string, bool) {
+	candidates := []string{locale}
+	if language, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, language)
+	}
+	candidates = append(candidates, r.defaultLocale)
+
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		key := string(name) + "." + candidate
+		if _, ok := r.text[key]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,50 @@
+package mail
+
+type InvitationData struct {
+	InviterName    string
+	Link           string
+	UnsubscribeURL string
+}
+
+type ReminderData struct {
+	Name           string
+	Title          string
+	Link           string
+	UnsubscribeURL string
+}
+
+type DigestItem struct {
+	Title string
+	Body  string
+	Link  string
+}
+
+type DigestData struct {
+	Name           string
+	Items          []DigestItem
+	UnsubscribeURL string
+}
+
+type NotificationData struct {
+	Name           string
+	Title          string
+	Body           string
+	Link           string
+	UnsubscribeURL string
+}
+
+type VerifyEmailData struct {
+	Name string
+	Link string
+}
+
+type PasswordResetData struct {
+	Name         string
+	Link         string
+	ValidMinutes int
+}
+
+type MagicLinkData struct {
+	Link         string
+	ValidMinutes int
+}
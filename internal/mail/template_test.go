@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderLocaleFallback(t *testing.T) {
+	renderer, err := NewTemplateRenderer("en")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		locale          string
+		expectedSubject string
+	}{
+		{name: "Exact locale", locale: "pt-BR", expectedSubject: "Lembrete: Weekly review"},
+		{name: "Unknown region falls back to default", locale: "en-GB", expectedSubject: "Reminder: Weekly review"},
+		{name: "Unknown locale falls back to default", locale: "de", expectedSubject: "Reminder: Weekly review"},
+		{name: "Empty locale", locale: "", expectedSubject: "Reminder: Weekly review"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			content, err := renderer.Render(TemplateReminder, tt.locale, ReminderData{
+				Name:  "Jane",
+				Title: "Weekly review",
+				Link:  "https://note.local/n/1",
+			})
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSubject, content.Subject)
+			assert.Contains(t, content.Text, "https://note.local/n/1")
+			assert.Contains(t, content.HTML, `href="https://note.local/n/1"`)
+		})
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	// Arrange
+	renderer, err := NewTemplateRenderer("en")
+	require.NoError(t, err)
+
+	// Act
+	content, err := renderer.Render(TemplateNotification, "en", NotificationData{
+		Name:           "Jane",
+		Title:          "<script>alert(1)</script>",
+		UnsubscribeURL: "https://note.local/mail/unsubscribe?token=abc",
+	})
+
+	// Assert
+	require.NoError(t, err)
+	assert.NotContains(t, content.HTML, "<script>")
+	assert.Contains(t, content.Text, "<script>alert(1)</script>", "Text part is not escaped")
+	assert.Contains(t, content.Text, "Unsubscribe: https://note.local/mail/unsubscribe?token=abc")
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	renderer, err := NewTemplateRenderer("en")
+	require.NoError(t, err)
+
+	_, err = renderer.Render("missing", "en", nil)
+
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+}
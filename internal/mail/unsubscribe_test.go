@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsubscribeTokenRoundTrip(t *testing.T) {
+	// Arrange
+	signer := NewUnsubscribeSigner(jwt.Config{SecretKey: "secret"}, "https://note.local/")
+	userID := uuid.New()
+
+	// Act
+	link, err := url.Parse(signer.URL(userID, "reminder"))
+	require.NoError(t, err)
+	verifiedID, category, err := signer.Verify(link.Query().Get("token"))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "/mail/unsubscribe", link.Path)
+	assert.Equal(t, userID, verifiedID)
+	assert.Equal(t, "reminder", category)
+}
+
+func TestUnsubscribeTokenRejectsTampering(t *testing.T) {
+	signer := NewUnsubscribeSigner(jwt.Config{SecretKey: "secret"}, "https://note.local")
+	otherSigner := NewUnsubscribeSigner(jwt.Config{SecretKey: "other"}, "https://note.local")
+	token := signer.Token(uuid.New(), "reminder")
+	forged := signer.Token(uuid.New(), "digest")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "Signed with another key", token: otherSigner.Token(uuid.New(), "reminder")},
+		{name: "Swapped payload", token: forged[:len(forged)-43] + token[len(token)-43:]},
+		{name: "Missing signature", token: "abc"},
+		{name: "Garbage", token: "abc.def"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := signer.Verify(tt.token)
+			assert.ErrorIs(t, err, ErrInvalidUnsubscribeToken)
+		})
+	}
+}
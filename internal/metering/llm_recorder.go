@@ -0,0 +1,48 @@
+package metering
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/llm"
+)
+
+type contextKey struct{}
+
+type meteredUser struct {
+	userID uuid.UUID
+	plan   Plan
+}
+
+// WithUser marks ctx as doing work on behalf of userID, on plan, so LLM
+// tokens spent under it are metered to that user.
+func WithUser(ctx context.Context, userID uuid.UUID, plan Plan) context.Context {
+	return context.WithValue(ctx, contextKey{}, meteredUser{userID: userID, plan: plan})
+}
+
+func userFrom(ctx context.Context) (meteredUser, bool) {
+	user, ok := ctx.Value(contextKey{}).(meteredUser)
+	return user, ok
+}
+
+type llmUsageRecorder struct {
+	meteringService MeteringService
+}
+
+// NewLLMUsageRecorder counts the tokens of every LLM call made with a
+// context from WithUser against that user's llm_tokens quota.
+func NewLLMUsageRecorder(meteringService MeteringService) llm.UsageRecorder {
+	return &llmUsageRecorder{meteringService: meteringService}
+}
+
+func (r *llmUsageRecorder) Record(ctx context.Context, model string, usage llm.Usage) {
+	user, ok := userFrom(ctx)
+	if !ok || usage.TotalTokens == 0 {
+		return
+	}
+
+	if err := r.meteringService.Record(ctx, user.userID, user.plan, MetricLLMTokens, int64(usage.TotalTokens)); err != nil {
+		log.Printf("Failed to record %d %s tokens for user %s: %v", usage.TotalTokens, model, user.userID, err)
+	}
+}
@@ -0,0 +1,115 @@
+package metering
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Metric string
+
+const (
+	MetricNotesCreated Metric = "notes_created"
+	MetricStorageBytes Metric = "storage_bytes"
+	MetricLLMTokens    Metric = "llm_tokens"
+	MetricAPICalls     Metric = "api_calls"
+)
+
+var Metrics = []Metric{MetricNotesCreated, MetricStorageBytes, MetricLLMTokens, MetricAPICalls}
+
+type Plan string
+
+const (
+	PlanFree    Plan = "free"
+	PlanPremium Plan = "premium"
+)
+
+func PlanFor(isPremium bool) Plan {
+	if isPremium {
+		return PlanPremium
+	}
+	return PlanFree
+}
+
+// Period is the window a counter covers. Lifetime counters never reset,
+// which suits gauges such as storage.
+type Period string
+
+const (
+	PeriodDay      Period = "day"
+	PeriodMonth    Period = "month"
+	PeriodLifetime Period = "lifetime"
+)
+
+func (p Period) Start(now time.Time) time.Time {
+	now = now.UTC()
+	switch p {
+	case PeriodDay:
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	case PeriodMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Unix(0, 0).UTC()
+	}
+}
+
+// ResetsAt returns when the period containing now ends, or nil for
+// lifetime periods.
+func (p Period) ResetsAt(now time.Time) *time.Time {
+	var end time.Time
+	switch p {
+	case PeriodDay:
+		end = p.Start(now).AddDate(0, 0, 1)
+	case PeriodMonth:
+		end = p.Start(now).AddDate(0, 1, 0)
+	default:
+		return nil
+	}
+	return &end
+}
+
+// Unlimited is stored as the limit of metrics a plan doesn't cap.
+const Unlimited int64 = -1
+
+type PlanLimit struct {
+	Plan      Plan   `gorm:"primaryKey"`
+	Metric    Metric `gorm:"primaryKey"`
+	Period    Period
+	Limit     int64
+	UpdatedAt time.Time
+}
+
+func (PlanLimit) TableName() string {
+	return "plan_limits"
+}
+
+func (l *PlanLimit) IsUnlimited() bool {
+	return l.Limit < 0
+}
+
+type UsageCounter struct {
+	UserID      uuid.UUID `gorm:"primaryKey"`
+	Metric      Metric    `gorm:"primaryKey"`
+	PeriodStart time.Time `gorm:"primaryKey"`
+	Value       int64
+	UpdatedAt   time.Time
+}
+
+func (UsageCounter) TableName() string {
+	return "usage_counters"
+}
+
+type QuotaExceededError struct {
+	Plan             Plan
+	Metric           Metric
+	Period           Period
+	Limit            int64
+	Used             int64
+	ResetsAt         *time.Time
+	UpgradeAvailable bool
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: used %d of %d per %s on the %s plan", e.Metric, e.Used, e.Limit, e.Period, e.Plan)
+}
@@ -0,0 +1,46 @@
+package metering
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+type MeteringHandler struct {
+	meteringService MeteringService
+}
+
+func NewMeteringHandler(meteringService MeteringService) *MeteringHandler {
+	return &MeteringHandler{
+		meteringService: meteringService,
+	}
+}
+
+func (h *MeteringHandler) HandleGetUsage(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	plan := PlanFor(middleware.IsPremium(c))
+	usage, err := h.meteringService.Usage(c.Request.Context(), userID, plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := UsageResponse{Plan: plan, Metrics: make([]MetricUsageResponse, 0, len(usage))}
+	for _, metric := range usage {
+		response.Metrics = append(response.Metrics, MetricUsageResponse{
+			Metric:   metric.Metric,
+			Period:   metric.Period,
+			Used:     metric.Used,
+			Limit:    metric.Limit,
+			ResetsAt: metric.ResetsAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,27 @@
+package metering
+
+import "time"
+
+type QuotaExceededResponse struct {
+	Error            string     `json:"error"`
+	Metric           Metric     `json:"metric"`
+	Plan             Plan       `json:"plan"`
+	Period           Period     `json:"period"`
+	Limit            int64      `json:"limit"`
+	Used             int64      `json:"used"`
+	ResetsAt         *time.Time `json:"resetsAt"`
+	UpgradeAvailable bool       `json:"upgradeAvailable"`
+}
+
+type MetricUsageResponse struct {
+	Metric   Metric     `json:"metric"`
+	Period   Period     `json:"period"`
+	Used     int64      `json:"used"`
+	Limit    int64      `json:"limit"`
+	ResetsAt *time.Time `json:"resetsAt"`
+}
+
+type UsageResponse struct {
+	Plan    Plan                  `json:"plan"`
+	Metrics []MetricUsageResponse `json:"metrics"`
+}
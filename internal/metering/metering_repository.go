@@ -0,0 +1,71 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	GetLimits(ctx context.Context) ([]*PlanLimit, error)
+	Increment(ctx context.Context, userID uuid.UUID, metric Metric, periodStart time.Time, amount int64) (int64, error)
+	GetValue(ctx context.Context, userID uuid.UUID, metric Metric, periodStart time.Time) (int64, error)
+}
+
+type meteringRepository struct {
+	db *gorm.DB
+}
+
+func (r *meteringRepository) GetLimits(ctx context.Context) ([]*PlanLimit, error) {
+	var limits []*PlanLimit
+	err := r.db.WithContext(ctx).Find(&limits).Error
+	return limits, err
+}
+
+// Increment adds amount to the counter in a single upsert, so concurrent
+// requests on several replicas never lose updates.
+func (r *meteringRepository) Increment(ctx context.Context, userID uuid.UUID, metric Metric, periodStart time.Time, amount int64) (int64, error) {
+	now := time.Now()
+	counter := &UsageCounter{
+		UserID:      userID,
+		Metric:      metric,
+		PeriodStart: periodStart,
+		Value:       amount,
+		UpdatedAt:   now,
+	}
+
+	err := r.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "metric"}, {Name: "period_start"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"value":      gorm.Expr("usage_counters.value + ?", amount),
+				"updated_at": now,
+			}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "value"}}},
+	).Create(counter).Error
+
+	return counter.Value, err
+}
+
+func (r *meteringRepository) GetValue(ctx context.Context, userID uuid.UUID, metric Metric, periodStart time.Time) (int64, error) {
+	var counter UsageCounter
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND metric = ? AND period_start = ?", userID, metric, periodStart).
+		First(&counter).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return counter.Value, nil
+}
+
+func NewMeteringRepository(db *gorm.DB) Repository {
+	return &meteringRepository{db: db}
+}
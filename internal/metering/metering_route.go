@@ -0,0 +1,7 @@
+package metering
+
+import "github.com/gin-gonic/gin"
+
+func MeteringRoutes(api *gin.RouterGroup, meteringHandler *MeteringHandler) {
+	api.GET("/usage", meteringHandler.HandleGetUsage)
+}
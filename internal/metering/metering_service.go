@@ -0,0 +1,161 @@
+package metering
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// limitsTTL is how long plan limits are cached. Changing a row in
+// plan_limits takes effect within this window, without a redeploy.
+const limitsTTL = time.Minute
+
+type MetricUsage struct {
+	Metric   Metric
+	Period   Period
+	Used     int64
+	Limit    int64
+	ResetsAt *time.Time
+}
+
+type MeteringService interface {
+	// Record counts amount of metric in the period plan limits it by.
+	Record(ctx context.Context, userID uuid.UUID, plan Plan, metric Metric, amount int64) error
+	Check(ctx context.Context, userID uuid.UUID, plan Plan, metric Metric, amount int64) error
+	Usage(ctx context.Context, userID uuid.UUID, plan Plan) ([]MetricUsage, error)
+}
+
+type meteringService struct {
+	repo Repository
+	now  func() time.Time
+
+	mu        sync.Mutex
+	limits    map[Plan]map[Metric]*PlanLimit
+	loadedAt  time.Time
+	limitsTTL time.Duration
+}
+
+func NewMeteringService(repo Repository) MeteringService {
+	return &meteringService{
+		repo:      repo,
+		now:       time.Now,
+		limitsTTL: limitsTTL,
+	}
+}
+
+func (s *meteringService) Record(ctx context.Context, userID uuid.UUID, plan Plan, metric Metric, amount int64) error {
+	limit, err := s.limitFor(ctx, plan, metric)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.Increment(ctx, userID, metric, periodOf(limit).Start(s.now()), amount)
+	return err
+}
+
+func (s *meteringService) Check(ctx context.Context, userID uuid.UUID, plan Plan, metric Metric, amount int64) error {
+	limit, err := s.limitFor(ctx, plan, metric)
+	if err != nil {
+		return err
+	}
+	if limit == nil || limit.IsUnlimited() {
+		return nil
+	}
+
+	now := s.now()
+	used, err := s.repo.GetValue(ctx, userID, metric, limit.Period.Start(now))
+	if err != nil {
+		return err
+	}
+	if used+amount <= limit.Limit {
+		return nil
+	}
+
+	upgradeAvailable := false
+	if plan == PlanFree {
+		premium, err := s.limitFor(ctx, PlanPremium, metric)
+		if err != nil {
+			return err
+		}
+		upgradeAvailable = premium == nil || premium.IsUnlimited() || premium.Limit > limit.Limit
+	}
+
+	return &QuotaExceededError{
+		Plan:             plan,
+		Metric:           metric,
+		Period:           limit.Period,
+		Limit:            limit.Limit,
+		Used:             used,
+		ResetsAt:         limit.Period.ResetsAt(now),
+		UpgradeAvailable: upgradeAvailable,
+	}
+}
+
+func (s *meteringService) Usage(ctx context.Context, userID uuid.UUID, plan Plan) ([]MetricUsage, error) {
+	now := s.now()
+	usage := make([]MetricUsage, 0, len(Metrics))
+
+	for _, metric := range Metrics {
+		limit, err := s.limitFor(ctx, plan, metric)
+		if err != nil {
+			return nil, err
+		}
+
+		period := periodOf(limit)
+		used, err := s.repo.GetValue(ctx, userID, metric, period.Start(now))
+		if err != nil {
+			return nil, err
+		}
+
+		value := Unlimited
+		if limit != nil {
+			value = limit.Limit
+		}
+
+		usage = append(usage, MetricUsage{
+			Metric:   metric,
+			Period:   period,
+			Used:     used,
+			Limit:    value,
+			ResetsAt: period.ResetsAt(now),
+		})
+	}
+
+	return usage, nil
+}
+
+// limitFor returns the limit of metric on plan, or nil when the plan
+// doesn't define one.
+func (s *meteringService) limitFor(ctx context.Context, plan Plan, metric Metric) (*PlanLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limits == nil || s.now().Sub(s.loadedAt) > s.limitsTTL {
+		limits, err := s.repo.GetLimits(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		s.limits = make(map[Plan]map[Metric]*PlanLimit)
+		for _, limit := range limits {
+			if s.limits[limit.Plan] == nil {
+				s.limits[limit.Plan] = make(map[Metric]*PlanLimit)
+			}
+			s.limits[limit.Plan][limit.Metric] = limit
+		}
+		s.loadedAt = s.now()
+	}
+
+	return s.limits[plan][metric], nil
+}
+
+// periodOf is the period counters of a metric are kept in under a plan's
+// limit. Without a limit the usage is tracked monthly.
+func periodOf(limit *PlanLimit) Period {
+	if limit == nil || limit.Period == "" {
+		return PeriodMonth
+	}
+	return limit.Period
+}
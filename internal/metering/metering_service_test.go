@@ -0,0 +1,252 @@
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/llm"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type counterKey struct {
+	userID      uuid.UUID
+	metric      Metric
+	periodStart time.Time
+}
+
+type mockRepository struct {
+	limits    []*PlanLimit
+	counters  map[counterKey]int64
+	loadCount int
+}
+
+func newMockRepository(limits ...*PlanLimit) *mockRepository {
+	return &mockRepository{limits: limits, counters: make(map[counterKey]int64)}
+}
+
+func (m *mockRepository) GetLimits(_ context.Context) ([]*PlanLimit, error) {
+	m.loadCount++
+	return m.limits, nil
+}
+
+func (m *mockRepository) Increment(_ context.Context, userID uuid.UUID, metric Metric, periodStart time.Time, amount int64) (int64, error) {
+	key := counterKey{userID, metric, periodStart}
+	m.counters[key] += amount
+	return m.counters[key], nil
+}
+
+func (m *mockRepository) GetValue(_ context.Context, userID uuid.UUID, metric Metric, periodStart time.Time) (int64, error) {
+	return m.counters[counterKey{userID, metric, periodStart}], nil
+}
+
+func defaultLimits() []*PlanLimit {
+	return []*PlanLimit{
+		{Plan: PlanFree, Metric: MetricAPICalls, Period: PeriodDay, Limit: 2},
+		{Plan: PlanPremium, Metric: MetricAPICalls, Period: PeriodDay, Limit: 2},
+		{Plan: PlanFree, Metric: MetricLLMTokens, Period: PeriodMonth, Limit: 100},
+		{Plan: PlanPremium, Metric: MetricLLMTokens, Period: PeriodMonth, Limit: Unlimited},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	// Arrange
+	repo := newMockRepository(defaultLimits()...)
+	service := NewMeteringService(repo)
+	ctx := context.Background()
+	userID := uuid.New()
+	require.NoError(t, service.Record(ctx, userID, PlanFree, MetricLLMTokens, 90))
+
+	// Act
+	withinQuota := service.Check(ctx, userID, PlanFree, MetricLLMTokens, 10)
+	overQuota := service.Check(ctx, userID, PlanFree, MetricLLMTokens, 11)
+	premium := service.Check(ctx, userID, PlanPremium, MetricLLMTokens, 1000)
+	noLimit := service.Check(ctx, userID, PlanFree, MetricNotesCreated, 1)
+
+	// Assert
+	assert.NoError(t, withinQuota)
+	assert.NoError(t, premium)
+	assert.NoError(t, noLimit)
+
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, overQuota, &quotaErr)
+	assert.Equal(t, int64(90), quotaErr.Used)
+	assert.Equal(t, int64(100), quotaErr.Limit)
+	assert.True(t, quotaErr.UpgradeAvailable)
+	assert.NotNil(t, quotaErr.ResetsAt)
+}
+
+func TestRecordUsesThePlanPeriod(t *testing.T) {
+	// Arrange
+	repo := newMockRepository(
+		&PlanLimit{Plan: PlanFree, Metric: MetricNotesCreated, Period: PeriodMonth, Limit: 100},
+		&PlanLimit{Plan: PlanPremium, Metric: MetricNotesCreated, Period: PeriodDay, Limit: 1},
+	)
+	service := NewMeteringService(repo)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	// Act
+	require.NoError(t, service.Record(ctx, userID, PlanPremium, MetricNotesCreated, 1))
+	err := service.Check(ctx, userID, PlanPremium, MetricNotesCreated, 1)
+
+	// Assert
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr, "Premium usage must land in the premium period")
+	assert.Equal(t, int64(1), quotaErr.Used)
+	assert.Equal(t, PeriodDay, quotaErr.Period)
+}
+
+func TestLimitsAreCached(t *testing.T) {
+	// Arrange
+	repo := newMockRepository(defaultLimits()...)
+	service := NewMeteringService(repo).(*meteringService)
+	now := time.Now()
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Act
+	_ = service.Check(ctx, uuid.New(), PlanFree, MetricAPICalls, 1)
+	_ = service.Check(ctx, uuid.New(), PlanFree, MetricAPICalls, 1)
+	now = now.Add(2 * limitsTTL)
+	_ = service.Check(ctx, uuid.New(), PlanFree, MetricAPICalls, 1)
+
+	// Assert
+	assert.Equal(t, 2, repo.loadCount)
+}
+
+func TestUsage(t *testing.T) {
+	// Arrange
+	repo := newMockRepository(defaultLimits()...)
+	service := NewMeteringService(repo)
+	ctx := context.Background()
+	userID := uuid.New()
+	require.NoError(t, service.Record(ctx, userID, PlanPremium, MetricAPICalls, 1))
+
+	// Act
+	usage, err := service.Usage(ctx, userID, PlanPremium)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, usage, len(Metrics))
+	byMetric := make(map[Metric]MetricUsage)
+	for _, metric := range usage {
+		byMetric[metric.Metric] = metric
+	}
+	assert.Equal(t, int64(1), byMetric[MetricAPICalls].Used)
+	assert.Equal(t, PeriodDay, byMetric[MetricAPICalls].Period)
+	assert.Equal(t, Unlimited, byMetric[MetricLLMTokens].Limit)
+	assert.Equal(t, Unlimited, byMetric[MetricStorageBytes].Limit, "Metrics without a limit are unlimited")
+}
+
+func TestEnforce(t *testing.T) {
+	tests := []struct {
+		name           string
+		isPremium      bool
+		expectedStatus int
+	}{
+		{name: "Free user can upgrade", isPremium: false, expectedStatus: http.StatusPaymentRequired},
+		{name: "Premium user is rate limited", isPremium: true, expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			limits := defaultLimits()
+			if !tt.isPremium {
+				limits[1].Limit = 10
+			}
+			service := NewMeteringService(newMockRepository(limits...))
+			userID := uuid.New()
+
+			claims := &jwt.Claims{UserID: userID}
+			if tt.isPremium {
+				premiumUntil := time.Now().Add(time.Hour)
+				claims.IsPremium = true
+				claims.PremiumUntil = &premiumUntil
+			}
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("userID", userID)
+				middleware.SetClaims(c, claims)
+			})
+			router.Use(NewQuotaMiddleware(service).Enforce(MetricAPICalls))
+			router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+			// Act
+			var statuses []int
+			var last *httptest.ResponseRecorder
+			for i := 0; i < 3; i++ {
+				last = httptest.NewRecorder()
+				router.ServeHTTP(last, httptest.NewRequest(http.MethodGet, "/ping", nil))
+				statuses = append(statuses, last.Code)
+			}
+
+			// Assert
+			assert.Equal(t, []int{http.StatusOK, http.StatusOK, tt.expectedStatus}, statuses)
+
+			var body QuotaExceededResponse
+			require.NoError(t, json.Unmarshal(last.Body.Bytes(), &body))
+			assert.Equal(t, MetricAPICalls, body.Metric)
+			assert.Equal(t, int64(2), body.Used)
+			assert.Equal(t, int64(2), body.Limit)
+			if tt.expectedStatus == http.StatusTooManyRequests {
+				assert.NotEmpty(t, last.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestEnforceDoesNotCountFailedRequests(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository(defaultLimits()...)
+	service := NewMeteringService(repo)
+	userID := uuid.New()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userID", userID) })
+	router.Use(NewQuotaMiddleware(service).Enforce(MetricAPICalls))
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+
+	// Act
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	// Assert
+	usage, err := service.Usage(context.Background(), userID, PlanFree)
+	require.NoError(t, err)
+	for _, metric := range usage {
+		assert.Zero(t, metric.Used)
+	}
+}
+
+func TestLLMUsageRecorder(t *testing.T) {
+	// Arrange
+	repo := newMockRepository(defaultLimits()...)
+	service := NewMeteringService(repo)
+	recorder := NewLLMUsageRecorder(service)
+	userID := uuid.New()
+
+	// Act
+	recorder.Record(WithUser(context.Background(), userID, PlanFree), "gemini", llm.Usage{TotalTokens: 42})
+	recorder.Record(context.Background(), "gemini", llm.Usage{TotalTokens: 1000})
+
+	// Assert
+	usage, err := service.Usage(context.Background(), userID, PlanFree)
+	require.NoError(t, err)
+	for _, metric := range usage {
+		if metric.Metric == MetricLLMTokens {
+			assert.Equal(t, int64(42), metric.Used)
+		}
+	}
+}
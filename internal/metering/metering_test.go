@@ -0,0 +1,61 @@
+package metering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodStartAndReset(t *testing.T) {
+	now := time.Date(2025, time.March, 31, 22, 15, 0, 0, time.FixedZone("BRT", -3*3600))
+
+	tests := []struct {
+		name          string
+		period        Period
+		expectedStart time.Time
+		expectedReset *time.Time
+	}{
+		{
+			name:          "Day uses UTC",
+			period:        PeriodDay,
+			expectedStart: time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC),
+			expectedReset: timePtr(time.Date(2025, time.April, 2, 0, 0, 0, 0, time.UTC)),
+		},
+		{
+			name:          "Month",
+			period:        PeriodMonth,
+			expectedStart: time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC),
+			expectedReset: timePtr(time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		{
+			name:          "Lifetime never resets",
+			period:        PeriodLifetime,
+			expectedStart: time.Unix(0, 0).UTC(),
+			expectedReset: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedStart, tt.period.Start(now))
+			reset := tt.period.ResetsAt(now)
+			if tt.expectedReset == nil {
+				assert.Nil(t, reset)
+				return
+			}
+			require.NotNil(t, reset)
+			assert.Equal(t, *tt.expectedReset, *reset)
+		})
+	}
+}
+
+func TestPlanFor(t *testing.T) {
+	assert.Equal(t, PlanPremium, PlanFor(true))
+	assert.Equal(t, PlanFree, PlanFor(false))
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
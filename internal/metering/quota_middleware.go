@@ -0,0 +1,79 @@
+package metering
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+type QuotaMiddleware interface {
+	Enforce(metric Metric) gin.HandlerFunc
+}
+
+type quotaMiddleware struct {
+	meteringService MeteringService
+}
+
+func NewQuotaMiddleware(meteringService MeteringService) QuotaMiddleware {
+	return &quotaMiddleware{meteringService: meteringService}
+}
+
+// Enforce rejects the request when the user has used up metric, and counts
+// one unit of it when the handler succeeds. Quotas that premium would lift
+// answer 402 Payment Required, the rest 429 Too Many Requests.
+func (m *quotaMiddleware) Enforce(metric Metric) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// API keys count towards the quota before RequireScope runs.
+		userID, ok := middleware.GetCallerID(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		plan := PlanFor(middleware.IsPremium(c))
+		err := m.meteringService.Check(c.Request.Context(), userID, plan, metric, 1)
+		if err != nil {
+			var quotaErr *QuotaExceededError
+			if errors.As(err, &quotaErr) {
+				abortWithQuotaExceeded(c, quotaErr)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() < http.StatusBadRequest {
+			if err := m.meteringService.Record(c.Request.Context(), userID, plan, metric, 1); err != nil {
+				_ = c.Error(err)
+			}
+		}
+	}
+}
+
+func abortWithQuotaExceeded(c *gin.Context, err *QuotaExceededError) {
+	status := http.StatusTooManyRequests
+	if err.UpgradeAvailable {
+		status = http.StatusPaymentRequired
+	}
+	if status == http.StatusTooManyRequests && err.ResetsAt != nil {
+		retryAfter := int(time.Until(*err.ResetsAt).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	c.AbortWithStatusJSON(status, QuotaExceededResponse{
+		Error:            "Quota exceeded",
+		Metric:           err.Metric,
+		Plan:             err.Plan,
+		Period:           err.Period,
+		Limit:            err.Limit,
+		Used:             err.Used,
+		ResetsAt:         err.ResetsAt,
+		UpgradeAvailable: err.UpgradeAvailable,
+	})
+}
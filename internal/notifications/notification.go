@@ -0,0 +1,139 @@
+package notifications
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Type string
+
+const (
+	TypeShare    Type = "share"
+	TypeComment  Type = "comment"
+	TypeMention  Type = "mention"
+	TypeReminder Type = "reminder"
+	TypeSystem   Type = "system"
+)
+
+var Types = []Type{TypeShare, TypeComment, TypeMention, TypeReminder, TypeSystem}
+
+func (t Type) IsValid() bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+type Channel string
+
+const (
+	ChannelInApp Channel = "in_app"
+	ChannelEmail Channel = "email"
+	ChannelOff   Channel = "off"
+)
+
+func (c Channel) IsValid() bool {
+	return c == ChannelInApp || c == ChannelEmail || c == ChannelOff
+}
+
+var (
+	ErrNotFound       = errors.New("notification not found")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrInvalidType    = errors.New("invalid notification type")
+	ErrInvalidChannel = errors.New("invalid notification channel")
+)
+
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Type      Type
+	Title     string
+	Body      string
+	Link      string
+	ReadAt    *time.Time
+	CreatedAt time.Time
+}
+
+func NewNotification(userID uuid.UUID, notificationType Type, title, body, link string) *Notification {
+	return &Notification{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Type:      notificationType,
+		Title:     title,
+		Body:      body,
+		Link:      link,
+		ReadAt:    nil,
+		CreatedAt: time.Now(),
+	}
+}
+
+func (n *Notification) IsRead() bool {
+	return n.ReadAt != nil
+}
+
+func (n *Notification) MarkRead() {
+	if n.ReadAt != nil {
+		return
+	}
+	now := time.Now()
+	n.ReadAt = &now
+}
+
+type Preference struct {
+	UserID    uuid.UUID `gorm:"primaryKey"`
+	Type      Type      `gorm:"primaryKey"`
+	Channel   Channel
+	UpdatedAt time.Time
+}
+
+func (Preference) TableName() string {
+	return "notification_preferences"
+}
+
+// Cursor points at the last notification of a page. Pages are ordered by
+// creation time and then ID, both descending.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func CursorFor(n *Notification) Cursor {
+	return Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+}
+
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%s", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: time.Unix(0, unixNano), ID: parsedID}, nil
+}
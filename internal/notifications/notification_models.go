@@ -0,0 +1,39 @@
+package notifications
+
+import "time"
+
+type NotificationResponse struct {
+	ID        string     `json:"id"`
+	Type      Type       `json:"type"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Link      string     `json:"link,omitempty"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type NotificationListResponse struct {
+	Items       []NotificationResponse `json:"items"`
+	UnreadCount int64                  `json:"unreadCount"`
+	NextCursor  string                 `json:"nextCursor,omitempty"`
+}
+
+type PreferencesRequest struct {
+	Preferences map[Type]Channel `json:"preferences" binding:"required"`
+}
+
+type PreferencesResponse struct {
+	Preferences map[Type]Channel `json:"preferences"`
+}
+
+func newNotificationResponse(n *Notification) NotificationResponse {
+	return NotificationResponse{
+		ID:        n.ID.String(),
+		Type:      n.Type,
+		Title:     n.Title,
+		Body:      n.Body,
+		Link:      n.Link,
+		ReadAt:    n.ReadAt,
+		CreatedAt: n.CreatedAt,
+	}
+}
@@ -0,0 +1,71 @@
+package notifications
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Add(ctx context.Context, notification *Notification) error
+	ListByUser(ctx context.Context, userID uuid.UUID, after *Cursor, limit int) ([]*Notification, error)
+	CountUnread(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkRead(ctx context.Context, userID, id uuid.UUID, readAt time.Time) (bool, error)
+	MarkAllRead(ctx context.Context, userID uuid.UUID, readAt time.Time) error
+	GetPreferences(ctx context.Context, userID uuid.UUID) ([]*Preference, error)
+	SavePreference(ctx context.Context, preference *Preference) error
+}
+
+type notificationRepository struct {
+	db *gorm.DB
+}
+
+func (r *notificationRepository) Add(ctx context.Context, notification *Notification) error {
+	return r.db.WithContext(ctx).Create(notification).Error
+}
+
+func (r *notificationRepository) ListByUser(ctx context.Context, userID uuid.UUID, after *Cursor, limit int) ([]*Notification, error) {
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	if after != nil {
+		query = query.Where("(created_at < ?) OR (created_at = ? AND id < ?)", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	var notifications []*Notification
+	err := query.Order("created_at DESC").Order("id DESC").Limit(limit).Find(&notifications).Error
+	return notifications, err
+}
+
+func (r *notificationRepository) CountUnread(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *notificationRepository) MarkRead(ctx context.Context, userID, id uuid.UUID, readAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&Notification{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", readAt))
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *notificationRepository) MarkAllRead(ctx context.Context, userID uuid.UUID, readAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", readAt).Error
+}
+
+func (r *notificationRepository) GetPreferences(ctx context.Context, userID uuid.UUID) ([]*Preference, error) {
+	var preferences []*Preference
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&preferences).Error
+	return preferences, err
+}
+
+func (r *notificationRepository) SavePreference(ctx context.Context, preference *Preference) error {
+	return r.db.WithContext(ctx).Save(preference).Error
+}
+
+func NewNotificationRepository(db *gorm.DB) Repository {
+	return &notificationRepository{db: db}
+}
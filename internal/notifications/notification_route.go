@@ -0,0 +1,16 @@
+package notifications
+
+import "github.com/gin-gonic/gin"
+
+func NotificationRoutes(api *gin.RouterGroup, notificationHandler *NotificationHandler) {
+
+	notifications := api.Group("/notifications")
+	{
+		notifications.GET("", notificationHandler.HandleList)
+		notifications.GET("/unread-count", notificationHandler.HandleUnreadCount)
+		notifications.POST("/read-all", notificationHandler.HandleMarkAllRead)
+		notifications.POST("/:id/read", notificationHandler.HandleMarkRead)
+		notifications.GET("/preferences", notificationHandler.HandleGetPreferences)
+		notifications.PUT("/preferences", notificationHandler.HandleUpdatePreferences)
+	}
+}
@@ -0,0 +1,202 @@
+package notifications
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Message is what producers hand to Notify. Producers don't pick the
+// delivery channel; that is decided by the recipient's preferences.
+type Message struct {
+	Type  Type
+	Title string
+	Body  string
+	Link  string
+}
+
+type Producer interface {
+	Notify(ctx context.Context, userID uuid.UUID, message Message) error
+}
+
+// Deliverer sends a notification outside the app, e.g. by email.
+type Deliverer interface {
+	Deliver(ctx context.Context, notification *Notification) error
+}
+
+type Page struct {
+	Items       []*Notification
+	NextCursor  string
+	UnreadCount int64
+}
+
+type NotificationService interface {
+	Producer
+	List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*Page, error)
+	UnreadCount(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkRead(ctx context.Context, userID, id uuid.UUID) error
+	MarkAllRead(ctx context.Context, userID uuid.UUID) error
+	Preferences(ctx context.Context, userID uuid.UUID) (map[Type]Channel, error)
+	SetPreference(ctx context.Context, userID uuid.UUID, notificationType Type, channel Channel) error
+	Unsubscribe(ctx context.Context, userID uuid.UUID, category string) error
+}
+
+type notificationService struct {
+	repo  Repository
+	email Deliverer
+}
+
+func NewNotificationService(repo Repository, email Deliverer) NotificationService {
+	return &notificationService{
+		repo:  repo,
+		email: email,
+	}
+}
+
+func (s *notificationService) Notify(ctx context.Context, userID uuid.UUID, message Message) error {
+	if !message.Type.IsValid() {
+		return ErrInvalidType
+	}
+
+	channel, err := s.channelFor(ctx, userID, message.Type)
+	if err != nil {
+		return err
+	}
+
+	notification := NewNotification(userID, message.Type, message.Title, message.Body, message.Link)
+
+	switch channel {
+	case ChannelOff:
+		return nil
+	case ChannelEmail:
+		if s.email != nil {
+			return s.email.Deliver(ctx, notification)
+		}
+		log.Printf("No email deliverer configured, storing %s notification for user %s in-app", message.Type, userID)
+	}
+
+	return s.repo.Add(ctx, notification)
+}
+
+func (s *notificationService) List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*Page, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	var after *Cursor
+	if cursor != "" {
+		decoded, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = decoded
+	}
+
+	// Fetch one extra row to know whether there is a next page.
+	items, err := s.repo.ListByUser(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	unread, err := s.repo.CountUnread(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Items: items, UnreadCount: unread}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = CursorFor(page.Items[limit-1]).Encode()
+	}
+
+	return page, nil
+}
+
+func (s *notificationService) UnreadCount(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.repo.CountUnread(ctx, userID)
+}
+
+func (s *notificationService) MarkRead(ctx context.Context, userID, id uuid.UUID) error {
+	found, err := s.repo.MarkRead(ctx, userID, id, time.Now())
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *notificationService) MarkAllRead(ctx context.Context, userID uuid.UUID) error {
+	return s.repo.MarkAllRead(ctx, userID, time.Now())
+}
+
+func (s *notificationService) Preferences(ctx context.Context, userID uuid.UUID) (map[Type]Channel, error) {
+	stored, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences := make(map[Type]Channel, len(Types))
+	for _, notificationType := range Types {
+		preferences[notificationType] = ChannelInApp
+	}
+	for _, preference := range stored {
+		preferences[preference.Type] = preference.Channel
+	}
+
+	return preferences, nil
+}
+
+func (s *notificationService) SetPreference(ctx context.Context, userID uuid.UUID, notificationType Type, channel Channel) error {
+	if !notificationType.IsValid() {
+		return ErrInvalidType
+	}
+	if !channel.IsValid() {
+		return ErrInvalidChannel
+	}
+
+	return s.repo.SavePreference(ctx, &Preference{
+		UserID:    userID,
+		Type:      notificationType,
+		Channel:   channel,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// Unsubscribe moves a notification type that is delivered by email back to
+// in-app only. It is safe to call repeatedly.
+func (s *notificationService) Unsubscribe(ctx context.Context, userID uuid.UUID, category string) error {
+	notificationType := Type(category)
+	if !notificationType.IsValid() {
+		return ErrInvalidType
+	}
+
+	channel, err := s.channelFor(ctx, userID, notificationType)
+	if err != nil {
+		return err
+	}
+	if channel != ChannelEmail {
+		return nil
+	}
+
+	return s.SetPreference(ctx, userID, notificationType, ChannelInApp)
+}
+
+func (s *notificationService) channelFor(ctx context.Context, userID uuid.UUID, notificationType Type) (Channel, error) {
+	preferences, err := s.Preferences(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return preferences[notificationType], nil
+}
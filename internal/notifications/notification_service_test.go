@@ -0,0 +1,247 @@
+package notifications
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRepository keeps notifications and preferences in memory
+type mockRepository struct {
+	notifications []*Notification
+	preferences   map[uuid.UUID]map[Type]*Preference
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{preferences: make(map[uuid.UUID]map[Type]*Preference)}
+}
+
+func (m *mockRepository) Add(_ context.Context, notification *Notification) error {
+	m.notifications = append(m.notifications, notification)
+	return nil
+}
+
+func (m *mockRepository) ListByUser(_ context.Context, userID uuid.UUID, after *Cursor, limit int) ([]*Notification, error) {
+	var result []*Notification
+	for _, n := range m.notifications {
+		if n.UserID != userID {
+			continue
+		}
+		if after != nil && !(n.CreatedAt.Before(after.CreatedAt) ||
+			(n.CreatedAt.Equal(after.CreatedAt) && n.ID.String() < after.ID.String())) {
+			continue
+		}
+		result = append(result, n)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.After(result[j].CreatedAt)
+		}
+		return result[i].ID.String() > result[j].ID.String()
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (m *mockRepository) CountUnread(_ context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	for _, n := range m.notifications {
+		if n.UserID == userID && !n.IsRead() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockRepository) MarkRead(_ context.Context, userID, id uuid.UUID, _ time.Time) (bool, error) {
+	for _, n := range m.notifications {
+		if n.ID == id && n.UserID == userID {
+			n.MarkRead()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) MarkAllRead(_ context.Context, userID uuid.UUID, _ time.Time) error {
+	for _, n := range m.notifications {
+		if n.UserID == userID {
+			n.MarkRead()
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) GetPreferences(_ context.Context, userID uuid.UUID) ([]*Preference, error) {
+	var result []*Preference
+	for _, p := range m.preferences[userID] {
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func (m *mockRepository) SavePreference(_ context.Context, preference *Preference) error {
+	if m.preferences[preference.UserID] == nil {
+		m.preferences[preference.UserID] = make(map[Type]*Preference)
+	}
+	m.preferences[preference.UserID][preference.Type] = preference
+	return nil
+}
+
+type recordingDeliverer struct {
+	delivered []*Notification
+}
+
+func (d *recordingDeliverer) Deliver(_ context.Context, notification *Notification) error {
+	d.delivered = append(d.delivered, notification)
+	return nil
+}
+
+func TestNotifyRespectsPreferences(t *testing.T) {
+	tests := []struct {
+		name              string
+		channel           Channel
+		expectedStored    int
+		expectedDelivered int
+	}{
+		{name: "Default in-app", channel: "", expectedStored: 1, expectedDelivered: 0},
+		{name: "Email", channel: ChannelEmail, expectedStored: 0, expectedDelivered: 1},
+		{name: "Off", channel: ChannelOff, expectedStored: 0, expectedDelivered: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			repo := newMockRepository()
+			email := &recordingDeliverer{}
+			service := NewNotificationService(repo, email)
+			ctx := context.Background()
+			userID := uuid.New()
+			if tt.channel != "" {
+				require.NoError(t, service.SetPreference(ctx, userID, TypeMention, tt.channel))
+			}
+
+			// Act
+			err := service.Notify(ctx, userID, Message{Type: TypeMention, Title: "You were mentioned"})
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Len(t, repo.notifications, tt.expectedStored)
+			assert.Len(t, email.delivered, tt.expectedDelivered)
+		})
+	}
+}
+
+func TestNotifyEmailWithoutDelivererFallsBackToInApp(t *testing.T) {
+	// Arrange
+	repo := newMockRepository()
+	service := NewNotificationService(repo, nil)
+	ctx := context.Background()
+	userID := uuid.New()
+	require.NoError(t, service.SetPreference(ctx, userID, TypeReminder, ChannelEmail))
+
+	// Act
+	err := service.Notify(ctx, userID, Message{Type: TypeReminder, Title: "Reminder"})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, repo.notifications, 1)
+}
+
+func TestNotifyRejectsUnknownType(t *testing.T) {
+	service := NewNotificationService(newMockRepository(), nil)
+
+	err := service.Notify(context.Background(), uuid.New(), Message{Type: "unknown"})
+
+	assert.ErrorIs(t, err, ErrInvalidType)
+}
+
+func TestListPaginates(t *testing.T) {
+	// Arrange
+	repo := newMockRepository()
+	service := NewNotificationService(repo, nil)
+	ctx := context.Background()
+	userID := uuid.New()
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		n := NewNotification(userID, TypeSystem, "n", "", "")
+		n.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		require.NoError(t, repo.Add(ctx, n))
+	}
+	require.NoError(t, repo.Add(ctx, NewNotification(uuid.New(), TypeSystem, "other user", "", "")))
+
+	// Act
+	first, err := service.List(ctx, userID, "", 3)
+	require.NoError(t, err)
+	second, err := service.List(ctx, userID, first.NextCursor, 3)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Len(t, first.Items, 3)
+	assert.NotEmpty(t, first.NextCursor)
+	assert.Equal(t, int64(5), first.UnreadCount)
+	assert.Len(t, second.Items, 2)
+	assert.Empty(t, second.NextCursor)
+	assert.True(t, first.Items[2].CreatedAt.After(second.Items[0].CreatedAt))
+}
+
+func TestMarkReadNotFound(t *testing.T) {
+	// Arrange
+	repo := newMockRepository()
+	service := NewNotificationService(repo, nil)
+	ctx := context.Background()
+	n := NewNotification(uuid.New(), TypeSystem, "n", "", "")
+	require.NoError(t, repo.Add(ctx, n))
+
+	// Act
+	err := service.MarkRead(ctx, uuid.New(), n.ID)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrNotFound, "Users cannot mark notifications of other users")
+	assert.False(t, n.IsRead())
+}
+
+func TestPreferencesDefaultToInApp(t *testing.T) {
+	// Arrange
+	service := NewNotificationService(newMockRepository(), nil)
+	ctx := context.Background()
+	userID := uuid.New()
+	require.NoError(t, service.SetPreference(ctx, userID, TypeShare, ChannelOff))
+
+	// Act
+	preferences, err := service.Preferences(ctx, userID)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Len(t, preferences, len(Types))
+	assert.Equal(t, ChannelOff, preferences[TypeShare])
+	assert.Equal(t, ChannelInApp, preferences[TypeComment])
+}
+
+func TestUnsubscribeMovesEmailToInApp(t *testing.T) {
+	// Arrange
+	service := NewNotificationService(newMockRepository(), nil)
+	ctx := context.Background()
+	userID := uuid.New()
+	require.NoError(t, service.SetPreference(ctx, userID, TypeReminder, ChannelEmail))
+	require.NoError(t, service.SetPreference(ctx, userID, TypeShare, ChannelOff))
+
+	// Act
+	err := service.Unsubscribe(ctx, userID, string(TypeReminder))
+	require.NoError(t, err)
+	err = service.Unsubscribe(ctx, userID, string(TypeShare))
+	require.NoError(t, err)
+
+	// Assert
+	preferences, err := service.Preferences(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, ChannelInApp, preferences[TypeReminder])
+	assert.Equal(t, ChannelOff, preferences[TypeShare], "Unsubscribe should not re-enable a disabled type")
+}
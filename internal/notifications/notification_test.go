@@ -0,0 +1,70 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNotification(t *testing.T) {
+	// Arrange
+	userID := uuid.New()
+
+	// Act
+	notification := NewNotification(userID, TypeShare, "Shared", "A note was shared", "/notes/1")
+
+	// Assert
+	assert.NotEqual(t, uuid.Nil, notification.ID)
+	assert.Equal(t, userID, notification.UserID)
+	assert.Equal(t, TypeShare, notification.Type)
+	assert.NotZero(t, notification.CreatedAt)
+	assert.False(t, notification.IsRead())
+}
+
+func TestMarkRead(t *testing.T) {
+	// Arrange
+	notification := NewNotification(uuid.New(), TypeComment, "Comment", "", "")
+
+	// Act
+	notification.MarkRead()
+	firstReadAt := *notification.ReadAt
+	notification.MarkRead()
+
+	// Assert
+	assert.True(t, notification.IsRead())
+	assert.Equal(t, firstReadAt, *notification.ReadAt, "ReadAt should not change once set")
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	// Arrange
+	cursor := Cursor{CreatedAt: time.Now(), ID: uuid.New()}
+
+	// Act
+	decoded, err := DecodeCursor(cursor.Encode())
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.ID, decoded.ID)
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "Not base64", value: "%%%"},
+		{name: "Missing separator", value: "MTIz"},
+		{name: "Invalid timestamp", value: "YWJjOjEyMw"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeCursor(tt.value)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
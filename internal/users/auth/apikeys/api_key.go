@@ -0,0 +1,75 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+const (
+	// secretSize random bytes make up a key, after its prefix.
+	secretSize = 24
+	// displayPrefixLength characters of a key are stored as they are, so
+	// users can tell their keys apart.
+	displayPrefixLength = len(middleware.APIKeyPrefix) + 8
+)
+
+// APIKey is a personal API key. Only a hash of the key is stored; the
+// key itself is shown once, when it's created.
+type APIKey struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID uuid.UUID
+	Name   string
+	// Prefix is the start of the key, like "nk_1a2b3c4d".
+	Prefix  string
+	KeyHash string
+	// Scopes are stored space-separated, as in OAuth.
+	Scopes     string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// newAPIKey returns a key to show the user once, and its record.
+func newAPIKey(userID uuid.UUID, name string, scopes []users.Scope, expiresAt *time.Time) (string, *APIKey, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	key := middleware.APIKeyPrefix + hex.EncodeToString(secret)
+
+	return key, &APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:displayPrefixLength],
+		KeyHash:   hashKey(key),
+		Scopes:    users.FormatScopes(scopes),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (k *APIKey) ScopeList() []users.Scope {
+	return users.ParseScopes(k.Scopes)
+}
+
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(now)
+}
+
+// hashKey hashes a key for lookup. Keys are random, so a fast hash is
+// enough.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
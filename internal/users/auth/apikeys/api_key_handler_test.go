@@ -0,0 +1,230 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepository struct {
+	keys map[uuid.UUID]*APIKey
+}
+
+func (m *mockRepository) Add(_ context.Context, key *APIKey) error {
+	m.keys[key.ID] = key
+	return nil
+}
+
+func (m *mockRepository) GetByHash(_ context.Context, keyHash string) (*APIKey, error) {
+	for _, key := range m.keys {
+		if key.KeyHash == keyHash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRepository) ListByUser(_ context.Context, userID uuid.UUID) ([]*APIKey, error) {
+	var keys []*APIKey
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockRepository) CountByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	keys, _ := m.ListByUser(ctx, userID)
+	return int64(len(keys)), nil
+}
+
+func (m *mockRepository) Delete(_ context.Context, userID, id uuid.UUID) (bool, error) {
+	key := m.keys[id]
+	if key == nil || key.UserID != userID {
+		return false, nil
+	}
+	delete(m.keys, id)
+	return true, nil
+}
+
+func (m *mockRepository) MarkUsed(_ context.Context, id uuid.UUID, now time.Time) error {
+	if key := m.keys[id]; key != nil {
+		key.LastUsedAt = &now
+	}
+	return nil
+}
+
+type keyTest struct {
+	router    *gin.Engine
+	service   APIKeyService
+	repo      *mockRepository
+	jwtConfig jwt.Config
+	user      *users.User
+}
+
+func setupKeys(t *testing.T) *keyTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	repo := &mockRepository{keys: make(map[uuid.UUID]*APIKey)}
+	service := NewAPIKeyService(repo, userstest.NewUserRepository(user))
+	jwtConfig := jwt.Config{SecretKey: "secret", ExpiresInHours: 1}
+
+	ok := func(c *gin.Context) {
+		userID, ok := middleware.GetUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"userId": userID})
+	}
+	router := gin.New()
+	api := router.Group("/api")
+	api.Use(middleware.NewAuthMiddleware(jwtConfig, service, nil).Authenticate())
+	api.GET("/notes", middleware.RequireScope(users.ScopeNotesRead), ok)
+	api.POST("/notes", middleware.RequireScope(users.ScopeNotesWrite), ok)
+	api.GET("/account", ok)
+	APIKeyRoutes(api, NewAPIKeyHandler(service))
+
+	return &keyTest{router: router, service: service, repo: repo, jwtConfig: jwtConfig, user: user}
+}
+
+func (k *keyTest) request(method, path, bearer, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+bearer)
+	recorder := httptest.NewRecorder()
+	k.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (k *keyTest) create(t *testing.T, expiresAt *time.Time, scopes ...users.Scope) string {
+	t.Helper()
+	key, _, err := k.service.Create(context.Background(), k.user.ID, "Script", scopes, expiresAt)
+	require.NoError(t, err)
+	return key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		name           string
+		scopes         []users.Scope
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Scope allows the route", scopes: []users.Scope{users.ScopeNotesRead}, method: http.MethodGet, path: "/api/notes", expectedStatus: http.StatusOK},
+		{name: "Scope is missing", scopes: []users.Scope{users.ScopeNotesRead}, method: http.MethodPost, path: "/api/notes", expectedStatus: http.StatusForbidden},
+		{name: "Admin grants every scope", scopes: []users.Scope{users.ScopeAdmin}, method: http.MethodPost, path: "/api/notes", expectedStatus: http.StatusOK},
+		{name: "Route without a scope needs admin", scopes: []users.Scope{users.ScopeNotesRead, users.ScopeNotesWrite}, method: http.MethodGet, path: "/api/account", expectedStatus: http.StatusUnauthorized},
+		{name: "Admin uses a route without a scope", scopes: []users.Scope{users.ScopeAdmin}, method: http.MethodGet, path: "/api/account", expectedStatus: http.StatusOK},
+		{name: "Keys can't create keys", scopes: []users.Scope{users.ScopeAdmin}, method: http.MethodPost, path: "/api/auth/api-keys", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			keys := setupKeys(t)
+			key := keys.create(t, nil, tt.scopes...)
+
+			// Act
+			recorder := keys.request(tt.method, tt.path, key, `{"name":"Another","scopes":["admin"]}`)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(t *testing.T, keys *keyTest) string
+	}{
+		{
+			name: "Unknown key",
+			key: func(t *testing.T, keys *keyTest) string {
+				return middleware.APIKeyPrefix + strings.Repeat("0", 48)
+			},
+		},
+		{
+			name: "Expired key",
+			key: func(t *testing.T, keys *keyTest) string {
+				key := keys.create(t, nil, users.ScopeNotesRead)
+				for _, record := range keys.repo.keys {
+					expired := time.Now().Add(-time.Minute)
+					record.ExpiresAt = &expired
+				}
+				return key
+			},
+		},
+		{
+			name: "Revoked key",
+			key: func(t *testing.T, keys *keyTest) string {
+				key := keys.create(t, nil, users.ScopeNotesRead)
+				for id := range keys.repo.keys {
+					require.NoError(t, keys.service.Revoke(context.Background(), keys.user.ID, id))
+				}
+				return key
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			keys := setupKeys(t)
+			key := tt.key(t, keys)
+
+			// Act
+			recorder := keys.request(http.MethodGet, "/api/notes", key, "")
+
+			// Assert
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	// Arrange
+	keys := setupKeys(t)
+	session, err := jwt.GenerateToken(keys.jwtConfig, keys.user)
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+	// Act
+	created := keys.request(http.MethodPost, "/api/auth/api-keys", session, `{"name":"CI","scopes":["notes:read","attachments"],"expiresAt":"`+expiresAt+`"}`)
+	invalid := keys.request(http.MethodPost, "/api/auth/api-keys", session, `{"name":"CI","scopes":["notes:delete"]}`)
+	var response CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &response))
+	used := keys.request(http.MethodGet, "/api/notes", response.Key, "")
+	list := keys.request(http.MethodGet, "/api/auth/api-keys", session, "")
+
+	// Assert
+	require.Equal(t, http.StatusCreated, created.Code, created.Body.String())
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	assert.True(t, strings.HasPrefix(response.Key, response.Prefix))
+	assert.Equal(t, "nk_", response.Key[:3])
+	assert.Equal(t, []users.Scope{users.ScopeNotesRead, users.ScopeAttachments}, response.Scopes)
+	assert.Equal(t, http.StatusOK, used.Code, used.Body.String())
+	assert.NotContains(t, list.Body.String(), response.Key, "Listing should never show the key")
+	for _, record := range keys.repo.keys {
+		assert.NotEqual(t, response.Key, record.KeyHash)
+		assert.NotNil(t, record.LastUsedAt)
+	}
+}
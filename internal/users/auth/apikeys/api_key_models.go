@@ -0,0 +1,41 @@
+package apikeys
+
+import (
+	"time"
+
+	"github.com/nantestech/note-api/internal/users"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string        `json:"name" binding:"required,max=100"`
+	Scopes    []users.Scope `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time    `json:"expiresAt"`
+}
+
+type APIKeyResponse struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Prefix     string        `json:"prefix"`
+	Scopes     []users.Scope `json:"scopes"`
+	ExpiresAt  *time.Time    `json:"expiresAt"`
+	LastUsedAt *time.Time    `json:"lastUsedAt"`
+	CreatedAt  time.Time     `json:"createdAt"`
+}
+
+// CreateAPIKeyResponse is the only response that includes the key.
+type CreateAPIKeyResponse struct {
+	Key string `json:"key"`
+	APIKeyResponse
+}
+
+func newAPIKeyResponse(key *APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID.String(),
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
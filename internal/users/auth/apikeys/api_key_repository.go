@@ -0,0 +1,66 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Add(ctx context.Context, key *APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*APIKey, error)
+	CountByUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	// Delete removes the user's key with id and reports whether there was
+	// one.
+	Delete(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	MarkUsed(ctx context.Context, id uuid.UUID, now time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *apiKeyRepository) Add(ctx context.Context, key *APIKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	var key APIKey
+	err := r.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*APIKey, error) {
+	var keys []*APIKey
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&keys).Error
+	return keys, err
+}
+
+func (r *apiKeyRepository) CountByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&APIKey{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *apiKeyRepository) Delete(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&APIKey{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *apiKeyRepository) MarkUsed(ctx context.Context, id uuid.UUID, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&APIKey{}).Where("id = ?", id).Update("last_used_at", now).Error
+}
+
+func NewAPIKeyRepository(db *gorm.DB) Repository {
+	return &apiKeyRepository{db: db}
+}
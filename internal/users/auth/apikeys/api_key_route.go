@@ -0,0 +1,22 @@
+package apikeys
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+// createFreshness is how recently the user must have signed in to create
+// a key. API keys have no sign-in time, so they can't create keys.
+const createFreshness = 10 * time.Minute
+
+func APIKeyRoutes(api *gin.RouterGroup, apiKeyHandler *APIKeyHandler) {
+
+	keys := api.Group("/auth/api-keys")
+	{
+		keys.GET("", apiKeyHandler.HandleListAPIKeys)
+		keys.POST("", middleware.RequireFreshLogin(createFreshness), apiKeyHandler.HandleCreateAPIKey)
+		keys.DELETE("/:id", apiKeyHandler.HandleRevokeAPIKey)
+	}
+}
@@ -0,0 +1,124 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+const (
+	maxKeysPerUser = 25
+	// lastUsedResolution limits last-used writes to one per key per
+	// minute, however often the key is used.
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrInvalidScope = errors.New("invalid scope")
+	ErrNoScopes     = errors.New("at least one scope is required")
+	ErrExpiryPassed = errors.New("expiry must be in the future")
+	ErrTooManyKeys  = fmt.Errorf("at most %d API keys are allowed", maxKeysPerUser)
+	ErrKeyNotFound  = errors.New("API key not found")
+)
+
+type APIKeyService interface {
+	// Create returns the new key, which can't be retrieved later, and its
+	// record.
+	Create(ctx context.Context, userID uuid.UUID, name string, scopes []users.Scope, expiresAt *time.Time) (string, *APIKey, error)
+	List(ctx context.Context, userID uuid.UUID) ([]*APIKey, error)
+	Revoke(ctx context.Context, userID, id uuid.UUID) error
+	middleware.APIKeyVerifier
+}
+
+type apiKeyService struct {
+	repo     Repository
+	userRepo users.Repository
+}
+
+func NewAPIKeyService(repo Repository, userRepo users.Repository) APIKeyService {
+	return &apiKeyService{
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+func (s *apiKeyService) Create(ctx context.Context, userID uuid.UUID, name string, scopes []users.Scope, expiresAt *time.Time) (string, *APIKey, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrNoScopes
+	}
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrExpiryPassed
+	}
+
+	count, err := s.repo.CountByUser(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if count >= maxKeysPerUser {
+		return "", nil, ErrTooManyKeys
+	}
+
+	key, record, err := newAPIKey(userID, name, scopes, expiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.repo.Add(ctx, record); err != nil {
+		return "", nil, err
+	}
+	return key, record, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context, userID uuid.UUID) ([]*APIKey, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, userID, id uuid.UUID) error {
+	deleted, err := s.repo.Delete(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// Verify builds the claims of a request made with key from the stored
+// user, so plan changes apply to keys right away.
+func (s *apiKeyService) Verify(ctx context.Context, key string) (*jwt.Claims, error) {
+	record, err := s.repo.GetByHash(ctx, hashKey(key))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if record == nil || record.IsExpired(now) {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedResolution {
+		if err := s.repo.MarkUsed(ctx, record.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return jwt.APIKeyClaims(user, record.ScopeList()), nil
+}
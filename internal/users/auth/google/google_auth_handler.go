@@ -5,78 +5,117 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	"github.com/nantestech/note-api/internal/users/auth/providers"
 	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
 	"github.com/nantestech/note-api/pkg/jwt"
 )
 
 type GoogleAuthHandler struct {
 	googleAuthService GoogleAuthService
-	userRepo          users.Repository
-	jwtConfig         jwt.Config
+	authService       providers.AuthService
+	tokenIssuer       mfa.TokenIssuer
+	stateSigner       *stateSigner
 }
 
-func NewGoogleAuthHandler(googleAuthService GoogleAuthService, userRepo users.Repository, jwtConfig jwt.Config) *GoogleAuthHandler {
+func NewGoogleAuthHandler(googleAuthService GoogleAuthService, authService providers.AuthService, jwtConfig jwt.Config, tokenIssuer mfa.TokenIssuer) *GoogleAuthHandler {
 	return &GoogleAuthHandler{
 		googleAuthService: googleAuthService,
-		userRepo:          userRepo,
-		jwtConfig:         jwtConfig,
+		authService:       authService,
+		tokenIssuer:       tokenIssuer,
+		stateSigner:       newStateSigner(jwtConfig),
 	}
 }
 
-func getRequestString(c *gin.Context) string {
-	code := c.Query("code")
-	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code parameter"})
-		return ""
-	}
-
-	return code
-}
-
-func (h *GoogleAuthHandler) createAuthResponse(token string, profilePic string, user *users.User) auth.AuthResponse {
+func (h *GoogleAuthHandler) createAuthResponse(token string, identity *providers.Identity, user *users.User) auth.AuthResponse {
 	return auth.AuthResponse{
 		Token:          token,
 		UserId:         user.ID.String(),
 		FirstName:      user.FirstName,
 		LastName:       user.LastName,
 		Email:          user.Email,
-		ProfilePicture: profilePic,
-		Provider:       "google",
+		ProfilePicture: identity.Picture,
+		Provider:       identity.Provider,
 	}
 }
 
-func (h *GoogleAuthHandler) HandleGoogleAuth(c *gin.Context) {
-	code := getRequestString(c)
-
-	payload, err := h.googleAuthService.GetAuth(c.Request.Context(), code)
+// HandleStart begins the authorization code flow with PKCE and redirects
+// the browser to Google.
+func (h *GoogleAuthHandler) HandleStart(c *gin.Context) {
+	state, err := newAuthState(h.stateSigner.now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	cookie, err := h.stateSigner.encode(state)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	user, err := h.userRepo.GetByEmail(c.Request.Context(), payload.Email)
+	h.setStateCookie(c, cookie, int(stateTTL.Seconds()))
+	c.Redirect(http.StatusFound, h.googleAuthService.AuthCodeURL(state.State, state.codeChallenge(), state.Nonce))
+}
 
+// HandleCallback finishes the flow Google redirects back to.
+func (h *GoogleAuthHandler) HandleCallback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Google sign-in failed: " + reason})
+		return
+	}
+
+	cookie, err := c.Cookie(stateCookieName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidState.Error()})
+		return
+	}
+	// The state is single use, whatever the outcome.
+	h.setStateCookie(c, "", -1)
+
+	state, err := h.stateSigner.decode(cookie)
+	if err != nil || !state.matches(c.Query("state")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidState.Error()})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code parameter"})
+		return
+	}
+
+	idToken, err := h.googleAuthService.ExchangeCode(c.Request.Context(), code, state.CodeVerifier)
+	if err != nil {
+		providers.RespondAuthError(c, err)
 		return
 	}
 
-	if user == nil {
-		user = users.NewUser(payload.GivenName, payload.FamilyName, payload.Email)
-		err = h.userRepo.Add(c.Request.Context(), user)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	user, identity, err := h.authService.SignIn(c.Request.Context(), h.googleAuthService.Name(), providers.Credentials{
+		IDToken: idToken,
+		Nonce:   state.Nonce,
+	})
+	if err != nil {
+		providers.RespondAuthError(c, err)
+		return
 	}
 
-	token, err := jwt.GenerateToken(h.jwtConfig, user)
+	token, challenge, err := h.tokenIssuer.Issue(c.Request.Context(), user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.createAuthResponse(token, identity, user))
+}
 
-	response := h.createAuthResponse(token, payload.Picture, user)
-	c.JSON(http.StatusOK, response)
+func (h *GoogleAuthHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	// Lax lets the cookie ride along on Google's top-level redirect back.
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookieName, value, maxAge, stateCookiePath, "", secure, true)
 }
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	"github.com/nantestech/note-api/internal/users/auth/oidc/oidctest"
+	"github.com/nantestech/note-api/internal/users/auth/providers"
+	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flowTest struct {
+	*userstest.Flow
+	server *oidctest.Server
+}
+
+func setupFlow(t *testing.T) *flowTest {
+	t.Helper()
+	flow := &flowTest{Flow: userstest.NewFlow(t), server: oidctest.NewServer()}
+	t.Cleanup(flow.server.Close)
+
+	googleAuthService := NewGoogleAuthService(GoogleAuthConfig{
+		ClientID:     testClientID,
+		ClientSecret: "google-secret",
+		RedirectURL:  "http://localhost:8080/auth/google/callback",
+		AuthURL:      flow.server.URL + "/authorize",
+		TokenURL:     flow.server.TokenURL(),
+		JWKSURL:      flow.server.JWKSURL(),
+	})
+	authService := providers.NewAuthService(providers.NewRegistry(googleAuthService), flow.UserRepo, userstest.NewIdentityRepository(), providers.PasswordSignIn(flow.UserRepo))
+	tokenIssuer := mfa.NewTokenIssuer(flow.JWTConfig, userstest.NoMFA{})
+	GoogleAuthRoutes(flow.Router, NewGoogleAuthHandler(googleAuthService, authService, flow.JWTConfig, tokenIssuer))
+	providers.AuthRoutes(flow.Router, providers.NewAuthHandler(authService, tokenIssuer))
+	return flow
+}
+
+// start runs /auth/google/start and returns the redirect's query and the
+// state cookie.
+func (f *flowTest) start(t *testing.T) (url.Values, *http.Cookie) {
+	t.Helper()
+	recorder := f.Serve(httptest.NewRequest(http.MethodGet, "/auth/google/start", nil))
+	require.Equal(t, http.StatusFound, recorder.Code)
+
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return location.Query(), cookies[0]
+}
+
+func (f *flowTest) callback(query string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/auth/google/callback?"+query, nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	return f.Serve(request)
+}
+
+func TestGoogleAuthorizationCodeFlow(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t)
+	query, cookie := flow.start(t)
+	code := flow.server.IssueCode(googleClaims(map[string]any{"nonce": query.Get("nonce")}))
+
+	// Act
+	recorder := flow.callback(url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), cookie)
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response auth.AuthResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "google", response.Provider)
+	assert.Equal(t, "jane@example.com", response.Email)
+	assert.NotEmpty(t, response.Token)
+
+	assert.Equal(t, testClientID, query.Get("client_id"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, "/auth/google", cookie.Path)
+
+	tokenRequests := flow.server.TokenRequests()
+	require.Len(t, tokenRequests, 1)
+	assert.Equal(t, "google-secret", tokenRequests[0].Get("client_secret"))
+	assert.Equal(t, "http://localhost:8080/auth/google/callback", tokenRequests[0].Get("redirect_uri"))
+	challenge := sha256.Sum256([]byte(tokenRequests[0].Get("code_verifier")))
+	assert.Equal(t, query.Get("code_challenge"), base64.RawURLEncoding.EncodeToString(challenge[:]), "The verifier should match the challenge")
+}
+
+func TestGoogleCallbackRejections(t *testing.T) {
+	tests := []struct {
+		name           string
+		tamper         func(query url.Values, cookie *http.Cookie) (url.Values, *http.Cookie)
+		nonce          string
+		expectedStatus int
+	}{
+		{
+			name: "State mismatch",
+			tamper: func(query url.Values, cookie *http.Cookie) (url.Values, *http.Cookie) {
+				query.Set("state", "forged")
+				return query, cookie
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Missing cookie",
+			tamper: func(query url.Values, cookie *http.Cookie) (url.Values, *http.Cookie) {
+				return query, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Tampered cookie",
+			tamper: func(query url.Values, cookie *http.Cookie) (url.Values, *http.Cookie) {
+				cookie.Value = "e30." + cookie.Value[len(cookie.Value)-10:]
+				return query, cookie
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Nonce mismatch",
+			nonce:          "replayed",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "User denied consent",
+			tamper: func(query url.Values, cookie *http.Cookie) (url.Values, *http.Cookie) {
+				return url.Values{"error": {"access_denied"}, "state": query["state"]}, cookie
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			flow := setupFlow(t)
+			query, cookie := flow.start(t)
+			nonce := query.Get("nonce")
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			code := flow.server.IssueCode(googleClaims(map[string]any{"nonce": nonce}))
+			callbackQuery := url.Values{"code": {code}, "state": {query.Get("state")}}
+			if tt.tamper != nil {
+				callbackQuery, cookie = tt.tamper(callbackQuery, cookie)
+			}
+
+			// Act
+			recorder := flow.callback(callbackQuery.Encode(), cookie)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+func TestGoogleCallbackUpstreamFailures(t *testing.T) {
+	tests := []struct {
+		name           string
+		arrange        func(server *oidctest.Server)
+		code           string
+		expectedStatus int
+	}{
+		{name: "Code used already", code: "code-spent", expectedStatus: http.StatusUnauthorized},
+		{
+			name:           "Token endpoint down",
+			arrange:        func(server *oidctest.Server) { server.SetTokenStatus(http.StatusInternalServerError) },
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "Signing keys unavailable",
+			arrange:        func(server *oidctest.Server) { server.SetJWKSStatus(http.StatusServiceUnavailable) },
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			flow := setupFlow(t)
+			query, cookie := flow.start(t)
+			code := flow.server.IssueCode(googleClaims(map[string]any{"nonce": query.Get("nonce")}))
+			if tt.code != "" {
+				code = tt.code
+			}
+			if tt.arrange != nil {
+				tt.arrange(flow.server)
+			}
+
+			// Act
+			recorder := flow.callback(url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), cookie)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+func TestStateExpires(t *testing.T) {
+	// Arrange
+	signer := newStateSigner(jwt.Config{SecretKey: "secret"})
+	state, err := newAuthState(signer.now())
+	require.NoError(t, err)
+	encoded, err := signer.encode(state)
+	require.NoError(t, err)
+
+	// Act
+	expired := time.Now().Add(stateTTL + time.Second)
+	signer.now = func() time.Time { return expired }
+	_, err = signer.decode(encoded)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrInvalidState)
+}
+
+func TestProviderRouteStillServesGoogle(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t)
+
+	// Act
+	recorder := flow.Serve(httptest.NewRequest(http.MethodGet, "/auth/google?id_token="+flow.server.IDToken(googleClaims(nil)), nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
@@ -6,9 +6,10 @@ import (
 
 func GoogleAuthRoutes(router *gin.Engine, googleAuthHandler *GoogleAuthHandler) {
 
-	auth := router.Group("/auth")
+	google := router.Group("/auth/google")
 	{
-		auth.GET("/google", googleAuthHandler.HandleGoogleAuth)
+		google.GET("/start", googleAuthHandler.HandleStart)
+		google.GET("/callback", googleAuthHandler.HandleCallback)
 	}
 }
 
@@ -3,12 +3,27 @@ package auth
 type GoogleAuthConfig struct {
 	ClientID     string
 	ClientSecret string
+	// RedirectURL is this API's /auth/google/callback as registered with
+	// Google.
+	RedirectURL string
+	AuthURL     string
+	TokenURL    string
+	// JWKSURL is where Google publishes the keys ID tokens are signed with.
+	JWKSURL string
+	// TokenInfoFallback verifies tokens with the tokeninfo endpoint when the
+	// keys can't be fetched.
+	TokenInfoFallback bool
+	TokenInfoURL      string
 }
 
 type GoogleTokenPayload struct {
+	Issuer        string `json:"iss"`
+	Audience      string `json:"aud"`
+	Subject       string `json:"sub"`
 	Email         string `json:"email"`
 	VerifiedEmail string `json:"email_verified"`
 	GivenName     string `json:"given_name"`
 	FamilyName    string `json:"family_name"`
 	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce"`
 }
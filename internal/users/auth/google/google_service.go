@@ -6,51 +6,158 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"time"
 
-	"github.com/nantestech/note-api/internal/users"
-	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/nantestech/note-api/internal/users/auth/oidc"
+	"github.com/nantestech/note-api/internal/users/auth/providers"
 )
 
+const (
+	defaultAuthURL      = "https://accounts.google.com/o/oauth2/v2/auth"
+	defaultTokenURL     = "https://oauth2.googleapis.com/token"
+	defaultJWKSURL      = "https://www.googleapis.com/oauth2/v3/certs"
+	defaultTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+)
+
+// Google issues ID tokens under either issuer.
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// GoogleAuthService signs users in with Google ID tokens, and runs the
+// server side of the authorization code flow that obtains them.
 type GoogleAuthService interface {
-	GetAuth(ctx context.Context, token string) (*GoogleTokenPayload, error)
+	providers.Provider
+	AuthCodeURL(state, codeChallenge, nonce string) string
+	ExchangeCode(ctx context.Context, code, codeVerifier string) (string, error)
 }
 
 type googleAuthService struct {
 	config     GoogleAuthConfig
-	jwtConfig  jwt.Config
-	userRepo   users.Repository
+	verifier   *oidc.Verifier
 	httpClient *http.Client
 }
 
-// GetAuth implements GoogleAuthService.
-func (g *googleAuthService) GetAuth(ctx context.Context, token string) (*GoogleTokenPayload, error) {
+func (g *googleAuthService) Name() string {
+	return "google"
+}
+
+// Authenticate verifies a Google ID token. Clients have always sent it as
+// the code parameter, so that is accepted too.
+func (g *googleAuthService) Authenticate(ctx context.Context, credentials providers.Credentials) (*providers.Identity, error) {
+	token := credentials.IDToken
+	if token == "" {
+		token = credentials.Code
+	}
+	if token == "" {
+		return nil, providers.ErrMissingCredentials
+	}
+
 	payload, err := g.validateGoogleToken(ctx, token)
 	if err != nil {
 		return nil, err
 	}
+	if credentials.Nonce != "" && payload.Nonce != credentials.Nonce {
+		return nil, providers.ErrNonceMismatch
+	}
 
+	return &providers.Identity{
+		Provider:      g.Name(),
+		Subject:       payload.Subject,
+		Email:         payload.Email,
+		EmailVerified: payload.VerifiedEmail == "true",
+		GivenName:     payload.GivenName,
+		FamilyName:    payload.FamilyName,
+		Picture:       payload.Picture,
+	}, nil
+}
+
+// AuthCodeURL is where to send the browser to sign in with Google.
+func (g *googleAuthService) AuthCodeURL(state, codeChallenge, nonce string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", g.config.ClientID)
+	query.Set("redirect_uri", g.config.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	return g.config.AuthURL + "?" + query.Encode()
+}
+
+// ExchangeCode redeems the code Google sent to the callback and returns
+// the ID token, which still has to be verified.
+func (g *googleAuthService) ExchangeCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	token, err := oidc.Exchange(ctx, g.httpClient, g.config.TokenURL, oidc.TokenRequest{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Code:         code,
+		RedirectURI:  g.config.RedirectURL,
+		CodeVerifier: codeVerifier,
+	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
-	return payload, nil
+	if token.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", oidc.ErrInvalidToken)
+	}
+	return token.IDToken, nil
 }
 
-func NewGoogleAuthService(config GoogleAuthConfig, jwtConfig jwt.Config, userRepo users.Repository) GoogleAuthService {
+func NewGoogleAuthService(config GoogleAuthConfig) GoogleAuthService {
+	if config.AuthURL == "" {
+		config.AuthURL = defaultAuthURL
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = defaultTokenURL
+	}
+	if config.JWKSURL == "" {
+		config.JWKSURL = defaultJWKSURL
+	}
+	if config.TokenInfoURL == "" {
+		config.TokenInfoURL = defaultTokenInfoURL
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
 	return &googleAuthService{
 		config:     config,
-		jwtConfig:  jwtConfig,
-		userRepo:   userRepo,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		verifier:   oidc.NewVerifier(oidc.NewKeySet(config.JWKSURL, httpClient), config.ClientID, googleIssuers...),
+		httpClient: httpClient,
 	}
 }
 
+// validateGoogleToken verifies the token locally against Google's keys.
 func (s *googleAuthService) validateGoogleToken(ctx context.Context, token string) (*GoogleTokenPayload, error) {
-	url := fmt.Sprintf("https://oauth2.googleapis.com/tokeninfo?id_token=%s", token)
+	idToken, err := s.verifier.Verify(ctx, token)
+	if err != nil {
+		if errors.Is(err, oidc.ErrKeysUnavailable) && s.config.TokenInfoFallback {
+			log.Printf("Google signing keys are unavailable, falling back to tokeninfo: %v", err)
+			return s.validateWithTokenInfo(ctx, token)
+		}
+		return nil, err
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	payload := &GoogleTokenPayload{
+		Issuer:        idToken.Issuer,
+		Audience:      s.config.ClientID,
+		Subject:       idToken.Subject,
+		Email:         idToken.Email,
+		VerifiedEmail: fmt.Sprint(bool(idToken.EmailVerified)),
+		GivenName:     idToken.GivenName,
+		FamilyName:    idToken.FamilyName,
+		Picture:       idToken.Picture,
+		Nonce:         idToken.Nonce,
+	}
+	return checkPayload(payload)
+}
+
+// validateWithTokenInfo asks Google to verify the token. tokeninfo checks
+// the signature and expiry; the audience is checked here.
+func (s *googleAuthService) validateWithTokenInfo(ctx context.Context, token string) (*GoogleTokenPayload, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.config.TokenInfoURL+"?id_token="+url.QueryEscape(token), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +169,7 @@ func (s *googleAuthService) validateGoogleToken(ctx context.Context, token strin
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to verify token: %s", resp.Status)
+		return nil, fmt.Errorf("%w: tokeninfo answered %s", oidc.ErrInvalidToken, resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -75,9 +182,19 @@ func (s *googleAuthService) validateGoogleToken(ctx context.Context, token strin
 		return nil, err
 	}
 
-	if payload.Email == "" || payload.VerifiedEmail != "true" {
-		return nil, errors.New("invalid token: email not verified")
+	if payload.Audience != s.config.ClientID {
+		return nil, fmt.Errorf("%w: token is not for this client", oidc.ErrInvalidToken)
 	}
+	if !slices.Contains(googleIssuers, payload.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", oidc.ErrInvalidToken, payload.Issuer)
+	}
+
+	return checkPayload(&payload)
+}
 
-	return &payload, nil
+func checkPayload(payload *GoogleTokenPayload) (*GoogleTokenPayload, error) {
+	if payload.Email == "" || payload.VerifiedEmail != "true" {
+		return nil, fmt.Errorf("%w: email not verified", providers.ErrEmailNotVerified)
+	}
+	return payload, nil
 }
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nantestech/note-api/internal/users/auth/oidc"
+	"github.com/nantestech/note-api/internal/users/auth/oidc/oidctest"
+	"github.com/nantestech/note-api/internal/users/auth/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testClientID = "client-123.apps.googleusercontent.com"
+
+func googleClaims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss":            "https://accounts.google.com",
+		"aud":            testClientID,
+		"sub":            "1234567890",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+	}
+	for key, value := range overrides {
+		claims[key] = value
+	}
+	return claims
+}
+
+func TestAuthenticateVerifiesLocally(t *testing.T) {
+	keyServer := oidctest.NewServer()
+	defer keyServer.Close()
+
+	tests := []struct {
+		name          string
+		claims        map[string]any
+		expectedError error
+	}{
+		{name: "Valid token", claims: googleClaims(nil)},
+		{name: "Issuer without scheme", claims: googleClaims(map[string]any{"iss": "accounts.google.com"})},
+		{name: "Token for another client", claims: googleClaims(map[string]any{"aud": "other.apps.googleusercontent.com"}), expectedError: oidc.ErrInvalidToken},
+		{name: "Other issuer", claims: googleClaims(map[string]any{"iss": "https://evil.example.com"}), expectedError: oidc.ErrInvalidToken},
+		{name: "Expired token", claims: googleClaims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}), expectedError: oidc.ErrInvalidToken},
+		{name: "Unverified email", claims: googleClaims(map[string]any{"email_verified": false}), expectedError: providers.ErrEmailNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			service := NewGoogleAuthService(GoogleAuthConfig{ClientID: testClientID, JWKSURL: keyServer.JWKSURL()})
+
+			// Act
+			identity, err := service.Authenticate(context.Background(), providers.Credentials{IDToken: keyServer.IDToken(tt.claims)})
+
+			// Assert
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "google", identity.Provider)
+			assert.Equal(t, "1234567890", identity.Subject)
+			assert.Equal(t, "jane@example.com", identity.Email)
+			assert.True(t, identity.EmailVerified)
+		})
+	}
+}
+
+func TestAuthenticateCachesKeys(t *testing.T) {
+	// Arrange
+	keyServer := oidctest.NewServer()
+	defer keyServer.Close()
+	keyServer.SetCacheControl("public, max-age=21600")
+	service := NewGoogleAuthService(GoogleAuthConfig{ClientID: testClientID, JWKSURL: keyServer.JWKSURL()})
+
+	// Act
+	for i := 0; i < 3; i++ {
+		_, err := service.Authenticate(context.Background(), providers.Credentials{Code: keyServer.IDToken(googleClaims(nil))})
+		require.NoError(t, err)
+	}
+
+	// Assert
+	assert.Equal(t, 1, keyServer.JWKSRequests())
+}
+
+func TestAuthenticateTokenInfoFallback(t *testing.T) {
+	signer := oidctest.NewServer()
+	defer signer.Close()
+	unavailable := oidctest.NewServer()
+	unavailable.Close()
+
+	tests := []struct {
+		name              string
+		fallback          bool
+		tokenInfoAudience string
+		expectedError     error
+		expectedCallCount int
+	}{
+		{name: "Fallback disabled", fallback: false, tokenInfoAudience: testClientID, expectedError: oidc.ErrKeysUnavailable},
+		{name: "Fallback enabled", fallback: true, tokenInfoAudience: testClientID, expectedCallCount: 1},
+		{name: "Fallback still checks the audience", fallback: true, tokenInfoAudience: "other-client", expectedError: oidc.ErrInvalidToken, expectedCallCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			tokenInfoCalls := 0
+			tokenInfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tokenInfoCalls++
+				json.NewEncoder(w).Encode(map[string]string{
+					"iss":            "https://accounts.google.com",
+					"aud":            tt.tokenInfoAudience,
+					"sub":            "1234567890",
+					"email":          "jane@example.com",
+					"email_verified": "true",
+				})
+			}))
+			defer tokenInfo.Close()
+
+			service := NewGoogleAuthService(GoogleAuthConfig{
+				ClientID:          testClientID,
+				JWKSURL:           unavailable.JWKSURL(),
+				TokenInfoFallback: tt.fallback,
+				TokenInfoURL:      tokenInfo.URL,
+			})
+
+			// Act
+			identity, err := service.Authenticate(context.Background(), providers.Credentials{IDToken: signer.IDToken(googleClaims(nil))})
+
+			// Assert
+			assert.Equal(t, tt.expectedCallCount, tokenInfoCalls)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "1234567890", identity.Subject)
+		})
+	}
+}
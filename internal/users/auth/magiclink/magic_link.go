@@ -0,0 +1,76 @@
+package magiclink
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"time"
+)
+
+// MagicLink signs in whoever follows it once before it expires, from the
+// browser that asked for it. Only hashes of the token and of the user
+// agent are stored.
+type MagicLink struct {
+	TokenHash     string `gorm:"primaryKey"`
+	Email         string
+	UserAgentHash string
+	IP            string
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
+
+func (MagicLink) TableName() string {
+	return "magic_links"
+}
+
+// newMagicLink returns the token to email and its record.
+func newMagicLink(email, userAgent, ip string, ttl time.Duration) (string, *MagicLink, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	return token, &MagicLink{
+		TokenHash:     hash(token),
+		Email:         email,
+		UserAgentHash: hash(userAgent),
+		IP:            ip,
+		ExpiresAt:     now.Add(ttl),
+		CreatedAt:     now,
+	}, nil
+}
+
+func (l *MagicLink) matchesUserAgent(userAgent string) bool {
+	return l.UserAgentHash == hash(userAgent)
+}
+
+// matchesNetwork reports whether ip is in the same /24 (IPv4) or /48
+// (IPv6) network as the requester, which tolerates the address changes of
+// mobile and carrier-grade NAT networks.
+func (l *MagicLink) matchesNetwork(ip string) bool {
+	requested, followed := net.ParseIP(l.IP), net.ParseIP(ip)
+	if requested == nil || followed == nil {
+		return false
+	}
+
+	if requested4, followed4 := requested.To4(), followed.To4(); requested4 != nil || followed4 != nil {
+		if requested4 == nil || followed4 == nil {
+			return false
+		}
+		mask := net.CIDRMask(24, 32)
+		return requested4.Mask(mask).Equal(followed4.Mask(mask))
+	}
+
+	mask := net.CIDRMask(48, 128)
+	return requested.Mask(mask).Equal(followed.Mask(mask))
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,95 @@
+package magiclink
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
+)
+
+// providerName is the provider reported in the auth responses of magic
+// link sign-ins.
+const providerName = "magic_link"
+
+type MagicLinkHandler struct {
+	magicLinkService MagicLinkService
+	tokenIssuer      mfa.TokenIssuer
+	rateWindow       int
+}
+
+func NewMagicLinkHandler(magicLinkService MagicLinkService, config Config, tokenIssuer mfa.TokenIssuer) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		magicLinkService: magicLinkService,
+		tokenIssuer:      tokenIssuer,
+		rateWindow:       int(config.RateWindow.Seconds()),
+	}
+}
+
+func (h *MagicLinkHandler) HandleSend(c *gin.Context) {
+	var request SendMagicLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.magicLinkService.Send(c.Request.Context(), request.Email, clientOf(c))
+	if err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			c.Header("Retry-After", strconv.Itoa(h.rateWindow))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// HandleVerify is the target of the link in the email.
+func (h *MagicLinkHandler) HandleVerify(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing token parameter"})
+		return
+	}
+
+	user, err := h.magicLinkService.Verify(c.Request.Context(), token, clientOf(c))
+	if err != nil {
+		if errors.Is(err, ErrInvalidLink) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, challenge, err := h.tokenIssuer.Issue(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, auth.AuthResponse{
+		Token:     token,
+		UserId:    user.ID.String(),
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Provider:  providerName,
+	})
+}
+
+func clientOf(c *gin.Context) Client {
+	return Client{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
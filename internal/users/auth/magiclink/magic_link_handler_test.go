@@ -0,0 +1,260 @@
+package magiclink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/mail"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const browser = "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"
+
+type mockRepository struct {
+	links map[string]*MagicLink
+}
+
+func (m *mockRepository) Add(_ context.Context, link *MagicLink) error {
+	m.links[link.TokenHash] = link
+	return nil
+}
+
+func (m *mockRepository) Consume(_ context.Context, tokenHash string, now time.Time, matches func(link *MagicLink) bool) (*MagicLink, error) {
+	link := m.links[tokenHash]
+	if link == nil || link.UsedAt != nil || !link.ExpiresAt.After(now) || !matches(link) {
+		return nil, ErrInvalidLink
+	}
+	link.UsedAt = &now
+	return link, nil
+}
+
+func (m *mockRepository) CountByEmailSince(_ context.Context, email string, since time.Time) (int64, error) {
+	var count int64
+	for _, link := range m.links {
+		if link.Email == email && link.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockRepository) CountByIPSince(_ context.Context, ip string, since time.Time) (int64, error) {
+	var count int64
+	for _, link := range m.links {
+		if link.IP == ip && link.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// fakeOutbox keeps enqueued messages instead of sending them
+type fakeOutbox struct {
+	messages []mail.Message
+}
+
+func (o *fakeOutbox) Enqueue(_ context.Context, _ *uuid.UUID, message mail.Message) error {
+	o.messages = append(o.messages, message)
+	return nil
+}
+
+func (o *fakeOutbox) DispatchDue(context.Context) (int, error) { return 0, nil }
+
+func (o *fakeOutbox) Run(context.Context) {}
+
+type flowTest struct {
+	*userstest.Flow
+	outbox *fakeOutbox
+}
+
+func setupFlow(t *testing.T, config Config) *flowTest {
+	t.Helper()
+	renderer, err := mail.NewTemplateRenderer("en")
+	require.NoError(t, err)
+
+	config.TTL = 15 * time.Minute
+	config.RateWindow = time.Hour
+	config.BaseURL = "http://localhost:8080"
+	config.Locale = "en"
+
+	flow := &flowTest{Flow: userstest.NewFlow(t), outbox: &fakeOutbox{}}
+	service := NewMagicLinkService(config, &mockRepository{links: make(map[string]*MagicLink)}, flow.UserRepo, flow.outbox, renderer)
+	MagicLinkRoutes(flow.Router, NewMagicLinkHandler(service, config, mfa.NewTokenIssuer(flow.JWTConfig, userstest.NoMFA{})))
+	return flow
+}
+
+func (f *flowTest) send(email, userAgent, ip string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/auth/magic-link", strings.NewReader(`{"email":"`+email+`"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.RemoteAddr = ip + ":40000"
+	return f.Serve(request)
+}
+
+// follow opens the link in the last email.
+func (f *flowTest) follow(t *testing.T, userAgent, ip string) *httptest.ResponseRecorder {
+	t.Helper()
+	require.NotEmpty(t, f.outbox.messages)
+	link, err := url.Parse(regexp.MustCompile(`https?://\S+`).FindString(f.outbox.messages[len(f.outbox.messages)-1].Text))
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodGet, link.RequestURI(), nil)
+	request.Header.Set("User-Agent", userAgent)
+	request.RemoteAddr = ip + ":40000"
+	return f.Serve(request)
+}
+
+func TestMagicLinkSignIn(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t, Config{MaxPerEmail: 5, MaxPerIP: 20})
+	existing := users.NewUser("Jane", "Doe", "jane@example.com")
+	flow.UserRepo.Users[existing.ID] = existing
+
+	// Act
+	sent := flow.send("Jane@Example.com", browser, "203.0.113.7")
+	recorder := flow.follow(t, browser, "203.0.113.7")
+	reused := flow.follow(t, browser, "203.0.113.7")
+
+	// Assert
+	assert.Equal(t, http.StatusAccepted, sent.Code)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response auth.AuthResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, existing.ID.String(), response.UserId)
+	assert.Equal(t, "magic_link", response.Provider)
+	assert.NotEmpty(t, response.Token)
+	assert.Equal(t, http.StatusUnauthorized, reused.Code, "Links are single use")
+}
+
+func TestMagicLinkCreatesUser(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t, Config{MaxPerEmail: 5, MaxPerIP: 20})
+
+	// Act
+	flow.send("new@example.com", browser, "203.0.113.7")
+	assert.Empty(t, flow.UserRepo.Users, "Requesting a link creates nothing")
+	recorder := flow.follow(t, browser, "203.0.113.7")
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code)
+	user, _ := flow.UserRepo.GetByEmail(context.Background(), "new@example.com")
+	require.NotNil(t, user)
+	assert.True(t, user.IsEmailVerified())
+}
+
+func TestMagicLinkDropsUnverifiedPassword(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t, Config{MaxPerEmail: 5, MaxPerIP: 20})
+	registered := users.NewUser("Jane", "Doe", "jane@example.com")
+	registered.SetPasswordHash("$argon2id$attacker")
+	flow.UserRepo.Users[registered.ID] = registered
+
+	// Act
+	flow.send("jane@example.com", browser, "203.0.113.7")
+	recorder := flow.follow(t, browser, "203.0.113.7")
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code)
+	user, _ := flow.UserRepo.GetByEmail(context.Background(), "jane@example.com")
+	require.NotNil(t, user)
+	assert.True(t, user.IsEmailVerified())
+	assert.False(t, user.HasPassword(), "A password set before the email was proven can't be trusted")
+}
+
+func TestMagicLinkBinding(t *testing.T) {
+	tests := []struct {
+		name           string
+		bindIP         bool
+		userAgent      string
+		ip             string
+		expectedStatus int
+	}{
+		{name: "Same browser", userAgent: browser, ip: "198.51.100.1", expectedStatus: http.StatusOK},
+		{name: "Other browser", userAgent: "curl/8.0", ip: "203.0.113.7", expectedStatus: http.StatusUnauthorized},
+		{name: "Same network when IP bound", bindIP: true, userAgent: browser, ip: "203.0.113.99", expectedStatus: http.StatusOK},
+		{name: "Other network when IP bound", bindIP: true, userAgent: browser, ip: "198.51.100.1", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			flow := setupFlow(t, Config{BindIP: tt.bindIP, MaxPerEmail: 5, MaxPerIP: 20})
+			flow.send("jane@example.com", browser, "203.0.113.7")
+
+			// Act
+			recorder := flow.follow(t, tt.userAgent, tt.ip)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.Equal(t, http.StatusOK, flow.follow(t, browser, "203.0.113.7").Code, "A refused link, opened by a mail scanner say, should still work for the user")
+			}
+		})
+	}
+}
+
+func TestMagicLinkRateLimits(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t, Config{MaxPerEmail: 2, MaxPerIP: 3})
+
+	// Act & Assert: per email
+	assert.Equal(t, http.StatusAccepted, flow.send("jane@example.com", browser, "203.0.113.7").Code)
+	assert.Equal(t, http.StatusAccepted, flow.send("jane@example.com", browser, "203.0.113.7").Code)
+	limited := flow.send("JANE@example.com", browser, "198.51.100.1")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "3600", limited.Header().Get("Retry-After"))
+
+	// Act & Assert: per IP
+	assert.Equal(t, http.StatusAccepted, flow.send("john@example.com", browser, "203.0.113.7").Code)
+	assert.Equal(t, http.StatusTooManyRequests, flow.send("june@example.com", browser, "203.0.113.7").Code)
+	assert.Len(t, flow.outbox.messages, 3)
+}
+
+func TestMagicLinkRateLimitIgnoresForwardedFor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		expectedStatus int
+	}{
+		{name: "Spoofed by the client", expectedStatus: http.StatusTooManyRequests},
+		{name: "Set by a trusted proxy", trustedProxies: []string{"10.0.0.1"}, expectedStatus: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			flow := setupFlow(t, Config{MaxPerEmail: 5, MaxPerIP: 1})
+			if tt.trustedProxies != nil {
+				require.NoError(t, flow.Router.SetTrustedProxies(tt.trustedProxies))
+			}
+			send := func(email, forwardedFor string) *httptest.ResponseRecorder {
+				request := httptest.NewRequest(http.MethodPost, "/auth/magic-link", strings.NewReader(`{"email":"`+email+`"}`))
+				request.Header.Set("Content-Type", "application/json")
+				request.Header.Set("X-Forwarded-For", forwardedFor)
+				request.RemoteAddr = "10.0.0.1:40000"
+				return flow.Serve(request)
+			}
+
+			// Act
+			first := send("jane@example.com", "203.0.113.7")
+			second := send("john@example.com", "198.51.100.1")
+
+			// Assert
+			assert.Equal(t, http.StatusAccepted, first.Code)
+			assert.Equal(t, tt.expectedStatus, second.Code)
+		})
+	}
+}
@@ -0,0 +1,5 @@
+package magiclink
+
+type SendMagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
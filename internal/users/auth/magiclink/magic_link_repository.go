@@ -0,0 +1,74 @@
+package magiclink
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	Add(ctx context.Context, link *MagicLink) error
+	// Consume marks the link used and returns it, or returns
+	// ErrInvalidLink when it's unknown, used, expired or doesn't match.
+	// A link that doesn't match is left unused.
+	Consume(ctx context.Context, tokenHash string, now time.Time, matches func(link *MagicLink) bool) (*MagicLink, error)
+	CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error)
+	CountByIPSince(ctx context.Context, ip string, since time.Time) (int64, error)
+}
+
+type magicLinkRepository struct {
+	db *gorm.DB
+}
+
+func (r *magicLinkRepository) Add(ctx context.Context, link *MagicLink) error {
+	return r.db.WithContext(ctx).Create(link).Error
+}
+
+func (r *magicLinkRepository) Consume(ctx context.Context, tokenHash string, now time.Time, matches func(link *MagicLink) bool) (*MagicLink, error) {
+	var link MagicLink
+	// The row is locked from the check to the update, so the link can't
+	// be used twice even by concurrent requests.
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).First(&link).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidLink
+			}
+			return err
+		}
+
+		if link.UsedAt != nil || !link.ExpiresAt.After(now) || !matches(&link) {
+			return ErrInvalidLink
+		}
+
+		link.UsedAt = &now
+		return tx.Model(&link).Update("used_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *magicLinkRepository) CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&MagicLink{}).
+		Where("email = ? AND created_at > ?", email, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *magicLinkRepository) CountByIPSince(ctx context.Context, ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&MagicLink{}).
+		Where("ip = ? AND created_at > ?", ip, since).
+		Count(&count).Error
+	return count, err
+}
+
+func NewMagicLinkRepository(db *gorm.DB) Repository {
+	return &magicLinkRepository{db: db}
+}
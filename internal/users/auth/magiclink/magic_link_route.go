@@ -0,0 +1,12 @@
+package magiclink
+
+import "github.com/gin-gonic/gin"
+
+func MagicLinkRoutes(router *gin.Engine, magicLinkHandler *MagicLinkHandler) {
+
+	magicLink := router.Group("/auth/magic-link")
+	{
+		magicLink.POST("", magicLinkHandler.HandleSend)
+		magicLink.GET("/verify", magicLinkHandler.HandleVerify)
+	}
+}
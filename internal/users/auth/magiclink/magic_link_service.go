@@ -0,0 +1,157 @@
+package magiclink
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nantestech/note-api/internal/mail"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+var (
+	ErrInvalidLink = errors.New("sign-in link is invalid or has expired")
+	ErrRateLimited = errors.New("too many sign-in links requested; try again later")
+)
+
+type Config struct {
+	TTL time.Duration
+	// BindIP also requires the link to be followed from the network it
+	// was requested from.
+	BindIP bool
+	// MaxPerEmail and MaxPerIP are how many links can be requested for an
+	// email or from an IP address within RateWindow.
+	MaxPerEmail int
+	MaxPerIP    int
+	RateWindow  time.Duration
+	// BaseURL is where this API is served, for the links.
+	BaseURL string
+	Locale  string
+}
+
+// Client is the device a link was requested or followed from.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+type MagicLinkService interface {
+	Send(ctx context.Context, email string, client Client) error
+	Verify(ctx context.Context, token string, client Client) (*users.User, error)
+}
+
+type magicLinkService struct {
+	config   Config
+	repo     Repository
+	userRepo users.Repository
+	outbox   mail.OutboxService
+	renderer mail.Renderer
+}
+
+func NewMagicLinkService(config Config, repo Repository, userRepo users.Repository, outbox mail.OutboxService, renderer mail.Renderer) MagicLinkService {
+	return &magicLinkService{
+		config:   config,
+		repo:     repo,
+		userRepo: userRepo,
+		outbox:   outbox,
+		renderer: renderer,
+	}
+}
+
+// Send emails a sign-in link. Links go to any address, since following
+// one creates the account when there's none yet.
+func (s *magicLinkService) Send(ctx context.Context, email string, client Client) error {
+	email = normalizeEmail(email)
+	if err := s.checkRate(ctx, email, client.IP); err != nil {
+		return err
+	}
+
+	token, link, err := newMagicLink(email, client.UserAgent, client.IP, s.config.TTL)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Add(ctx, link); err != nil {
+		return err
+	}
+
+	content, err := s.renderer.Render(mail.TemplateMagicLink, s.config.Locale, mail.MagicLinkData{
+		Link:         strings.TrimRight(s.config.BaseURL, "/") + "/auth/magic-link/verify?token=" + url.QueryEscape(token),
+		ValidMinutes: int(s.config.TTL.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.outbox.Enqueue(ctx, nil, mail.Message{
+		To:      email,
+		Subject: content.Subject,
+		Text:    content.Text,
+		HTML:    content.HTML,
+	})
+}
+
+// Verify signs in with a link, creating the user on first sign-in. A link
+// followed from another device is refused but not spent, so mail scanners
+// that open links don't use them up before the user gets to.
+func (s *magicLinkService) Verify(ctx context.Context, token string, client Client) (*users.User, error) {
+	link, err := s.repo.Consume(ctx, hash(token), time.Now(), func(link *MagicLink) bool {
+		return link.matchesUserAgent(client.UserAgent) && (!s.config.BindIP || link.matchesNetwork(client.IP))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, link.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		user = users.NewUser("", "", link.Email)
+		user.MarkEmailVerified()
+		if err := s.userRepo.Add(ctx, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	// Following the link proves the user reads the address. Whoever set
+	// the password of an unverified account never proved that, and may
+	// have registered someone else's email to wait for them, so the
+	// password goes. The owner can set a new one with a reset.
+	if !user.IsEmailVerified() {
+		user.MarkEmailVerified()
+		user.SetPasswordHash("")
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *magicLinkService) checkRate(ctx context.Context, email, ip string) error {
+	since := time.Now().Add(-s.config.RateWindow)
+
+	sent, err := s.repo.CountByEmailSince(ctx, email, since)
+	if err != nil {
+		return err
+	}
+	if sent >= int64(s.config.MaxPerEmail) {
+		return ErrRateLimited
+	}
+
+	sent, err = s.repo.CountByIPSince(ctx, ip, since)
+	if err != nil {
+		return err
+	}
+	if sent >= int64(s.config.MaxPerIP) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
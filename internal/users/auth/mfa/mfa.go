@@ -0,0 +1,114 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxFailedAttempts wrong codes in a row lock the second factor for
+	// lockoutDuration, which keeps six-digit codes from being guessed.
+	maxFailedAttempts = 5
+	lockoutDuration   = 15 * time.Minute
+)
+
+// TOTPFactor is a user's authenticator app. It protects sign-ins once
+// confirmed with a first code.
+type TOTPFactor struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Secret      string
+	ConfirmedAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, which
+	// can't be used again.
+	LastUsedStep   int64
+	FailedAttempts int
+	LockedUntil    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (TOTPFactor) TableName() string {
+	return "user_totp_factors"
+}
+
+func (f *TOTPFactor) IsConfirmed() bool {
+	return f.ConfirmedAt != nil
+}
+
+func (f *TOTPFactor) IsLocked(now time.Time) bool {
+	return f.LockedUntil != nil && f.LockedUntil.After(now)
+}
+
+func (f *TOTPFactor) recordFailure(now time.Time) {
+	f.FailedAttempts++
+	if f.FailedAttempts >= maxFailedAttempts {
+		lockedUntil := now.Add(lockoutDuration)
+		f.LockedUntil = &lockedUntil
+		f.FailedAttempts = 0
+	}
+	f.UpdatedAt = now
+}
+
+func (f *TOTPFactor) recordSuccess(step int64, now time.Time) {
+	if step > f.LastUsedStep {
+		f.LastUsedStep = step
+	}
+	f.FailedAttempts = 0
+	f.LockedUntil = nil
+	f.UpdatedAt = now
+}
+
+// RecoveryCode signs in once in place of a TOTP code. Only its hash is
+// stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (RecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns codes to show the user once, formatted like
+// "abcde-fghij", and their records.
+func newRecoveryCodes(userID uuid.UUID) ([]string, []*RecoveryCode, error) {
+	now := time.Now()
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]*RecoveryCode, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret := make([]byte, 7)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(secret))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		records = append(records, &RecoveryCode{
+			ID:        uuid.New(),
+			UserID:    userID,
+			CodeHash:  hashRecoveryCode(code),
+			CreatedAt: now,
+		})
+	}
+	return codes, records, nil
+}
+
+// hashRecoveryCode hashes a code as the user typed it, ignoring case,
+// spaces and dashes.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
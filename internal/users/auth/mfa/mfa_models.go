@@ -0,0 +1,28 @@
+package mfa
+
+type CodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type VerifyRequest struct {
+	MFAToken     string `json:"mfaToken" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type StatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recoveryCodesLeft"`
+}
+
+// EnrollmentResponse carries the QR code as a data: URL, ready for an img
+// tag.
+type EnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+	QRCode     string `json:"qrCode"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
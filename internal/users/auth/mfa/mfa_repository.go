@@ -0,0 +1,107 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	GetFactor(ctx context.Context, userID uuid.UUID) (*TOTPFactor, error)
+	SaveFactor(ctx context.Context, factor *TOTPFactor) error
+	// UpdateFactor calls update with the user's factor, locked until the
+	// end of a transaction, and a repository bound to that transaction,
+	// then saves the factor. Concurrent checks of a factor take turns, so
+	// each sees the attempts and codes the others used. It returns
+	// ErrNotEnrolled when the user has no factor, and saves nothing when
+	// update fails.
+	UpdateFactor(ctx context.Context, userID uuid.UUID, update func(repo Repository, factor *TOTPFactor) error) error
+	// DeleteFactor removes the user's factor and recovery codes.
+	DeleteFactor(ctx context.Context, userID uuid.UUID) error
+	// ReplaceRecoveryCodes swaps all of the user's recovery codes for codes.
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*RecoveryCode) error
+	// UseRecoveryCode spends the user's unused code with codeHash and
+	// reports whether there was one.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, now time.Time) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+func (r *mfaRepository) GetFactor(ctx context.Context, userID uuid.UUID) (*TOTPFactor, error) {
+	var factor TOTPFactor
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&factor).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &factor, nil
+}
+
+func (r *mfaRepository) SaveFactor(ctx context.Context, factor *TOTPFactor) error {
+	return r.db.WithContext(ctx).Save(factor).Error
+}
+
+func (r *mfaRepository) UpdateFactor(ctx context.Context, userID uuid.UUID, update func(repo Repository, factor *TOTPFactor) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var factor TOTPFactor
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&factor).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotEnrolled
+			}
+			return err
+		}
+
+		if err := update(&mfaRepository{db: tx}, &factor); err != nil {
+			return err
+		}
+		factor.UpdatedAt = time.Now()
+		return tx.Save(&factor).Error
+	})
+}
+
+func (r *mfaRepository) DeleteFactor(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&TOTPFactor{}).Error
+	})
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*RecoveryCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, now time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *mfaRepository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func NewMFARepository(db *gorm.DB) Repository {
+	return &mfaRepository{db: db}
+}
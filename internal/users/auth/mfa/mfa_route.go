@@ -0,0 +1,31 @@
+package mfa
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users/auth/webauthn"
+)
+
+// setupFreshness is how recently the user must have signed in to change
+// their two-factor setup.
+const setupFreshness = 10 * time.Minute
+
+// MFARoutes registers the second step of sign-in on router, where
+// mfa_pending tokens are accepted, and the setup endpoints on the
+// authenticated api group. Turning two-factor authentication off takes a
+// passkey step-up when the user has one.
+func MFARoutes(router *gin.Engine, api *gin.RouterGroup, mfaHandler *MFAHandler, stepUp webauthn.StepUpMiddleware) {
+
+	router.POST("/auth/mfa/verify", mfaHandler.HandleVerify)
+
+	mfa := api.Group("/auth/mfa")
+	{
+		mfa.GET("", mfaHandler.HandleStatus)
+		mfa.POST("/totp", middleware.RequireFreshLogin(setupFreshness), mfaHandler.HandleEnroll)
+		mfa.POST("/totp/confirm", mfaHandler.HandleConfirm)
+		mfa.DELETE("/totp", stepUp.Require(webauthn.StepUpMaxAge), mfaHandler.HandleDisable)
+		mfa.POST("/recovery-codes", middleware.RequireFreshLogin(setupFreshness), mfaHandler.HandleRegenerateRecoveryCodes)
+	}
+}
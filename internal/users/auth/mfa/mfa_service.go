@@ -0,0 +1,294 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/qrcode"
+	"github.com/nantestech/note-api/pkg/totp"
+)
+
+const qrScale = 6
+
+var (
+	ErrAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrNotEnrolled     = errors.New("two-factor authentication is not set up")
+	ErrInvalidCode     = errors.New("invalid authentication code")
+	ErrTooManyAttempts = errors.New("too many invalid codes; try again later")
+	ErrMissingCode     = errors.New("code or recoveryCode is required")
+)
+
+// Enrollment is what the user needs to add the account to an
+// authenticator app.
+type Enrollment struct {
+	Secret string
+	URI    string
+	QRCode []byte
+}
+
+// Status is a user's two-factor authentication setup.
+type Status struct {
+	Enabled           bool
+	RecoveryCodesLeft int64
+}
+
+// MFAService manages TOTP two-factor authentication and checks second
+// factors.
+type MFAService interface {
+	Enabled(ctx context.Context, userID uuid.UUID) (bool, error)
+	Status(ctx context.Context, userID uuid.UUID) (*Status, error)
+	Enroll(ctx context.Context, userID uuid.UUID) (*Enrollment, error)
+	Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	Disable(ctx context.Context, userID uuid.UUID, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	// Verify checks the second factor of a sign-in, a TOTP code or a
+	// recovery code, and returns the user.
+	Verify(ctx context.Context, userID uuid.UUID, code, recoveryCode string) (*users.User, error)
+}
+
+type mfaService struct {
+	repo     Repository
+	userRepo users.Repository
+	issuer   string
+}
+
+// NewMFAService creates the service. issuer names the account in
+// authenticator apps.
+func NewMFAService(repo Repository, userRepo users.Repository, issuer string) MFAService {
+	return &mfaService{
+		repo:     repo,
+		userRepo: userRepo,
+		issuer:   issuer,
+	}
+}
+
+func (s *mfaService) Enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	factor, err := s.repo.GetFactor(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return factor != nil && factor.IsConfirmed(), nil
+}
+
+func (s *mfaService) Status(ctx context.Context, userID uuid.UUID) (*Status, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return &Status{}, nil
+	}
+
+	left, err := s.repo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{Enabled: true, RecoveryCodesLeft: left}, nil
+}
+
+// Enroll starts setting up an authenticator app, replacing any setup that
+// wasn't confirmed.
+func (s *mfaService) Enroll(ctx context.Context, userID uuid.UUID) (*Enrollment, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	factor, err := s.repo.GetFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor != nil && factor.IsConfirmed() {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = s.repo.SaveFactor(ctx, &TOTPFactor{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uri := totp.URI(s.issuer, user.Email, secret)
+	code, err := qrcode.Encode([]byte(uri))
+	if err != nil {
+		return nil, err
+	}
+	png, err := code.PNG(qrScale)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Enrollment{Secret: secret, URI: uri, QRCode: png}, nil
+}
+
+// Confirm turns two-factor authentication on once the authenticator app
+// produces a valid code, and returns the recovery codes.
+func (s *mfaService) Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	var codes []string
+	err := s.withCode(ctx, userID, false, code, func(repo Repository, factor *TOTPFactor) error {
+		var records []*RecoveryCode
+		var err error
+		codes, records, err = newRecoveryCodes(userID)
+		if err != nil {
+			return err
+		}
+		if err := repo.ReplaceRecoveryCodes(ctx, userID, records); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		factor.ConfirmedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *mfaService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	if err := s.withCode(ctx, userID, true, code, nil); err != nil {
+		return err
+	}
+	return s.repo.DeleteFactor(ctx, userID)
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	var codes []string
+	err := s.withCode(ctx, userID, true, code, func(repo Repository, _ *TOTPFactor) error {
+		var records []*RecoveryCode
+		var err error
+		codes, records, err = newRecoveryCodes(userID)
+		if err != nil {
+			return err
+		}
+		return repo.ReplaceRecoveryCodes(ctx, userID, records)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *mfaService) Verify(ctx context.Context, userID uuid.UUID, code, recoveryCode string) (*users.User, error) {
+	var err error
+	switch {
+	case code != "":
+		err = s.withCode(ctx, userID, true, code, nil)
+	case recoveryCode != "":
+		err = s.withRecoveryCode(ctx, userID, recoveryCode)
+	default:
+		err = ErrMissingCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.user(ctx, userID)
+}
+
+// withCode checks a TOTP code against the user's factor, which must be
+// confirmed or not as confirmed says, and calls then, when it isn't nil,
+// once the code is accepted. A code is accepted once, and wrong codes
+// count towards the lockout. Both are saved even though the code is
+// rejected, and only the changes of then are undone when it fails.
+func (s *mfaService) withCode(ctx context.Context, userID uuid.UUID, confirmed bool, code string, then func(repo Repository, factor *TOTPFactor) error) error {
+	var codeErr error
+	err := s.repo.UpdateFactor(ctx, userID, func(repo Repository, factor *TOTPFactor) error {
+		if err := checkConfirmed(factor, confirmed); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if factor.IsLocked(now) {
+			codeErr = ErrTooManyAttempts
+			return nil
+		}
+		step, ok := totp.Validate(factor.Secret, code, now)
+		if !ok || step <= factor.LastUsedStep {
+			factor.recordFailure(now)
+			codeErr = ErrInvalidCode
+			return nil
+		}
+		factor.recordSuccess(step, now)
+
+		if then == nil {
+			return nil
+		}
+		return then(repo, factor)
+	})
+	if err != nil {
+		return err
+	}
+	return codeErr
+}
+
+// withRecoveryCode spends one of the user's recovery codes, counting wrong
+// ones towards the lockout like wrong TOTP codes.
+func (s *mfaService) withRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error {
+	var codeErr error
+	err := s.repo.UpdateFactor(ctx, userID, func(repo Repository, factor *TOTPFactor) error {
+		if err := checkConfirmed(factor, true); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if factor.IsLocked(now) {
+			codeErr = ErrTooManyAttempts
+			return nil
+		}
+		used, err := repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code), now)
+		if err != nil {
+			return err
+		}
+		if !used {
+			factor.recordFailure(now)
+			codeErr = ErrInvalidCode
+			return nil
+		}
+
+		factor.FailedAttempts = 0
+		factor.LockedUntil = nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return codeErr
+}
+
+// checkConfirmed returns ErrNotEnrolled or ErrAlreadyEnabled when the
+// factor isn't in the state confirmed asks for.
+func checkConfirmed(factor *TOTPFactor, confirmed bool) error {
+	if confirmed && !factor.IsConfirmed() {
+		return ErrNotEnrolled
+	}
+	if !confirmed && factor.IsConfirmed() {
+		return ErrAlreadyEnabled
+	}
+	return nil
+}
+
+func (s *mfaService) user(ctx context.Context, userID uuid.UUID) (*users.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+	return user, nil
+}
@@ -0,0 +1,310 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/nantestech/note-api/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepository struct {
+	// mu makes UpdateFactor take turns, as the row lock does.
+	mu      sync.Mutex
+	factors map[uuid.UUID]*TOTPFactor
+	codes   map[uuid.UUID][]*RecoveryCode
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		factors: make(map[uuid.UUID]*TOTPFactor),
+		codes:   make(map[uuid.UUID][]*RecoveryCode),
+	}
+}
+
+func (m *mockRepository) GetFactor(_ context.Context, userID uuid.UUID) (*TOTPFactor, error) {
+	factor, ok := m.factors[userID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *factor
+	return &copied, nil
+}
+
+func (m *mockRepository) SaveFactor(_ context.Context, factor *TOTPFactor) error {
+	copied := *factor
+	m.factors[factor.UserID] = &copied
+	return nil
+}
+
+func (m *mockRepository) UpdateFactor(_ context.Context, userID uuid.UUID, update func(repo Repository, factor *TOTPFactor) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	factor, ok := m.factors[userID]
+	if !ok {
+		return ErrNotEnrolled
+	}
+	copied := *factor
+	// Give other checks the chance to run between reading and saving, as
+	// they would against a database.
+	runtime.Gosched()
+	if err := update(m, &copied); err != nil {
+		return err
+	}
+	m.factors[userID] = &copied
+	return nil
+}
+
+func (m *mockRepository) DeleteFactor(_ context.Context, userID uuid.UUID) error {
+	delete(m.factors, userID)
+	delete(m.codes, userID)
+	return nil
+}
+
+func (m *mockRepository) ReplaceRecoveryCodes(_ context.Context, userID uuid.UUID, codes []*RecoveryCode) error {
+	m.codes[userID] = codes
+	return nil
+}
+
+func (m *mockRepository) UseRecoveryCode(_ context.Context, userID uuid.UUID, codeHash string, now time.Time) (bool, error) {
+	for _, code := range m.codes[userID] {
+		if code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) CountRecoveryCodes(_ context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	for _, code := range m.codes[userID] {
+		if code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type serviceTest struct {
+	service MFAService
+	repo    *mockRepository
+	user    *users.User
+}
+
+func setupService() *serviceTest {
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	repo := newMockRepository()
+	userRepo := userstest.NewUserRepository(user)
+	return &serviceTest{service: NewMFAService(repo, userRepo, "Note"), repo: repo, user: user}
+}
+
+// enable enrolls and confirms the user, and returns the secret and the
+// recovery codes. The code used to confirm is for the previous step so that
+// the current one is still unused.
+func (s *serviceTest) enable(t *testing.T) (string, []string) {
+	t.Helper()
+	enrollment, err := s.service.Enroll(context.Background(), s.user.ID)
+	require.NoError(t, err)
+	codes, err := s.service.Confirm(context.Background(), s.user.ID, codeAt(t, enrollment.Secret, totp.Step(time.Now())-1))
+	require.NoError(t, err)
+	return enrollment.Secret, codes
+}
+
+func codeAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, step)
+	require.NoError(t, err)
+	return code
+}
+
+func TestEnrollAndConfirm(t *testing.T) {
+	// Arrange
+	test := setupService()
+
+	// Act
+	enrollment, err := test.service.Enroll(context.Background(), test.user.ID)
+	require.NoError(t, err)
+	enabledBefore, _ := test.service.Enabled(context.Background(), test.user.ID)
+	_, wrongErr := test.service.Confirm(context.Background(), test.user.ID, "000000")
+	codes, err := test.service.Confirm(context.Background(), test.user.ID, codeAt(t, enrollment.Secret, totp.Step(time.Now())))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+	assert.Equal(t, []byte("\x89PNG"), enrollment.QRCode[:4])
+	assert.False(t, enabledBefore, "An unconfirmed factor should not protect sign-ins")
+	assert.ErrorIs(t, wrongErr, ErrInvalidCode)
+	assert.Len(t, codes, recoveryCodeCount)
+	enabled, _ := test.service.Enabled(context.Background(), test.user.ID)
+	assert.True(t, enabled)
+	_, err = test.service.Enroll(context.Background(), test.user.ID)
+	assert.ErrorIs(t, err, ErrAlreadyEnabled)
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		verify      func(t *testing.T, test *serviceTest, secret string, recoveryCodes []string) error
+		expectedErr error
+	}{
+		{
+			name: "Accepts the current code",
+			verify: func(t *testing.T, test *serviceTest, secret string, _ []string) error {
+				_, err := test.service.Verify(context.Background(), test.user.ID, codeAt(t, secret, totp.Step(time.Now())), "")
+				return err
+			},
+		},
+		{
+			name: "Rejects a replayed code",
+			verify: func(t *testing.T, test *serviceTest, secret string, _ []string) error {
+				code := codeAt(t, secret, totp.Step(time.Now()))
+				_, err := test.service.Verify(context.Background(), test.user.ID, code, "")
+				require.NoError(t, err)
+				_, err = test.service.Verify(context.Background(), test.user.ID, code, "")
+				return err
+			},
+			expectedErr: ErrInvalidCode,
+		},
+		{
+			name: "Accepts a recovery code once",
+			verify: func(t *testing.T, test *serviceTest, _ string, recoveryCodes []string) error {
+				_, err := test.service.Verify(context.Background(), test.user.ID, "", recoveryCodes[0])
+				require.NoError(t, err)
+				_, err = test.service.Verify(context.Background(), test.user.ID, "", recoveryCodes[0])
+				return err
+			},
+			expectedErr: ErrInvalidCode,
+		},
+		{
+			name: "Locks out after too many wrong codes",
+			verify: func(t *testing.T, test *serviceTest, secret string, _ []string) error {
+				for i := 0; i < maxFailedAttempts; i++ {
+					_, err := test.service.Verify(context.Background(), test.user.ID, "000000", "")
+					require.ErrorIs(t, err, ErrInvalidCode)
+				}
+				_, err := test.service.Verify(context.Background(), test.user.ID, codeAt(t, secret, totp.Step(time.Now())), "")
+				return err
+			},
+			expectedErr: ErrTooManyAttempts,
+		},
+		{
+			name: "Requires a code",
+			verify: func(t *testing.T, test *serviceTest, _ string, _ []string) error {
+				_, err := test.service.Verify(context.Background(), test.user.ID, "", "")
+				return err
+			},
+			expectedErr: ErrMissingCode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			test := setupService()
+			secret, recoveryCodes := test.enable(t)
+
+			// Act
+			err := tt.verify(t, test, secret, recoveryCodes)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifyConcurrently(t *testing.T) {
+	tests := []struct {
+		name             string
+		code             func(t *testing.T, secret string) string
+		expectedAccepted int
+		expectedRejected int
+	}{
+		{name: "Wrong codes still lock out", code: func(*testing.T, string) string { return "000000" }, expectedRejected: maxFailedAttempts},
+		{name: "A code is accepted once", code: func(t *testing.T, secret string) string { return codeAt(t, secret, totp.Step(time.Now())) }, expectedAccepted: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			test := setupService()
+			secret, _ := test.enable(t)
+			code := tt.code(t, secret)
+			errs := make([]error, 50)
+
+			// Act
+			var wg sync.WaitGroup
+			for i := range errs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errs[i] = test.service.Verify(context.Background(), test.user.ID, code, "")
+				}()
+			}
+			wg.Wait()
+
+			// Assert
+			accepted, rejected := 0, 0
+			for _, err := range errs {
+				switch {
+				case err == nil:
+					accepted++
+				case errors.Is(err, ErrInvalidCode):
+					rejected++
+				}
+			}
+			assert.Equal(t, tt.expectedAccepted, accepted)
+			if tt.expectedRejected > 0 {
+				assert.Equal(t, tt.expectedRejected, rejected, "Every guess after the lockout should be turned away")
+			}
+		})
+	}
+}
+
+func TestRecoveryCodesIgnoreFormatting(t *testing.T) {
+	// Arrange
+	test := setupService()
+	_, recoveryCodes := test.enable(t)
+
+	// Act
+	_, err := test.service.Verify(context.Background(), test.user.ID, "", " "+strings.ToUpper(recoveryCodes[1][:5])+recoveryCodes[1][6:])
+
+	// Assert
+	require.NoError(t, err)
+	status, _ := test.service.Status(context.Background(), test.user.ID)
+	assert.Equal(t, int64(recoveryCodeCount-1), status.RecoveryCodesLeft)
+}
+
+func TestTokenIssuerChallengesEnabledUsers(t *testing.T) {
+	// Arrange
+	test := setupService()
+	test.enable(t)
+	issuer := NewTokenIssuer(jwt.Config{SecretKey: "secret", ExpiresInHours: 1}, test.service)
+
+	// Act
+	token, challenge, err := issuer.Issue(context.Background(), test.user)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, token)
+	require.NotNil(t, challenge)
+	assert.True(t, challenge.MFARequired)
+	claims, err := jwt.ValidateMFAPendingToken(jwt.Config{SecretKey: "secret"}, challenge.MFAToken)
+	require.NoError(t, err)
+	assert.Equal(t, test.user.ID, claims.UserID)
+}
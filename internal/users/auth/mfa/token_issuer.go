@@ -0,0 +1,81 @@
+package mfa
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+// pendingTTL is how long the user has to enter the second factor.
+const pendingTTL = 5 * time.Minute
+
+// Checker tells whether a user has two-factor authentication on.
+type Checker interface {
+	Enabled(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+type anyChecker []Checker
+
+// AnyEnabled reports two-factor authentication on when any of checkers
+// does, so users with either a TOTP app or a passkey get challenged.
+func AnyEnabled(checkers ...Checker) Checker {
+	return anyChecker(checkers)
+}
+
+func (c anyChecker) Enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	for _, checker := range c {
+		enabled, err := checker.Enabled(ctx, userID)
+		if err != nil || enabled {
+			return enabled, err
+		}
+	}
+	return false, nil
+}
+
+// Challenge is returned instead of a session token when the user still has
+// to pass the second factor, with POST /auth/mfa/verify or
+// POST /auth/webauthn/mfa.
+type Challenge struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	ExpiresIn   int    `json:"expiresIn"`
+}
+
+// TokenIssuer ends the first step of every sign-in: users without
+// two-factor authentication get their session token, the others a
+// challenge.
+type TokenIssuer interface {
+	Issue(ctx context.Context, user *users.User) (string, *Challenge, error)
+}
+
+type tokenIssuer struct {
+	jwtConfig jwt.Config
+	checker   Checker
+}
+
+func NewTokenIssuer(jwtConfig jwt.Config, checker Checker) TokenIssuer {
+	return &tokenIssuer{
+		jwtConfig: jwtConfig,
+		checker:   checker,
+	}
+}
+
+func (i *tokenIssuer) Issue(ctx context.Context, user *users.User) (string, *Challenge, error) {
+	enabled, err := i.checker.Enabled(ctx, user.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !enabled {
+		token, err := jwt.GenerateToken(i.jwtConfig, user)
+		return token, nil, err
+	}
+
+	token, err := jwt.GenerateMFAPendingToken(i.jwtConfig, user, time.Now(), pendingTTL)
+	if err != nil {
+		return "", nil, err
+	}
+	return "", &Challenge{MFARequired: true, MFAToken: token, ExpiresIn: int(pendingTTL.Seconds())}, nil
+}
@@ -0,0 +1,149 @@
+package oauthserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+// ClientHandler lets users register their own apps, and see and revoke
+// the apps they've given access to.
+type ClientHandler struct {
+	oauthService OAuthService
+}
+
+func NewClientHandler(oauthService OAuthService) *ClientHandler {
+	return &ClientHandler{
+		oauthService: oauthService,
+	}
+}
+
+func (h *ClientHandler) HandleListClients(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	clients, err := h.oauthService.ListClients(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]ClientResponse, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, newClientResponse(client))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *ClientHandler) HandleCreateClient(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request CreateClientRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, client, err := h.oauthService.RegisterClient(c.Request.Context(), userID, request.Name, request.RedirectURIs, request.Scopes, request.Confidential)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoRedirectURIs), errors.Is(err, ErrTooManyRedirects), errors.Is(err, ErrInvalidRedirectURI),
+			errors.Is(err, ErrNoScopes), errors.Is(err, ErrInvalidClientScope):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrTooManyClients):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateClientResponse{Secret: secret, ClientResponse: newClientResponse(client)})
+}
+
+func (h *ClientHandler) HandleDeleteClient(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+
+	if err := h.oauthService.DeleteClient(c.Request.Context(), userID, id); err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ClientHandler) HandleListAuthorizations(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	apps, err := h.oauthService.AuthorizedApps(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]AuthorizationResponse, 0, len(apps))
+	for _, app := range apps {
+		response = append(response, AuthorizationResponse{
+			ClientID:   app.Client.ID.String(),
+			ClientName: app.Client.Name,
+			Scopes:     app.Consent.ScopeList(),
+			UpdatedAt:  app.Consent.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *ClientHandler) HandleRevokeAuthorization(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	clientID, err := uuid.Parse(c.Param("clientId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+
+	if err := h.oauthService.RevokeApp(c.Request.Context(), userID, clientID); err != nil {
+		if errors.Is(err, ErrNotAuthorized) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,218 @@
+package oauthserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+// Client is a third-party app registered by one of our users. Public
+// clients, such as mobile and single-page apps, can't keep a secret and
+// have no SecretHash; PKCE protects their codes instead.
+type Client struct {
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OwnerID uuid.UUID
+	Name    string
+	// RedirectURIs and Scopes are stored space-separated, as in OAuth.
+	RedirectURIs string
+	Scopes       string
+	SecretHash   *string
+	CreatedAt    time.Time
+}
+
+func (Client) TableName() string {
+	return "oauth_clients"
+}
+
+func (c *Client) IsConfidential() bool {
+	return c.SecretHash != nil
+}
+
+func (c *Client) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+func (c *Client) ScopeList() []users.Scope {
+	return users.ParseScopes(c.Scopes)
+}
+
+// allowsRedirectURI compares uri exactly, as OAuth 2.0 Security Best
+// Current Practice asks.
+func (c *Client) allowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIList(), uri)
+}
+
+// AuthorizationCode is handed to the app's redirect URI once the user
+// consents, and traded for tokens once. Only its hash is stored.
+type AuthorizationCode struct {
+	CodeHash      string `gorm:"primaryKey"`
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        string
+	CodeChallenge string
+	// GrantID is set once the code has been traded for tokens, so tokens
+	// can be revoked if the code is used again.
+	GrantID   *uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (AuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// Grant is one app's access to a user's account, from a code exchange
+// until it's revoked. Access and refresh tokens belong to a grant, and
+// revoking it revokes them all.
+type Grant struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ClientID  uuid.UUID
+	UserID    uuid.UUID
+	Scopes    string
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+func (Grant) TableName() string {
+	return "oauth_grants"
+}
+
+func (g *Grant) IsActive() bool {
+	return g.RevokedAt == nil
+}
+
+func (g *Grant) ScopeList() []users.Scope {
+	return users.ParseScopes(g.Scopes)
+}
+
+// RefreshToken is used once: every refresh replaces it, and using a
+// replaced token again revokes its grant, since it must have leaked.
+type RefreshToken struct {
+	TokenHash string `gorm:"primaryKey"`
+	GrantID   uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (RefreshToken) TableName() string {
+	return "oauth_refresh_tokens"
+}
+
+// Consent remembers the scopes a user has allowed an app, so the consent
+// screen can say so next time.
+type Consent struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ClientID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Scopes    string
+	UpdatedAt time.Time
+}
+
+func (Consent) TableName() string {
+	return "oauth_consents"
+}
+
+func (c *Consent) ScopeList() []users.Scope {
+	return users.ParseScopes(c.Scopes)
+}
+
+// covers reports whether the user has already allowed every scope in
+// scopes.
+func (c *Consent) covers(scopes []users.Scope) bool {
+	granted := c.ScopeList()
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientScopes are the scopes apps can be given. Never admin, which
+// would let an app act as the user everywhere.
+var clientScopes = []users.Scope{users.ScopeNotesRead, users.ScopeNotesWrite, users.ScopeAttachments}
+
+// scopeDescriptions are shown on the consent screen.
+var scopeDescriptions = map[users.Scope]string{
+	users.ScopeNotesRead:   "Read your notes",
+	users.ScopeNotesWrite:  "Create, edit and delete your notes",
+	users.ScopeAttachments: "Read and upload attachments",
+}
+
+func isClientScope(scope users.Scope) bool {
+	return slices.Contains(clientScopes, scope)
+}
+
+// newSecret returns a random token for codes, refresh tokens and client
+// secrets.
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hash hashes a secret for lookup. Secrets are random, so a fast hash is
+// enough.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// s256 is the PKCE code challenge for verifier, RFC 7636 section 4.2.
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Error is an OAuth error response, RFC 6749 section 5.2. Errors with the
+// same Code match with errors.Is.
+type Error struct {
+	Code        string
+	Description string
+	// RedirectURI is set when the error should be sent back to the app
+	// rather than shown to the user.
+	RedirectURI string
+}
+
+var (
+	ErrInvalidRequest          = &Error{Code: "invalid_request"}
+	ErrInvalidClient           = &Error{Code: "invalid_client"}
+	ErrInvalidGrant            = &Error{Code: "invalid_grant"}
+	ErrUnsupportedGrantType    = &Error{Code: "unsupported_grant_type"}
+	ErrUnsupportedResponseType = &Error{Code: "unsupported_response_type"}
+	ErrInvalidScope            = &Error{Code: "invalid_scope"}
+	ErrAccessDenied            = &Error{Code: "access_denied"}
+)
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// oauthError returns an error like kind, described by description.
+func oauthError(kind *Error, description string) *Error {
+	return &Error{Code: kind.Code, Description: description}
+}
+
+// redirectError returns an error like kind to send back to redirectURI.
+func redirectError(kind *Error, description, redirectURI string) *Error {
+	return &Error{Code: kind.Code, Description: description, RedirectURI: redirectURI}
+}
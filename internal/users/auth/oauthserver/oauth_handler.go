@@ -0,0 +1,264 @@
+package oauthserver
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+)
+
+// OAuthHandler serves the OAuth 2.0 endpoints apps call, and the consent
+// screen of the web app.
+type OAuthHandler struct {
+	oauthService OAuthService
+	config       Config
+}
+
+func NewOAuthHandler(oauthService OAuthService, config Config) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: oauthService,
+		config:       config,
+	}
+}
+
+func (h *OAuthHandler) HandleMetadata(c *gin.Context) {
+	issuer := strings.TrimSuffix(h.config.Issuer, "/")
+	c.JSON(http.StatusOK, MetadataResponse{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ScopesSupported:                   clientScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeRefreshToken},
+		CodeChallengeMethodsSupported:     []string{codeChallengeS256},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+// HandleAuthorize sends the browser to the web app's consent screen, which
+// signs the user in if needed and calls HandleConsent.
+func (h *OAuthHandler) HandleAuthorize(c *gin.Context) {
+	c.Redirect(http.StatusFound, withQuery(h.config.ConsentURL, c.Request.URL.Query()))
+}
+
+// HandleConsent validates an authorization request and describes it for
+// the consent screen.
+func (h *OAuthHandler) HandleConsent(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request AuthorizationRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	authorization, err := h.oauthService.Authorize(c.Request.Context(), userID, request)
+	if err != nil {
+		respondAuthorizeError(c, err, request.State)
+		return
+	}
+
+	c.JSON(http.StatusOK, newConsentResponse(authorization))
+}
+
+// HandleConsentDecision records the user's answer on the consent screen
+// and returns where to send the browser: back to the app, with a code or
+// access_denied.
+func (h *OAuthHandler) HandleConsentDecision(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	// Only the user can consent, not an API key or another app.
+	if claims, ok := middleware.GetClaims(c); !ok || claims.IsScoped() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Consent must be given by the user"})
+		return
+	}
+
+	var request ConsentDecisionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !request.Approved {
+		authorization, err := h.oauthService.Authorize(c.Request.Context(), userID, request.AuthorizationRequest)
+		if err != nil {
+			respondAuthorizeError(c, err, request.State)
+			return
+		}
+		c.JSON(http.StatusOK, RedirectResponse{
+			RedirectURL: redirectURL(authorization.RedirectURI, request.State, url.Values{"error": {ErrAccessDenied.Code}}),
+		})
+		return
+	}
+
+	code, err := h.oauthService.Approve(c.Request.Context(), userID, request.AuthorizationRequest)
+	if err != nil {
+		respondAuthorizeError(c, err, request.State)
+		return
+	}
+
+	c.JSON(http.StatusOK, RedirectResponse{
+		RedirectURL: redirectURL(request.RedirectURI, request.State, url.Values{"code": {code}}),
+	})
+}
+
+func (h *OAuthHandler) HandleToken(c *gin.Context) {
+	var request TokenRequest
+	if err := c.ShouldBind(&request); err != nil {
+		respondTokenError(c, oauthError(ErrInvalidRequest, err.Error()))
+		return
+	}
+	credentials := clientCredentials(c, request.ClientID, request.ClientSecret)
+
+	var response *TokenResponse
+	var err error
+	switch request.GrantType {
+	case grantTypeAuthorizationCode:
+		response, err = h.oauthService.Exchange(c.Request.Context(), credentials, request.Code, request.RedirectURI, request.CodeVerifier)
+	case grantTypeRefreshToken:
+		response, err = h.oauthService.Refresh(c.Request.Context(), credentials, request.RefreshToken, request.Scope)
+	default:
+		err = oauthError(ErrUnsupportedGrantType, "grant_type must be authorization_code or refresh_token")
+	}
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *OAuthHandler) HandleIntrospect(c *gin.Context) {
+	var request TokenActionRequest
+	if err := c.ShouldBind(&request); err != nil || request.Token == "" {
+		respondTokenError(c, oauthError(ErrInvalidRequest, "token is required"))
+		return
+	}
+
+	response, err := h.oauthService.Introspect(c.Request.Context(), clientCredentials(c, request.ClientID, request.ClientSecret), request.Token)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *OAuthHandler) HandleRevoke(c *gin.Context) {
+	var request TokenActionRequest
+	if err := c.ShouldBind(&request); err != nil || request.Token == "" {
+		respondTokenError(c, oauthError(ErrInvalidRequest, "token is required"))
+		return
+	}
+
+	if err := h.oauthService.Revoke(c.Request.Context(), clientCredentials(c, request.ClientID, request.ClientSecret), request.Token); err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// clientCredentials prefers HTTP Basic, whose values are form-encoded
+// (RFC 6749 section 2.3.1), over the client_id and client_secret
+// parameters.
+func clientCredentials(c *gin.Context, clientID, clientSecret string) ClientCredentials {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return ClientCredentials{ID: clientID, Secret: clientSecret}
+	}
+
+	id, err := url.QueryUnescape(username)
+	if err != nil {
+		id = username
+	}
+	secret, err := url.QueryUnescape(password)
+	if err != nil {
+		secret = password
+	}
+	return ClientCredentials{ID: id, Secret: secret}
+}
+
+// respondAuthorizeError shows errors to the user, with the URL to send
+// them back to the app when the app should hear about it.
+func respondAuthorizeError(c *gin.Context, err error, state string) {
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description}
+	if oauthErr.RedirectURI != "" {
+		response["redirectUrl"] = redirectURL(oauthErr.RedirectURI, state, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+		})
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
+// respondTokenError responds as RFC 6749 section 5.2 asks.
+func respondTokenError(c *gin.Context, err error) {
+	noStore(c)
+
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if errors.Is(oauthErr, ErrInvalidClient) {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
+
+// noStore keeps tokens out of caches, RFC 6749 section 5.1.
+func noStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+}
+
+// redirectURL adds params and state, when there is one, to the app's
+// redirect URI.
+func redirectURL(redirectURI, state string, params url.Values) string {
+	if state != "" {
+		params.Set("state", state)
+	}
+	return withQuery(redirectURI, params)
+}
+
+func withQuery(base string, params url.Values) string {
+	parsed, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
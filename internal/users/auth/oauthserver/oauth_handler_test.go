@@ -0,0 +1,675 @@
+package oauthserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepository struct {
+	clients       map[uuid.UUID]*Client
+	codes         map[string]*AuthorizationCode
+	grants        map[uuid.UUID]*Grant
+	refreshTokens map[string]*RefreshToken
+	consents      map[[2]uuid.UUID]*Consent
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		clients:       make(map[uuid.UUID]*Client),
+		codes:         make(map[string]*AuthorizationCode),
+		grants:        make(map[uuid.UUID]*Grant),
+		refreshTokens: make(map[string]*RefreshToken),
+		consents:      make(map[[2]uuid.UUID]*Consent),
+	}
+}
+
+func (m *mockRepository) AddClient(_ context.Context, client *Client) error {
+	m.clients[client.ID] = client
+	return nil
+}
+
+func (m *mockRepository) GetClient(_ context.Context, id uuid.UUID) (*Client, error) {
+	return m.clients[id], nil
+}
+
+func (m *mockRepository) ListClientsByOwner(_ context.Context, ownerID uuid.UUID) ([]*Client, error) {
+	var clients []*Client
+	for _, client := range m.clients {
+		if client.OwnerID == ownerID {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+func (m *mockRepository) CountClientsByOwner(ctx context.Context, ownerID uuid.UUID) (int64, error) {
+	clients, _ := m.ListClientsByOwner(ctx, ownerID)
+	return int64(len(clients)), nil
+}
+
+func (m *mockRepository) DeleteClient(_ context.Context, ownerID, id uuid.UUID) (bool, error) {
+	client := m.clients[id]
+	if client == nil || client.OwnerID != ownerID {
+		return false, nil
+	}
+	delete(m.clients, id)
+	for grantID, grant := range m.grants {
+		if grant.ClientID == id {
+			delete(m.grants, grantID)
+		}
+	}
+	return true, nil
+}
+
+func (m *mockRepository) AddCode(_ context.Context, code *AuthorizationCode) error {
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *mockRepository) ConsumeCode(_ context.Context, codeHash string, now time.Time) (*AuthorizationCode, error) {
+	code := m.codes[codeHash]
+	if code == nil || code.UsedAt != nil || !code.ExpiresAt.After(now) {
+		return nil, nil
+	}
+	code.UsedAt = &now
+	copied := *code
+	return &copied, nil
+}
+
+func (m *mockRepository) GetCode(_ context.Context, codeHash string) (*AuthorizationCode, error) {
+	return m.codes[codeHash], nil
+}
+
+func (m *mockRepository) SetCodeGrant(_ context.Context, codeHash string, grantID uuid.UUID) error {
+	m.codes[codeHash].GrantID = &grantID
+	return nil
+}
+
+func (m *mockRepository) AddGrant(_ context.Context, grant *Grant) error {
+	m.grants[grant.ID] = grant
+	return nil
+}
+
+func (m *mockRepository) GetGrant(_ context.Context, id uuid.UUID) (*Grant, error) {
+	return m.grants[id], nil
+}
+
+func (m *mockRepository) RevokeGrant(_ context.Context, id uuid.UUID, now time.Time) error {
+	if grant := m.grants[id]; grant != nil && grant.RevokedAt == nil {
+		grant.RevokedAt = &now
+	}
+	return nil
+}
+
+func (m *mockRepository) RevokeGrantsByClient(_ context.Context, userID, clientID uuid.UUID, now time.Time) error {
+	for _, grant := range m.grants {
+		if grant.UserID == userID && grant.ClientID == clientID && grant.RevokedAt == nil {
+			grant.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) AddRefreshToken(_ context.Context, token *RefreshToken) error {
+	m.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *mockRepository) ConsumeRefreshToken(_ context.Context, tokenHash string, now time.Time) (*RefreshToken, error) {
+	token := m.refreshTokens[tokenHash]
+	if token == nil || token.UsedAt != nil || !token.ExpiresAt.After(now) {
+		return nil, nil
+	}
+	token.UsedAt = &now
+	copied := *token
+	return &copied, nil
+}
+
+func (m *mockRepository) GetRefreshToken(_ context.Context, tokenHash string) (*RefreshToken, error) {
+	return m.refreshTokens[tokenHash], nil
+}
+
+func (m *mockRepository) GetConsent(_ context.Context, userID, clientID uuid.UUID) (*Consent, error) {
+	return m.consents[[2]uuid.UUID{userID, clientID}], nil
+}
+
+func (m *mockRepository) SaveConsent(_ context.Context, consent *Consent) error {
+	m.consents[[2]uuid.UUID{consent.UserID, consent.ClientID}] = consent
+	return nil
+}
+
+func (m *mockRepository) ListConsentsByUser(_ context.Context, userID uuid.UUID) ([]*Consent, error) {
+	var consents []*Consent
+	for _, consent := range m.consents {
+		if consent.UserID == userID {
+			consents = append(consents, consent)
+		}
+	}
+	return consents, nil
+}
+
+func (m *mockRepository) DeleteConsent(_ context.Context, userID, clientID uuid.UUID) (bool, error) {
+	key := [2]uuid.UUID{userID, clientID}
+	if m.consents[key] == nil {
+		return false, nil
+	}
+	delete(m.consents, key)
+	return true, nil
+}
+
+const (
+	redirectURI = "https://app.example.com/callback"
+	verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+type oauthTest struct {
+	router  *gin.Engine
+	service OAuthService
+	repo    *mockRepository
+	session string
+	user    *users.User
+}
+
+func setupOAuth(t *testing.T) *oauthTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	repo := newMockRepository()
+	jwtConfig := jwt.Config{SecretKey: "secret", ExpiresInHours: 1}
+	config := Config{
+		Issuer:          "https://api.example.com",
+		ConsentURL:      "https://example.com/oauth/consent",
+		CodeTTL:         5 * time.Minute,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+	}
+	service := NewOAuthService(config, jwtConfig, repo, userstest.NewUserRepository(user))
+
+	ok := func(c *gin.Context) {
+		userID, ok := middleware.GetUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"userId": userID})
+	}
+	router := gin.New()
+	api := router.Group("/api")
+	api.Use(middleware.NewAuthMiddleware(jwtConfig, nil, service).Authenticate())
+	api.GET("/notes", middleware.RequireScope(users.ScopeNotesRead), ok)
+	api.POST("/notes", middleware.RequireScope(users.ScopeNotesWrite), ok)
+	api.GET("/account", ok)
+	OAuthRoutes(router, api, NewOAuthHandler(service, config), NewClientHandler(service))
+
+	session, err := jwt.GenerateToken(jwtConfig, user)
+	require.NoError(t, err)
+	return &oauthTest{router: router, service: service, repo: repo, session: session, user: user}
+}
+
+// register registers an app allowed notes:read and notes:write, and
+// returns its ID and secret.
+func (o *oauthTest) register(t *testing.T, confidential bool) (string, string) {
+	t.Helper()
+	secret, client, err := o.service.RegisterClient(context.Background(), uuid.New(), "Notes Sync", []string{redirectURI}, []users.Scope{users.ScopeNotesRead, users.ScopeNotesWrite}, confidential)
+	require.NoError(t, err)
+	return client.ID.String(), secret
+}
+
+func authorizationRequest(clientID, scope string) AuthorizationRequest {
+	return AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		State:               "xyz",
+		CodeChallenge:       s256(verifier),
+		CodeChallengeMethod: codeChallengeS256,
+	}
+}
+
+func (o *oauthTest) api(method, path, bearer string, body any) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	request := httptest.NewRequest(method, path, strings.NewReader(string(payload)))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+bearer)
+	recorder := httptest.NewRecorder()
+	o.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (o *oauthTest) form(path string, form url.Values, basicID, basicSecret string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicID != "" {
+		request.SetBasicAuth(url.QueryEscape(basicID), url.QueryEscape(basicSecret))
+	}
+	recorder := httptest.NewRecorder()
+	o.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// approve consents to request as the user and returns the code sent to
+// the app.
+func (o *oauthTest) approve(t *testing.T, request AuthorizationRequest) string {
+	t.Helper()
+	recorder := o.api(http.MethodPost, "/api/oauth/authorize", o.session, ConsentDecisionRequest{AuthorizationRequest: request, Approved: true})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response RedirectResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	redirect, err := url.Parse(response.RedirectURL)
+	require.NoError(t, err)
+	require.Equal(t, "xyz", redirect.Query().Get("state"))
+	return redirect.Query().Get("code")
+}
+
+func (o *oauthTest) exchange(t *testing.T, clientID, code string) TokenResponse {
+	t.Helper()
+	recorder := o.form("/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}, "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response TokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	clientID, _ := o.register(t, false)
+	request := authorizationRequest(clientID, "notes:read")
+
+	// Act
+	consent := o.api(http.MethodGet, "/api/oauth/authorize?"+url.Values{
+		"response_type":         {request.ResponseType},
+		"client_id":             {request.ClientID},
+		"redirect_uri":          {request.RedirectURI},
+		"scope":                 {request.Scope},
+		"state":                 {request.State},
+		"code_challenge":        {request.CodeChallenge},
+		"code_challenge_method": {request.CodeChallengeMethod},
+	}.Encode(), o.session, nil)
+	tokens := o.exchange(t, clientID, o.approve(t, request))
+	read := o.api(http.MethodGet, "/api/notes", tokens.AccessToken, nil)
+	write := o.api(http.MethodPost, "/api/notes", tokens.AccessToken, nil)
+	account := o.api(http.MethodGet, "/api/account", tokens.AccessToken, nil)
+	consentByApp := o.api(http.MethodPost, "/api/oauth/authorize", tokens.AccessToken, ConsentDecisionRequest{AuthorizationRequest: request, Approved: true})
+
+	// Assert
+	require.Equal(t, http.StatusOK, consent.Code, consent.Body.String())
+	var consentResponse ConsentResponse
+	require.NoError(t, json.Unmarshal(consent.Body.Bytes(), &consentResponse))
+	assert.Equal(t, "Notes Sync", consentResponse.ClientName)
+	assert.Equal(t, []ScopeResponse{{Scope: users.ScopeNotesRead, Description: "Read your notes"}}, consentResponse.Scopes)
+	assert.False(t, consentResponse.Consented)
+
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, "notes:read", tokens.Scope)
+	assert.Equal(t, 3600, tokens.ExpiresIn)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, read.Code, read.Body.String())
+	assert.Equal(t, http.StatusForbidden, write.Code, "Scope the user didn't consent to")
+	assert.Equal(t, http.StatusUnauthorized, account.Code, "Routes without a scope aren't open to apps")
+	assert.Equal(t, http.StatusUnauthorized, consentByApp.Code, "Apps can't consent for the user")
+}
+
+func TestConsentIsRemembered(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	clientID, _ := o.register(t, false)
+	o.approve(t, authorizationRequest(clientID, "notes:read"))
+
+	// Act
+	same, err := o.service.Authorize(context.Background(), o.user.ID, authorizationRequest(clientID, "notes:read"))
+	require.NoError(t, err)
+	more, err := o.service.Authorize(context.Background(), o.user.ID, authorizationRequest(clientID, "notes:read notes:write"))
+	require.NoError(t, err)
+
+	// Assert
+	assert.True(t, same.Consented)
+	assert.False(t, more.Consented, "New scopes need consent")
+}
+
+func TestAuthorizationRequestErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		modify         func(r *AuthorizationRequest)
+		expectedError  string
+		expectRedirect bool
+	}{
+		{name: "Unknown client", modify: func(r *AuthorizationRequest) { r.ClientID = uuid.NewString() }, expectedError: "invalid_request"},
+		{name: "Unregistered redirect URI", modify: func(r *AuthorizationRequest) { r.RedirectURI = "https://evil.example.com/callback" }, expectedError: "invalid_request"},
+		{name: "Implicit flow", modify: func(r *AuthorizationRequest) { r.ResponseType = "token" }, expectedError: "unsupported_response_type", expectRedirect: true},
+		{name: "Missing PKCE", modify: func(r *AuthorizationRequest) { r.CodeChallenge = "" }, expectedError: "invalid_request", expectRedirect: true},
+		{name: "Plain PKCE", modify: func(r *AuthorizationRequest) { r.CodeChallengeMethod = "plain" }, expectedError: "invalid_request", expectRedirect: true},
+		{name: "Scope the client isn't allowed", modify: func(r *AuthorizationRequest) { r.Scope = "attachments" }, expectedError: "invalid_scope", expectRedirect: true},
+		{name: "Admin scope", modify: func(r *AuthorizationRequest) { r.Scope = "admin" }, expectedError: "invalid_scope", expectRedirect: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			o := setupOAuth(t)
+			clientID, _ := o.register(t, false)
+			request := authorizationRequest(clientID, "notes:read")
+			tt.modify(&request)
+
+			// Act
+			recorder := o.api(http.MethodPost, "/api/oauth/authorize", o.session, ConsentDecisionRequest{AuthorizationRequest: request, Approved: true})
+
+			// Assert
+			require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+			var response map[string]string
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedError, response["error"])
+			if !tt.expectRedirect {
+				assert.Empty(t, response["redirectUrl"], "Errors must not go to unverified redirect URIs")
+				return
+			}
+			redirect, err := url.Parse(response["redirectUrl"])
+			require.NoError(t, err)
+			assert.Equal(t, redirectURI, strings.Split(redirect.String(), "?")[0])
+			assert.Equal(t, tt.expectedError, redirect.Query().Get("error"))
+			assert.Equal(t, "xyz", redirect.Query().Get("state"))
+			assert.Empty(t, o.repo.codes)
+		})
+	}
+}
+
+func TestConsentDenied(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	clientID, _ := o.register(t, false)
+
+	// Act
+	recorder := o.api(http.MethodPost, "/api/oauth/authorize", o.session, ConsentDecisionRequest{AuthorizationRequest: authorizationRequest(clientID, "")})
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response RedirectResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, redirectURI+"?error=access_denied&state=xyz", response.RedirectURL)
+	assert.Empty(t, o.repo.codes)
+	assert.Empty(t, o.repo.consents)
+}
+
+func TestCodeExchangeRejected(t *testing.T) {
+	tests := []struct {
+		name           string
+		form           func(clientID, otherClientID, code string) url.Values
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "Wrong code verifier",
+			form: func(clientID, _, code string) url.Values {
+				return url.Values{"client_id": {clientID}, "code": {code}, "redirect_uri": {redirectURI}, "code_verifier": {strings.Repeat("a", 43)}}
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_grant",
+		},
+		{
+			name: "Missing code verifier",
+			form: func(clientID, _, code string) url.Values {
+				return url.Values{"client_id": {clientID}, "code": {code}, "redirect_uri": {redirectURI}}
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name: "Other redirect URI",
+			form: func(clientID, _, code string) url.Values {
+				return url.Values{"client_id": {clientID}, "code": {code}, "redirect_uri": {"https://app.example.com/other"}, "code_verifier": {verifier}}
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_grant",
+		},
+		{
+			name: "Code of another client",
+			form: func(_, otherClientID, code string) url.Values {
+				return url.Values{"client_id": {otherClientID}, "code": {code}, "redirect_uri": {redirectURI}, "code_verifier": {verifier}}
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_grant",
+		},
+		{
+			name: "Unknown client",
+			form: func(_, _, code string) url.Values {
+				return url.Values{"client_id": {uuid.NewString()}, "code": {code}, "redirect_uri": {redirectURI}, "code_verifier": {verifier}}
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid_client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			o := setupOAuth(t)
+			clientID, _ := o.register(t, false)
+			otherClientID, _ := o.register(t, false)
+			code := o.approve(t, authorizationRequest(clientID, ""))
+			form := tt.form(clientID, otherClientID, code)
+			form.Set("grant_type", "authorization_code")
+
+			// Act
+			recorder := o.form("/oauth/token", form, "", "")
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code, recorder.Body.String())
+			assert.Contains(t, recorder.Body.String(), `"error":"`+tt.expectedError+`"`)
+			assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestCodeReuseRevokesTokens(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	clientID, _ := o.register(t, false)
+	code := o.approve(t, authorizationRequest(clientID, ""))
+	tokens := o.exchange(t, clientID, code)
+
+	// Act
+	reused := o.form("/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}, "", "")
+	read := o.api(http.MethodGet, "/api/notes", tokens.AccessToken, nil)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, reused.Code)
+	assert.Equal(t, http.StatusUnauthorized, read.Code, "Tokens from a reused code must stop working")
+}
+
+func TestRefreshToken(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	clientID, _ := o.register(t, false)
+	tokens := o.exchange(t, clientID, o.approve(t, authorizationRequest(clientID, "notes:read notes:write")))
+	refresh := func(refreshToken, scope string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"refresh_token"}, "client_id": {clientID}, "refresh_token": {refreshToken}}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		return o.form("/oauth/token", form, "", "")
+	}
+
+	// Act
+	narrowed := refresh(tokens.RefreshToken, "notes:read")
+	var refreshed TokenResponse
+	require.NoError(t, json.Unmarshal(narrowed.Body.Bytes(), &refreshed))
+	wider := refresh(refreshed.RefreshToken, "attachments")
+	write := o.api(http.MethodPost, "/api/notes", refreshed.AccessToken, nil)
+	reused := refresh(tokens.RefreshToken, "")
+	afterReuse := o.api(http.MethodGet, "/api/notes", refreshed.AccessToken, nil)
+
+	// Assert
+	require.Equal(t, http.StatusOK, narrowed.Code, narrowed.Body.String())
+	assert.Equal(t, "notes:read", refreshed.Scope)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken, "Refresh tokens rotate")
+	assert.Equal(t, http.StatusBadRequest, wider.Code)
+	assert.Contains(t, wider.Body.String(), "invalid_scope")
+	assert.Equal(t, http.StatusForbidden, write.Code)
+	assert.Equal(t, http.StatusBadRequest, reused.Code)
+	assert.Equal(t, http.StatusUnauthorized, afterReuse.Code, "Reusing a refresh token revokes the grant")
+}
+
+func TestIntrospectAndRevoke(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	clientID, secret := o.register(t, true)
+	otherClientID, otherSecret := o.register(t, true)
+	code := o.approve(t, authorizationRequest(clientID, "notes:read"))
+	exchange := o.form("/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}, clientID, secret)
+	require.Equal(t, http.StatusOK, exchange.Code, exchange.Body.String())
+	var tokens TokenResponse
+	require.NoError(t, json.Unmarshal(exchange.Body.Bytes(), &tokens))
+	introspect := func(token, id, secret string) IntrospectionResponse {
+		recorder := o.form("/oauth/introspect", url.Values{"token": {token}}, id, secret)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response IntrospectionResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response
+	}
+
+	// Act
+	access := introspect(tokens.AccessToken, clientID, secret)
+	refresh := introspect(tokens.RefreshToken, clientID, secret)
+	byOtherClient := introspect(tokens.AccessToken, otherClientID, otherSecret)
+	wrongSecret := o.form("/oauth/introspect", url.Values{"token": {tokens.AccessToken}}, clientID, otherSecret)
+	revokedByOther := o.form("/oauth/revoke", url.Values{"token": {tokens.RefreshToken}}, otherClientID, otherSecret)
+	stillActive := introspect(tokens.AccessToken, clientID, secret)
+	revoked := o.form("/oauth/revoke", url.Values{"token": {tokens.RefreshToken}, "client_id": {clientID}, "client_secret": {secret}}, "", "")
+	afterRevoke := introspect(tokens.AccessToken, clientID, secret)
+	read := o.api(http.MethodGet, "/api/notes", tokens.AccessToken, nil)
+
+	// Assert
+	assert.Equal(t, IntrospectionResponse{
+		Active:    true,
+		Scope:     "notes:read",
+		ClientID:  clientID,
+		Subject:   o.user.ID.String(),
+		Username:  "jane@example.com",
+		TokenType: "Bearer",
+		ExpiresAt: access.ExpiresAt,
+		IssuedAt:  access.IssuedAt,
+	}, access)
+	assert.True(t, refresh.Active)
+	assert.Equal(t, "refresh_token", refresh.TokenType)
+	assert.Equal(t, IntrospectionResponse{Active: false}, byOtherClient, "Clients only learn about their own tokens")
+	assert.Equal(t, http.StatusUnauthorized, wrongSecret.Code)
+	assert.Equal(t, http.StatusOK, revokedByOther.Code)
+	assert.True(t, stillActive.Active, "Clients can't revoke the tokens of others")
+	assert.Equal(t, http.StatusOK, revoked.Code)
+	assert.False(t, afterRevoke.Active, "Revoking the refresh token revokes the access token")
+	assert.Equal(t, http.StatusUnauthorized, read.Code)
+}
+
+func TestRevokeAuthorizedApp(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	clientID, _ := o.register(t, false)
+	tokens := o.exchange(t, clientID, o.approve(t, authorizationRequest(clientID, "notes:read")))
+
+	// Act
+	listed := o.api(http.MethodGet, "/api/oauth/authorizations", o.session, nil)
+	revoked := o.api(http.MethodDelete, "/api/oauth/authorizations/"+clientID, o.session, nil)
+	read := o.api(http.MethodGet, "/api/notes", tokens.AccessToken, nil)
+	again := o.api(http.MethodDelete, "/api/oauth/authorizations/"+clientID, o.session, nil)
+
+	// Assert
+	require.Equal(t, http.StatusOK, listed.Code)
+	var apps []AuthorizationResponse
+	require.NoError(t, json.Unmarshal(listed.Body.Bytes(), &apps))
+	require.Len(t, apps, 1)
+	assert.Equal(t, "Notes Sync", apps[0].ClientName)
+	assert.Equal(t, []users.Scope{users.ScopeNotesRead}, apps[0].Scopes)
+	assert.Equal(t, http.StatusNoContent, revoked.Code)
+	assert.Equal(t, http.StatusUnauthorized, read.Code)
+	assert.Equal(t, http.StatusNotFound, again.Code)
+}
+
+func TestRegisterClient(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        CreateClientRequest
+		expectedStatus int
+	}{
+		{name: "Confidential client", request: CreateClientRequest{Name: "Sync", RedirectURIs: []string{redirectURI}, Scopes: []users.Scope{users.ScopeNotesRead}, Confidential: true}, expectedStatus: http.StatusCreated},
+		{name: "Native app on loopback", request: CreateClientRequest{Name: "CLI", RedirectURIs: []string{"http://127.0.0.1:8765/callback"}, Scopes: []users.Scope{users.ScopeNotesRead}}, expectedStatus: http.StatusCreated},
+		{name: "Plain http", request: CreateClientRequest{Name: "Sync", RedirectURIs: []string{"http://app.example.com/callback"}, Scopes: []users.Scope{users.ScopeNotesRead}}, expectedStatus: http.StatusBadRequest},
+		{name: "Fragment", request: CreateClientRequest{Name: "Sync", RedirectURIs: []string{redirectURI + "#done"}, Scopes: []users.Scope{users.ScopeNotesRead}}, expectedStatus: http.StatusBadRequest},
+		{name: "Admin scope", request: CreateClientRequest{Name: "Sync", RedirectURIs: []string{redirectURI}, Scopes: []users.Scope{users.ScopeAdmin}}, expectedStatus: http.StatusBadRequest},
+		{name: "No redirect URIs", request: CreateClientRequest{Name: "Sync", RedirectURIs: []string{}, Scopes: []users.Scope{users.ScopeNotesRead}}, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			o := setupOAuth(t)
+
+			// Act
+			recorder := o.api(http.MethodPost, "/api/oauth/clients", o.session, tt.request)
+
+			// Assert
+			require.Equal(t, tt.expectedStatus, recorder.Code, recorder.Body.String())
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+			var response CreateClientResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, tt.request.Confidential, response.Secret != "")
+			assert.Equal(t, tt.request.Confidential, response.Confidential)
+			for _, client := range o.repo.clients {
+				assert.Equal(t, o.user.ID, client.OwnerID)
+				if client.SecretHash != nil {
+					assert.NotEqual(t, response.Secret, *client.SecretHash)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeRedirectsToConsentScreen(t *testing.T) {
+	// Arrange
+	o := setupOAuth(t)
+	request := httptest.NewRequest(http.MethodGet, "/oauth/authorize?response_type=code&client_id=abc&state=xyz", nil)
+	recorder := httptest.NewRecorder()
+
+	// Act
+	o.router.ServeHTTP(recorder, request)
+
+	// Assert
+	assert.Equal(t, http.StatusFound, recorder.Code)
+	assert.Equal(t, "https://example.com/oauth/consent?client_id=abc&response_type=code&state=xyz", recorder.Header().Get("Location"))
+}
@@ -0,0 +1,168 @@
+package oauthserver
+
+import (
+	"time"
+
+	"github.com/nantestech/note-api/internal/users"
+)
+
+// AuthorizationRequest is what an app asks for at the authorization
+// endpoint, RFC 6749 section 4.1.1 with PKCE (RFC 7636). The web app
+// passes it on unchanged from the consent screen.
+type AuthorizationRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+type ConsentDecisionRequest struct {
+	AuthorizationRequest
+	Approved bool `json:"approved"`
+}
+
+// TokenRequest is a request to the token endpoint, RFC 6749 sections 4.1.3
+// and 6. Clients may authenticate with HTTP Basic instead of ClientID and
+// ClientSecret.
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// TokenActionRequest is a request to the introspection (RFC 7662) or
+// revocation (RFC 7009) endpoint.
+type TokenActionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// ClientCredentials identify the app calling the token endpoints.
+type ClientCredentials struct {
+	ID     string
+	Secret string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// IntrospectionResponse is RFC 7662 section 2.2. Inactive tokens have
+// nothing but Active.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// MetadataResponse is the authorization server metadata, RFC 8414.
+type MetadataResponse struct {
+	Issuer                            string        `json:"issuer"`
+	AuthorizationEndpoint             string        `json:"authorization_endpoint"`
+	TokenEndpoint                     string        `json:"token_endpoint"`
+	IntrospectionEndpoint             string        `json:"introspection_endpoint"`
+	RevocationEndpoint                string        `json:"revocation_endpoint"`
+	ScopesSupported                   []users.Scope `json:"scopes_supported"`
+	ResponseTypesSupported            []string      `json:"response_types_supported"`
+	GrantTypesSupported               []string      `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string      `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string      `json:"token_endpoint_auth_methods_supported"`
+}
+
+type ScopeResponse struct {
+	Scope       users.Scope `json:"scope"`
+	Description string      `json:"description"`
+}
+
+// ConsentResponse is what the consent screen shows.
+type ConsentResponse struct {
+	ClientID    string          `json:"clientId"`
+	ClientName  string          `json:"clientName"`
+	RedirectURI string          `json:"redirectUri"`
+	Scopes      []ScopeResponse `json:"scopes"`
+	// Consented is true when the user has already allowed these scopes,
+	// so the web app may approve without asking again.
+	Consented bool `json:"consented"`
+}
+
+// RedirectResponse tells the web app where to send the browser next.
+type RedirectResponse struct {
+	RedirectURL string `json:"redirectUrl"`
+}
+
+type CreateClientRequest struct {
+	Name         string        `json:"name" binding:"required,max=100"`
+	RedirectURIs []string      `json:"redirectUris" binding:"required"`
+	Scopes       []users.Scope `json:"scopes" binding:"required"`
+	// Confidential clients get a secret. Apps that can't keep one, such
+	// as mobile and single-page apps, should be public.
+	Confidential bool `json:"confidential"`
+}
+
+type ClientResponse struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	RedirectURIs []string      `json:"redirectUris"`
+	Scopes       []users.Scope `json:"scopes"`
+	Confidential bool          `json:"confidential"`
+	CreatedAt    time.Time     `json:"createdAt"`
+}
+
+// CreateClientResponse is the only response that includes the secret.
+type CreateClientResponse struct {
+	Secret string `json:"secret,omitempty"`
+	ClientResponse
+}
+
+// AuthorizationResponse is an app the user has given access to.
+type AuthorizationResponse struct {
+	ClientID   string        `json:"clientId"`
+	ClientName string        `json:"clientName"`
+	Scopes     []users.Scope `json:"scopes"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
+}
+
+func newClientResponse(client *Client) ClientResponse {
+	return ClientResponse{
+		ID:           client.ID.String(),
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIList(),
+		Scopes:       client.ScopeList(),
+		Confidential: client.IsConfidential(),
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func newConsentResponse(authorization *Authorization) ConsentResponse {
+	scopes := make([]ScopeResponse, 0, len(authorization.Scopes))
+	for _, scope := range authorization.Scopes {
+		scopes = append(scopes, ScopeResponse{Scope: scope, Description: scopeDescriptions[scope]})
+	}
+
+	return ConsentResponse{
+		ClientID:    authorization.Client.ID.String(),
+		ClientName:  authorization.Client.Name,
+		RedirectURI: authorization.RedirectURI,
+		Scopes:      scopes,
+		Consented:   authorization.Consented,
+	}
+}
@@ -0,0 +1,211 @@
+package oauthserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	AddClient(ctx context.Context, client *Client) error
+	GetClient(ctx context.Context, id uuid.UUID) (*Client, error)
+	ListClientsByOwner(ctx context.Context, ownerID uuid.UUID) ([]*Client, error)
+	CountClientsByOwner(ctx context.Context, ownerID uuid.UUID) (int64, error)
+	// DeleteClient removes the owner's client with id, and with it every
+	// grant, and reports whether there was one.
+	DeleteClient(ctx context.Context, ownerID, id uuid.UUID) (bool, error)
+
+	AddCode(ctx context.Context, code *AuthorizationCode) error
+	// ConsumeCode marks the code used and returns it, or returns nil when
+	// it's unknown, used or expired.
+	ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*AuthorizationCode, error)
+	GetCode(ctx context.Context, codeHash string) (*AuthorizationCode, error)
+	SetCodeGrant(ctx context.Context, codeHash string, grantID uuid.UUID) error
+
+	AddGrant(ctx context.Context, grant *Grant) error
+	GetGrant(ctx context.Context, id uuid.UUID) (*Grant, error)
+	RevokeGrant(ctx context.Context, id uuid.UUID, now time.Time) error
+	RevokeGrantsByClient(ctx context.Context, userID, clientID uuid.UUID, now time.Time) error
+
+	AddRefreshToken(ctx context.Context, token *RefreshToken) error
+	// ConsumeRefreshToken marks the token used and returns it, or returns
+	// nil when it's unknown, used or expired.
+	ConsumeRefreshToken(ctx context.Context, tokenHash string, now time.Time) (*RefreshToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+
+	GetConsent(ctx context.Context, userID, clientID uuid.UUID) (*Consent, error)
+	SaveConsent(ctx context.Context, consent *Consent) error
+	ListConsentsByUser(ctx context.Context, userID uuid.UUID) ([]*Consent, error)
+	DeleteConsent(ctx context.Context, userID, clientID uuid.UUID) (bool, error)
+}
+
+type oauthRepository struct {
+	db *gorm.DB
+}
+
+func (r *oauthRepository) AddClient(ctx context.Context, client *Client) error {
+	return r.db.WithContext(ctx).Create(client).Error
+}
+
+func (r *oauthRepository) GetClient(ctx context.Context, id uuid.UUID) (*Client, error) {
+	var client Client
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *oauthRepository) ListClientsByOwner(ctx context.Context, ownerID uuid.UUID) ([]*Client, error) {
+	var clients []*Client
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Order("created_at").Find(&clients).Error
+	return clients, err
+}
+
+func (r *oauthRepository) CountClientsByOwner(ctx context.Context, ownerID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Client{}).Where("owner_id = ?", ownerID).Count(&count).Error
+	return count, err
+}
+
+func (r *oauthRepository) DeleteClient(ctx context.Context, ownerID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Where("id = ? AND owner_id = ?", id, ownerID).Delete(&Client{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *oauthRepository) AddCode(ctx context.Context, code *AuthorizationCode) error {
+	return r.db.WithContext(ctx).Create(code).Error
+}
+
+func (r *oauthRepository) ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*AuthorizationCode, error) {
+	var code AuthorizationCode
+	// A single conditional update, so a code can't be traded twice even
+	// by concurrent requests.
+	result := r.db.WithContext(ctx).Model(&code).
+		Clauses(clause.Returning{}).
+		Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", codeHash, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &code, nil
+}
+
+func (r *oauthRepository) GetCode(ctx context.Context, codeHash string) (*AuthorizationCode, error) {
+	var code AuthorizationCode
+	err := r.db.WithContext(ctx).Where("code_hash = ?", codeHash).First(&code).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r *oauthRepository) SetCodeGrant(ctx context.Context, codeHash string, grantID uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&AuthorizationCode{}).Where("code_hash = ?", codeHash).Update("grant_id", grantID).Error
+}
+
+func (r *oauthRepository) AddGrant(ctx context.Context, grant *Grant) error {
+	return r.db.WithContext(ctx).Create(grant).Error
+}
+
+func (r *oauthRepository) GetGrant(ctx context.Context, id uuid.UUID) (*Grant, error) {
+	var grant Grant
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&grant).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (r *oauthRepository) RevokeGrant(ctx context.Context, id uuid.UUID, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&Grant{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", now).Error
+}
+
+func (r *oauthRepository) RevokeGrantsByClient(ctx context.Context, userID, clientID uuid.UUID, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&Grant{}).
+		Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+		Update("revoked_at", now).Error
+}
+
+func (r *oauthRepository) AddRefreshToken(ctx context.Context, token *RefreshToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *oauthRepository) ConsumeRefreshToken(ctx context.Context, tokenHash string, now time.Time) (*RefreshToken, error) {
+	var token RefreshToken
+	result := r.db.WithContext(ctx).Model(&token).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (r *oauthRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *oauthRepository) GetConsent(ctx context.Context, userID, clientID uuid.UUID) (*Consent, error) {
+	var consent Consent
+	err := r.db.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *oauthRepository) SaveConsent(ctx context.Context, consent *Consent) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "updated_at"}),
+	}).Create(consent).Error
+}
+
+func (r *oauthRepository) ListConsentsByUser(ctx context.Context, userID uuid.UUID) ([]*Consent, error) {
+	var consents []*Consent
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("updated_at DESC").Find(&consents).Error
+	return consents, err
+}
+
+func (r *oauthRepository) DeleteConsent(ctx context.Context, userID, clientID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&Consent{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func NewOAuthRepository(db *gorm.DB) Repository {
+	return &oauthRepository{db: db}
+}
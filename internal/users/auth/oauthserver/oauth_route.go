@@ -0,0 +1,45 @@
+package oauthserver
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+// clientFreshness is how recently the user must have signed in to
+// register an app. API keys and apps have no sign-in time, so they can't.
+const clientFreshness = 10 * time.Minute
+
+// OAuthRoutes registers the endpoints apps call on router, and those the
+// web app calls for the user on the authenticated api group.
+func OAuthRoutes(router *gin.Engine, api *gin.RouterGroup, oauthHandler *OAuthHandler, clientHandler *ClientHandler) {
+
+	router.GET("/.well-known/oauth-authorization-server", oauthHandler.HandleMetadata)
+	oauth := router.Group("/oauth")
+	{
+		oauth.GET("/authorize", oauthHandler.HandleAuthorize)
+		oauth.POST("/token", oauthHandler.HandleToken)
+		oauth.POST("/introspect", oauthHandler.HandleIntrospect)
+		oauth.POST("/revoke", oauthHandler.HandleRevoke)
+	}
+
+	consent := api.Group("/oauth/authorize")
+	{
+		consent.GET("", oauthHandler.HandleConsent)
+		consent.POST("", oauthHandler.HandleConsentDecision)
+	}
+
+	clients := api.Group("/oauth/clients")
+	{
+		clients.GET("", clientHandler.HandleListClients)
+		clients.POST("", middleware.RequireFreshLogin(clientFreshness), clientHandler.HandleCreateClient)
+		clients.DELETE("/:id", clientHandler.HandleDeleteClient)
+	}
+
+	authorizations := api.Group("/oauth/authorizations")
+	{
+		authorizations.GET("", clientHandler.HandleListAuthorizations)
+		authorizations.DELETE("/:clientId", clientHandler.HandleRevokeAuthorization)
+	}
+}
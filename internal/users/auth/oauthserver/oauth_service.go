@@ -0,0 +1,648 @@
+package oauthserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+const (
+	maxClientsPerUser = 10
+	maxRedirectURIs   = 10
+	codeChallengeS256 = "S256"
+	// codeChallengeLength is the length of a base64url SHA-256 hash.
+	codeChallengeLength = 43
+	// RFC 7636 section 4.1 limits code verifiers to 43-128 characters.
+	minVerifierLength = 43
+	maxVerifierLength = 128
+	tokenTypeBearer   = "Bearer"
+	tokenTypeRefresh  = "refresh_token"
+)
+
+var (
+	ErrNoRedirectURIs     = errors.New("at least one redirect URI is required")
+	ErrTooManyRedirects   = fmt.Errorf("at most %d redirect URIs are allowed", maxRedirectURIs)
+	ErrInvalidRedirectURI = errors.New("redirect URIs must use https, or http on a loopback address, and have no fragment")
+	ErrNoScopes           = errors.New("at least one scope is required")
+	ErrInvalidClientScope = errors.New("invalid scope")
+	ErrTooManyClients     = fmt.Errorf("at most %d OAuth clients are allowed", maxClientsPerUser)
+	ErrClientNotFound     = errors.New("OAuth client not found")
+	ErrNotAuthorized      = errors.New("app has no access to this account")
+)
+
+type Config struct {
+	// Issuer is the public base URL of the API, which apps find the
+	// endpoints under.
+	Issuer string
+	// ConsentURL is the web app page that shows the consent screen. The
+	// authorization endpoint sends browsers there with the request.
+	ConsentURL      string
+	CodeTTL         time.Duration
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// Authorization is a valid authorization request, ready for the user's
+// consent.
+type Authorization struct {
+	Client      *Client
+	RedirectURI string
+	Scopes      []users.Scope
+	// Consented is true when the user has already allowed Scopes.
+	Consented bool
+}
+
+// AuthorizedApp is an app that has access to the user's account.
+type AuthorizedApp struct {
+	Client  *Client
+	Consent *Consent
+}
+
+type OAuthService interface {
+	// RegisterClient returns the new client's secret, which can't be
+	// retrieved later and is empty for public clients, and its record.
+	RegisterClient(ctx context.Context, ownerID uuid.UUID, name string, redirectURIs []string, scopes []users.Scope, confidential bool) (string, *Client, error)
+	ListClients(ctx context.Context, ownerID uuid.UUID) ([]*Client, error)
+	DeleteClient(ctx context.Context, ownerID, id uuid.UUID) error
+
+	// Authorize validates request for the consent screen. Errors are
+	// *Error, with a RedirectURI when they should go back to the app.
+	Authorize(ctx context.Context, userID uuid.UUID, request AuthorizationRequest) (*Authorization, error)
+	// Approve records the user's consent to request and returns the code
+	// to send to the app.
+	Approve(ctx context.Context, userID uuid.UUID, request AuthorizationRequest) (string, error)
+	// Exchange trades an authorization code for tokens.
+	Exchange(ctx context.Context, credentials ClientCredentials, code, redirectURI, codeVerifier string) (*TokenResponse, error)
+	// Refresh trades a refresh token for new tokens, narrowed to scope
+	// when it isn't empty.
+	Refresh(ctx context.Context, credentials ClientCredentials, refreshToken, scope string) (*TokenResponse, error)
+	Introspect(ctx context.Context, credentials ClientCredentials, token string) (*IntrospectionResponse, error)
+	// Revoke revokes the grant token belongs to. Unknown tokens and tokens
+	// of other clients are ignored, as RFC 7009 asks.
+	Revoke(ctx context.Context, credentials ClientCredentials, token string) error
+
+	AuthorizedApps(ctx context.Context, userID uuid.UUID) ([]*AuthorizedApp, error)
+	// RevokeApp forgets the user's consent to the app and revokes all of
+	// its tokens.
+	RevokeApp(ctx context.Context, userID, clientID uuid.UUID) error
+	middleware.OAuthTokenVerifier
+}
+
+type oauthService struct {
+	config    Config
+	jwtConfig jwt.Config
+	repo      Repository
+	userRepo  users.Repository
+}
+
+func NewOAuthService(config Config, jwtConfig jwt.Config, repo Repository, userRepo users.Repository) OAuthService {
+	return &oauthService{
+		config:    config,
+		jwtConfig: jwtConfig,
+		repo:      repo,
+		userRepo:  userRepo,
+	}
+}
+
+func (s *oauthService) RegisterClient(ctx context.Context, ownerID uuid.UUID, name string, redirectURIs []string, scopes []users.Scope, confidential bool) (string, *Client, error) {
+	if len(redirectURIs) == 0 {
+		return "", nil, ErrNoRedirectURIs
+	}
+	if len(redirectURIs) > maxRedirectURIs {
+		return "", nil, ErrTooManyRedirects
+	}
+	for _, uri := range redirectURIs {
+		if !isValidRedirectURI(uri) {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidRedirectURI, uri)
+		}
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrNoScopes
+	}
+	for _, scope := range scopes {
+		if !isClientScope(scope) {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidClientScope, scope)
+		}
+	}
+
+	count, err := s.repo.CountClientsByOwner(ctx, ownerID)
+	if err != nil {
+		return "", nil, err
+	}
+	if count >= maxClientsPerUser {
+		return "", nil, ErrTooManyClients
+	}
+
+	client := &Client{
+		ID:           uuid.New(),
+		OwnerID:      ownerID,
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Scopes:       users.FormatScopes(scopes),
+		CreatedAt:    time.Now(),
+	}
+
+	var secret string
+	if confidential {
+		secret, err = newSecret()
+		if err != nil {
+			return "", nil, err
+		}
+		secretHash := hash(secret)
+		client.SecretHash = &secretHash
+	}
+
+	if err := s.repo.AddClient(ctx, client); err != nil {
+		return "", nil, err
+	}
+	return secret, client, nil
+}
+
+// isValidRedirectURI allows https URIs, and http ones on loopback
+// addresses for native apps (RFC 8252 section 7.3).
+func isValidRedirectURI(uri string) bool {
+	if strings.ContainsAny(uri, " \t\r\n") {
+		return false
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" || strings.Contains(uri, "#") {
+		return false
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := parsed.Hostname()
+		ip := net.ParseIP(host)
+		return host == "localhost" || (ip != nil && ip.IsLoopback())
+	default:
+		return false
+	}
+}
+
+func (s *oauthService) ListClients(ctx context.Context, ownerID uuid.UUID) ([]*Client, error) {
+	return s.repo.ListClientsByOwner(ctx, ownerID)
+}
+
+func (s *oauthService) DeleteClient(ctx context.Context, ownerID, id uuid.UUID) error {
+	deleted, err := s.repo.DeleteClient(ctx, ownerID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+func (s *oauthService) Authorize(ctx context.Context, userID uuid.UUID, request AuthorizationRequest) (*Authorization, error) {
+	// Until the redirect URI is known to belong to the client, errors are
+	// shown to the user rather than sent to a URI an attacker may control.
+	client, err := s.getClient(ctx, request.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, oauthError(ErrInvalidRequest, "unknown client_id")
+	}
+	if !client.allowsRedirectURI(request.RedirectURI) {
+		return nil, oauthError(ErrInvalidRequest, "redirect_uri is not registered for this client")
+	}
+
+	redirectURI := request.RedirectURI
+	if request.ResponseType != "code" {
+		return nil, redirectError(ErrUnsupportedResponseType, "response_type must be code", redirectURI)
+	}
+	if request.CodeChallengeMethod != codeChallengeS256 {
+		return nil, redirectError(ErrInvalidRequest, "code_challenge_method must be S256", redirectURI)
+	}
+	if len(request.CodeChallenge) != codeChallengeLength {
+		return nil, redirectError(ErrInvalidRequest, "code_challenge is required", redirectURI)
+	}
+
+	scopes, scopeErr := requestedScopes(request.Scope, client.ScopeList())
+	if scopeErr != nil {
+		scopeErr.RedirectURI = redirectURI
+		return nil, scopeErr
+	}
+
+	consent, err := s.repo.GetConsent(ctx, userID, client.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authorization{
+		Client:      client,
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+		Consented:   consent != nil && consent.covers(scopes),
+	}, nil
+}
+
+// requestedScopes returns the scopes in scope, which must all be allowed,
+// or all of allowed when scope is empty.
+func requestedScopes(scope string, allowed []users.Scope) ([]users.Scope, *Error) {
+	if strings.TrimSpace(scope) == "" {
+		return allowed, nil
+	}
+
+	requested := users.ParseScopes(scope)
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, oauthError(ErrInvalidScope, fmt.Sprintf("scope %q is not allowed", s))
+		}
+	}
+	return slices.Compact(requested), nil
+}
+
+func (s *oauthService) Approve(ctx context.Context, userID uuid.UUID, request AuthorizationRequest) (string, error) {
+	authorization, err := s.Authorize(ctx, userID, request)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = s.repo.AddCode(ctx, &AuthorizationCode{
+		CodeHash:      hash(code),
+		ClientID:      authorization.Client.ID,
+		UserID:        userID,
+		RedirectURI:   authorization.RedirectURI,
+		Scopes:        users.FormatScopes(authorization.Scopes),
+		CodeChallenge: request.CodeChallenge,
+		ExpiresAt:     now.Add(s.config.CodeTTL),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !authorization.Consented {
+		if err := s.addConsent(ctx, userID, authorization.Client.ID, authorization.Scopes); err != nil {
+			return "", err
+		}
+	}
+	return code, nil
+}
+
+// addConsent adds scopes to those the user has allowed the app.
+func (s *oauthService) addConsent(ctx context.Context, userID, clientID uuid.UUID, scopes []users.Scope) error {
+	consent, err := s.repo.GetConsent(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if consent == nil {
+		consent = &Consent{UserID: userID, ClientID: clientID}
+	}
+
+	granted := consent.ScopeList()
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	consent.Scopes = users.FormatScopes(granted)
+	consent.UpdatedAt = time.Now()
+	return s.repo.SaveConsent(ctx, consent)
+}
+
+func (s *oauthService) Exchange(ctx context.Context, credentials ClientCredentials, code, redirectURI, codeVerifier string) (*TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, oauthError(ErrInvalidRequest, "code is required")
+	}
+	if len(codeVerifier) < minVerifierLength || len(codeVerifier) > maxVerifierLength {
+		return nil, oauthError(ErrInvalidRequest, "code_verifier is required")
+	}
+
+	now := time.Now()
+	codeHash := hash(code)
+	authorizationCode, err := s.repo.ConsumeCode(ctx, codeHash, now)
+	if err != nil {
+		return nil, err
+	}
+	if authorizationCode == nil {
+		// A code used twice has leaked, so whatever it was traded for
+		// can't be trusted either (RFC 6749 section 4.1.2).
+		if err := s.revokeReusedCode(ctx, codeHash, now); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(ErrInvalidGrant, "code is invalid, used or expired")
+	}
+
+	if authorizationCode.ClientID != client.ID || authorizationCode.RedirectURI != redirectURI {
+		return nil, oauthError(ErrInvalidGrant, "code was issued to another client or redirect_uri")
+	}
+	if subtle.ConstantTimeCompare([]byte(s256(codeVerifier)), []byte(authorizationCode.CodeChallenge)) != 1 {
+		return nil, oauthError(ErrInvalidGrant, "code_verifier doesn't match code_challenge")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, authorizationCode.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, oauthError(ErrInvalidGrant, "user no longer exists")
+	}
+
+	grant := &Grant{
+		ID:        uuid.New(),
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scopes:    authorizationCode.Scopes,
+		CreatedAt: now,
+	}
+	if err := s.repo.AddGrant(ctx, grant); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetCodeGrant(ctx, codeHash, grant.ID); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, grant, user, grant.ScopeList())
+}
+
+func (s *oauthService) revokeReusedCode(ctx context.Context, codeHash string, now time.Time) error {
+	code, err := s.repo.GetCode(ctx, codeHash)
+	if err != nil || code == nil || code.GrantID == nil {
+		return err
+	}
+	return s.repo.RevokeGrant(ctx, *code.GrantID, now)
+}
+
+func (s *oauthService) Refresh(ctx context.Context, credentials ClientCredentials, refreshToken, scope string) (*TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken == "" {
+		return nil, oauthError(ErrInvalidRequest, "refresh_token is required")
+	}
+
+	now := time.Now()
+	tokenHash := hash(refreshToken)
+	token, err := s.repo.ConsumeRefreshToken(ctx, tokenHash, now)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		if err := s.revokeReusedRefreshToken(ctx, tokenHash, now); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(ErrInvalidGrant, "refresh_token is invalid, used or expired")
+	}
+
+	grant, err := s.repo.GetGrant(ctx, token.GrantID)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || !grant.IsActive() || grant.ClientID != client.ID {
+		return nil, oauthError(ErrInvalidGrant, "refresh_token is invalid, used or expired")
+	}
+
+	// Apps may ask for fewer scopes than they were granted, but never more
+	// (RFC 6749 section 6). The grant keeps them all for the next refresh.
+	scopes, scopeErr := requestedScopes(scope, grant.ScopeList())
+	if scopeErr != nil {
+		return nil, scopeErr
+	}
+
+	user, err := s.userRepo.GetByID(ctx, grant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, oauthError(ErrInvalidGrant, "user no longer exists")
+	}
+
+	return s.issueTokens(ctx, grant, user, scopes)
+}
+
+// revokeReusedRefreshToken revokes the grant of a refresh token that has
+// already been replaced: either the app or an attacker holds a leaked copy.
+func (s *oauthService) revokeReusedRefreshToken(ctx context.Context, tokenHash string, now time.Time) error {
+	token, err := s.repo.GetRefreshToken(ctx, tokenHash)
+	if err != nil || token == nil || token.UsedAt == nil {
+		return err
+	}
+	return s.repo.RevokeGrant(ctx, token.GrantID, now)
+}
+
+// issueTokens issues an access token for scopes and a new refresh token
+// for grant.
+func (s *oauthService) issueTokens(ctx context.Context, grant *Grant, user *users.User, scopes []users.Scope) (*TokenResponse, error) {
+	accessToken, err := jwt.GenerateOAuthAccessToken(s.jwtConfig, user, grant.ClientID.String(), grant.ID, scopes, s.config.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = s.repo.AddRefreshToken(ctx, &RefreshToken{
+		TokenHash: hash(refreshToken),
+		GrantID:   grant.ID,
+		ExpiresAt: now.Add(s.config.RefreshTokenTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int(s.config.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        users.FormatScopes(scopes),
+	}, nil
+}
+
+func (s *oauthService) Introspect(ctx context.Context, credentials ClientCredentials, token string) (*IntrospectionResponse, error) {
+	client, err := s.authenticateClient(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clients only learn about their own tokens, so one can't probe the
+	// tokens of another.
+	inactive := &IntrospectionResponse{Active: false}
+
+	if claims, err := jwt.ValidateOAuthAccessToken(s.jwtConfig, token); err == nil {
+		grant, err := s.grantOf(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if grant == nil || !grant.IsActive() || grant.ClientID != client.ID {
+			return inactive, nil
+		}
+		return &IntrospectionResponse{
+			Active:    true,
+			Scope:     users.FormatScopes(claims.Scopes),
+			ClientID:  claims.ClientID,
+			Subject:   claims.UserID.String(),
+			Username:  claims.Email,
+			TokenType: tokenTypeBearer,
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+		}, nil
+	}
+
+	refreshToken, err := s.repo.GetRefreshToken(ctx, hash(token))
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken == nil || refreshToken.UsedAt != nil || !refreshToken.ExpiresAt.After(time.Now()) {
+		return inactive, nil
+	}
+	grant, err := s.repo.GetGrant(ctx, refreshToken.GrantID)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || !grant.IsActive() || grant.ClientID != client.ID {
+		return inactive, nil
+	}
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     grant.Scopes,
+		ClientID:  grant.ClientID.String(),
+		Subject:   grant.UserID.String(),
+		TokenType: tokenTypeRefresh,
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+	}, nil
+}
+
+func (s *oauthService) Revoke(ctx context.Context, credentials ClientCredentials, token string) error {
+	client, err := s.authenticateClient(ctx, credentials)
+	if err != nil {
+		return err
+	}
+
+	var grant *Grant
+	if claims, err := jwt.ValidateOAuthAccessToken(s.jwtConfig, token); err == nil {
+		grant, err = s.grantOf(ctx, claims)
+		if err != nil {
+			return err
+		}
+	} else {
+		refreshToken, err := s.repo.GetRefreshToken(ctx, hash(token))
+		if err != nil {
+			return err
+		}
+		if refreshToken != nil {
+			grant, err = s.repo.GetGrant(ctx, refreshToken.GrantID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if grant == nil || grant.ClientID != client.ID {
+		return nil
+	}
+	return s.repo.RevokeGrant(ctx, grant.ID, time.Now())
+}
+
+func (s *oauthService) AuthorizedApps(ctx context.Context, userID uuid.UUID) ([]*AuthorizedApp, error) {
+	consents, err := s.repo.ListConsentsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make([]*AuthorizedApp, 0, len(consents))
+	for _, consent := range consents {
+		client, err := s.repo.GetClient(ctx, consent.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		if client != nil {
+			apps = append(apps, &AuthorizedApp{Client: client, Consent: consent})
+		}
+	}
+	return apps, nil
+}
+
+func (s *oauthService) RevokeApp(ctx context.Context, userID, clientID uuid.UUID) error {
+	deleted, err := s.repo.DeleteConsent(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotAuthorized
+	}
+	return s.repo.RevokeGrantsByClient(ctx, userID, clientID, time.Now())
+}
+
+// Verify checks that the grant of an access token hasn't been revoked, so
+// revocation takes effect before the token expires.
+func (s *oauthService) Verify(ctx context.Context, claims *jwt.Claims) error {
+	grant, err := s.grantOf(ctx, claims)
+	if err != nil {
+		return err
+	}
+	if grant == nil || !grant.IsActive() || grant.ClientID.String() != claims.ClientID {
+		return middleware.ErrRevokedOAuthToken
+	}
+	return nil
+}
+
+// grantOf returns the grant an access token was issued for, or nil.
+func (s *oauthService) grantOf(ctx context.Context, claims *jwt.Claims) (*Grant, error) {
+	grantID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, nil
+	}
+	return s.repo.GetGrant(ctx, grantID)
+}
+
+func (s *oauthService) getClient(ctx context.Context, clientID string) (*Client, error) {
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return nil, nil
+	}
+	return s.repo.GetClient(ctx, id)
+}
+
+// authenticateClient checks the secret of confidential clients. Public
+// clients only identify themselves; PKCE stops others using their codes.
+func (s *oauthService) authenticateClient(ctx context.Context, credentials ClientCredentials) (*Client, error) {
+	client, err := s.getClient(ctx, credentials.ID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, oauthError(ErrInvalidClient, "unknown client")
+	}
+
+	if !client.IsConfidential() {
+		if credentials.Secret != "" {
+			return nil, oauthError(ErrInvalidClient, "public clients have no secret")
+		}
+		return client, nil
+	}
+	if credentials.Secret == "" || subtle.ConstantTimeCompare([]byte(hash(credentials.Secret)), []byte(*client.SecretHash)) != 1 {
+		return nil, oauthError(ErrInvalidClient, "invalid client credentials")
+	}
+	return client, nil
+}
@@ -0,0 +1,70 @@
+// Package oidc verifies OpenID Connect ID tokens against a provider's
+// published signing keys.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Discovery is the part of an OpenID provider's configuration document
+// sign-in needs.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// Discover fetches the configuration document of the provider at issuerURL.
+func Discover(ctx context.Context, httpClient *http.Client, issuerURL string) (*Discovery, error) {
+	url := strings.TrimRight(issuerURL, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OpenID configuration: %s", resp.Status)
+	}
+
+	var discovery Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OpenID configuration of %s is incomplete", issuerURL)
+	}
+	if !issuerMatches(discovery.Issuer, strings.TrimRight(issuerURL, "/"), "") {
+		return nil, fmt.Errorf("OpenID configuration issuer %s does not match %s", discovery.Issuer, issuerURL)
+	}
+
+	return &discovery, nil
+}
+
+// issuerMatches compares issuers ignoring a trailing slash. Multi-tenant
+// Microsoft endpoints publish "{tenantid}" in place of the tenant, which
+// is matched against the token's tid claim, or anything during discovery.
+func issuerMatches(expected, actual, tenantID string) bool {
+	expected = strings.TrimRight(expected, "/")
+	actual = strings.TrimRight(actual, "/")
+
+	if prefix, suffix, found := strings.Cut(expected, "{tenantid}"); found {
+		if tenantID != "" {
+			return actual == prefix+tenantID+suffix
+		}
+		return strings.HasPrefix(actual, prefix) && strings.HasSuffix(actual, suffix)
+	}
+	return expected == actual
+}
@@ -0,0 +1,69 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nantestech/note-api/internal/users/auth/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySetRespectsCacheControl(t *testing.T) {
+	tests := []struct {
+		name            string
+		cacheControl    string
+		elapsed         time.Duration
+		expectedFetches int
+	}{
+		{name: "Within max-age", cacheControl: "public, max-age=600, must-revalidate", elapsed: 5 * time.Minute, expectedFetches: 1},
+		{name: "After max-age", cacheControl: "public, max-age=600, must-revalidate", elapsed: 11 * time.Minute, expectedFetches: 2},
+		{name: "Without max-age", cacheControl: "no-transform", elapsed: 30 * time.Minute, expectedFetches: 1},
+		{name: "Tiny max-age is raised", cacheControl: "max-age=1", elapsed: 30 * time.Second, expectedFetches: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := oidctest.NewServer()
+			defer server.Close()
+			server.SetCacheControl(tt.cacheControl)
+			keys := NewKeySet(server.JWKSURL(), http.DefaultClient)
+			now := time.Now()
+			keys.now = func() time.Time { return now }
+			kid := keyID(t, server)
+
+			_, err := keys.Key(context.Background(), kid)
+			require.NoError(t, err)
+
+			// Act
+			now = now.Add(tt.elapsed)
+			_, err = keys.Key(context.Background(), kid)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedFetches, server.JWKSRequests())
+		})
+	}
+}
+
+func TestKeySetUnavailable(t *testing.T) {
+	server := oidctest.NewServer()
+	server.Close()
+	keys := NewKeySet(server.JWKSURL(), http.DefaultClient)
+
+	_, err := keys.Key(context.Background(), "any")
+
+	assert.ErrorIs(t, err, ErrKeysUnavailable)
+}
+
+// keyID returns the ID of the key server signs with.
+func keyID(t *testing.T, server *oidctest.Server) string {
+	t.Helper()
+	token, _, err := new(jwt.Parser).ParseUnverified(server.IDToken(map[string]any{"sub": "user-1"}), jwt.MapClaims{})
+	require.NoError(t, err)
+	return token.Header["kid"].(string)
+}
@@ -0,0 +1,219 @@
+// Package oidctest provides an in-process OpenID Connect provider, so
+// sign-in code can be tested offline.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Server publishes a discovery document and a JWKS with one RSA key,
+// signs ID tokens with it, and exchanges codes issued by IssueCode for
+// ID tokens at its token endpoint.
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	key           *rsa.PrivateKey
+	keyID         string
+	codes         map[string]map[string]any
+	tokenRequests []url.Values
+	jwksRequests  int
+	cacheControl  string
+	jwksStatus    int
+	tokenStatus   int
+}
+
+func NewServer() *Server {
+	s := &Server{codes: make(map[string]map[string]any)}
+	s.key, s.keyID = newKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	mux.HandleFunc("/token", s.handleToken)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Issuer is the issuer URL tokens of this server carry.
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+func (s *Server) JWKSURL() string {
+	return s.URL + "/jwks"
+}
+
+func (s *Server) TokenURL() string {
+	return s.URL + "/token"
+}
+
+// IDToken signs claims. iss, iat and exp are filled in unless given.
+func (s *Server) IDToken(claims map[string]any) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sign(claims)
+}
+
+// IssueCode returns an authorization code the token endpoint exchanges for
+// an ID token with claims.
+func (s *Server) IssueCode(claims map[string]any) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code := fmt.Sprintf("code-%d", len(s.codes)+1)
+	s.codes[code] = claims
+	return code
+}
+
+// RotateKey replaces the signing key, as providers do periodically.
+func (s *Server) RotateKey() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key, s.keyID = newKey()
+}
+
+// TokenRequests returns the forms posted to the token endpoint.
+func (s *Server) TokenRequests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.tokenRequests...)
+}
+
+// SetCacheControl sets the Cache-Control header of JWKS responses.
+func (s *Server) SetCacheControl(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheControl = value
+}
+
+// SetJWKSStatus makes the JWKS endpoint fail with status, as it would
+// during an outage. 0 restores it.
+func (s *Server) SetJWKSStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwksStatus = status
+}
+
+// SetTokenStatus makes the token endpoint fail with status, as it would
+// during an outage. 0 restores it.
+func (s *Server) SetTokenStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenStatus = status
+}
+
+func (s *Server) JWKSRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jwksRequests
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 s.Issuer(),
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.TokenURL(),
+		"jwks_uri":               s.JWKSURL(),
+		"userinfo_endpoint":      s.URL + "/userinfo",
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	s.jwksRequests++
+	key, keyID, cacheControl, status := s.key, s.keyID, s.cacheControl, s.jwksStatus
+	s.mu.Unlock()
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []any{map[string]any{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenRequests = append(s.tokenRequests, r.PostForm)
+	if s.tokenStatus != 0 {
+		http.Error(w, http.StatusText(s.tokenStatus), s.tokenStatus)
+		return
+	}
+
+	claims, ok := s.codes[r.PostForm.Get("code")]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+		return
+	}
+	delete(s.codes, r.PostForm.Get("code"))
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"id_token":     s.sign(claims),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (s *Server) sign(claims map[string]any) string {
+	mapClaims := jwt.MapClaims{
+		"iss": s.Issuer(),
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for key, value := range claims {
+		mapClaims[key] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims)
+	token.Header["kid"] = s.keyID
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func newKey() (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key, fmt.Sprintf("key-%d", time.Now().UnixNano())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
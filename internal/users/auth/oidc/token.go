@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrCodeRejected is returned when the provider refuses the code, for
+	// instance because it was used already or has expired.
+	ErrCodeRejected = errors.New("authorization code was rejected")
+	// ErrProviderUnavailable is returned when the provider can't be
+	// reached or fails to answer.
+	ErrProviderUnavailable = errors.New("identity provider is unavailable")
+)
+
+type TokenRequest struct {
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	// CodeVerifier is the PKCE verifier (RFC 7636) the authorization
+	// request's code_challenge was derived from.
+	CodeVerifier string
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Exchange redeems an authorization code at tokenURL.
+func Exchange(ctx context.Context, httpClient *http.Client, tokenURL string, request TokenRequest) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", request.Code)
+	form.Set("client_id", request.ClientID)
+	if request.ClientSecret != "" {
+		form.Set("client_secret", request.ClientSecret)
+	}
+	if request.RedirectURI != "" {
+		form.Set("redirect_uri", request.RedirectURI)
+	}
+	if request.CodeVerifier != "" {
+		form.Set("code_verifier", request.CodeVerifier)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: failed to exchange code: %s", ErrProviderUnavailable, resp.Status)
+	}
+
+	var token struct {
+		TokenResponse
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("%w: failed to exchange code: %s", ErrProviderUnavailable, resp.Status)
+	}
+	// Some providers, GitHub among them, report errors with a 200 status.
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s %s", ErrCodeRejected, resp.Status, token.Error, token.ErrorDescription)
+	}
+
+	return &token.TokenResponse, nil
+}
@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// clockSkew is how far the provider's clock may be off from ours.
+const clockSkew = time.Minute
+
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Bool accepts both JSON booleans and the strings "true" and "false", as
+// some providers send email_verified as a string.
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = Bool(v)
+	case string:
+		*b = Bool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// IDToken holds the claims of a verified ID token.
+type IDToken struct {
+	Email         string `json:"email"`
+	EmailVerified Bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	TenantID      string `json:"tid"`
+	Nonce         string `json:"nonce"`
+	// EmailDomainOwnerVerified is Microsoft's xms_edov optional claim, true
+	// when the tenant has verified that it owns the email's domain.
+	EmailDomainOwnerVerified Bool `json:"xms_edov"`
+	jwt.RegisteredClaims
+}
+
+// Verifier checks ID tokens issued by one provider for one client. Some
+// providers, Google among them, issue tokens under more than one issuer.
+type Verifier struct {
+	keys     *KeySet
+	issuers  []string
+	clientID string
+	now      func() time.Time
+}
+
+func NewVerifier(keys *KeySet, clientID string, issuers ...string) *Verifier {
+	return &Verifier{
+		keys:     keys,
+		issuers:  issuers,
+		clientID: clientID,
+		now:      time.Now,
+	}
+}
+
+// Verify checks the signature of rawToken and that it was issued by the
+// provider, for this client, and hasn't expired.
+func (v *Verifier) Verify(ctx context.Context, rawToken string) (*IDToken, error) {
+	parser := jwt.Parser{
+		ValidMethods:         []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"},
+		SkipClaimsValidation: true,
+	}
+
+	var token IDToken
+	_, err := parser.ParseWithClaims(rawToken, &token, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		// Tokens can't be judged while the keys can't be fetched.
+		if errors.Is(err, ErrKeysUnavailable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	now := v.now()
+	if token.ExpiresAt == nil || now.After(token.ExpiresAt.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	}
+	if token.IssuedAt != nil && token.IssuedAt.After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: token is issued in the future", ErrInvalidToken)
+	}
+	if !v.issuerMatches(&token) {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidToken, token.Issuer)
+	}
+	if !token.VerifyAudience(v.clientID, true) {
+		return nil, fmt.Errorf("%w: token is not for this client", ErrInvalidToken)
+	}
+	if token.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidToken)
+	}
+
+	return &token, nil
+}
+
+func (v *Verifier) issuerMatches(token *IDToken) bool {
+	for _, issuer := range v.issuers {
+		if issuerMatches(issuer, token.Issuer, token.TenantID) {
+			return true
+		}
+	}
+	return false
+}
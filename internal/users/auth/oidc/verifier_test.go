@@ -0,0 +1,154 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nantestech/note-api/internal/users/auth/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testClientID = "client-123"
+
+func newTestVerifier(server *oidctest.Server) *Verifier {
+	return NewVerifier(NewKeySet(server.JWKSURL(), http.DefaultClient), testClientID, server.Issuer())
+}
+
+func TestVerify(t *testing.T) {
+	server := oidctest.NewServer()
+	defer server.Close()
+	other := oidctest.NewServer()
+	defer other.Close()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "Valid token",
+			token: server.IDToken(map[string]any{"sub": "user-1", "aud": testClientID, "email": "jane@example.com", "email_verified": true}),
+		},
+		{
+			name:    "Wrong audience",
+			token:   server.IDToken(map[string]any{"sub": "user-1", "aud": "someone-else"}),
+			wantErr: true,
+		},
+		{
+			name:    "Wrong issuer",
+			token:   server.IDToken(map[string]any{"sub": "user-1", "aud": testClientID, "iss": "https://evil.example.com"}),
+			wantErr: true,
+		},
+		{
+			name:    "Expired token",
+			token:   server.IDToken(map[string]any{"sub": "user-1", "aud": testClientID, "exp": time.Now().Add(-time.Hour).Unix()}),
+			wantErr: true,
+		},
+		{
+			name:    "Signed by another provider",
+			token:   other.IDToken(map[string]any{"sub": "user-1", "aud": testClientID, "iss": server.Issuer()}),
+			wantErr: true,
+		},
+		{
+			name:    "Missing subject",
+			token:   server.IDToken(map[string]any{"aud": testClientID}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			verifier := newTestVerifier(server)
+
+			// Act
+			token, err := verifier.Verify(context.Background(), tt.token)
+
+			// Assert
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", token.Subject)
+			assert.Equal(t, "jane@example.com", token.Email)
+			assert.True(t, bool(token.EmailVerified))
+		})
+	}
+}
+
+func TestVerifyRefetchesRotatedKeys(t *testing.T) {
+	// Arrange
+	server := oidctest.NewServer()
+	defer server.Close()
+	verifier := newTestVerifier(server)
+	claims := map[string]any{"sub": "user-1", "aud": testClientID}
+	_, err := verifier.Verify(context.Background(), server.IDToken(claims))
+	require.NoError(t, err)
+
+	// Act
+	server.RotateKey()
+	verifier.keys.fetchedAt = time.Now().Add(-2 * minRefreshInterval)
+	_, err = verifier.Verify(context.Background(), server.IDToken(claims))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.JWKSRequests())
+}
+
+func TestVerifyDoesNotRefetchForEveryUnknownKey(t *testing.T) {
+	// Arrange
+	server := oidctest.NewServer()
+	defer server.Close()
+	other := oidctest.NewServer()
+	defer other.Close()
+	verifier := newTestVerifier(server)
+	_, err := verifier.Verify(context.Background(), server.IDToken(map[string]any{"sub": "user-1", "aud": testClientID}))
+	require.NoError(t, err)
+
+	// Act
+	for i := 0; i < 3; i++ {
+		_, err = verifier.Verify(context.Background(), other.IDToken(map[string]any{"sub": "user-1", "aud": testClientID, "iss": server.Issuer()}))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	}
+
+	// Assert
+	assert.Equal(t, 1, server.JWKSRequests())
+}
+
+func TestIssuerMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		tenantID string
+		matches  bool
+	}{
+		{name: "Same issuer", expected: "https://idp.example.com", actual: "https://idp.example.com", matches: true},
+		{name: "Trailing slash", expected: "https://idp.example.com/", actual: "https://idp.example.com", matches: true},
+		{name: "Different issuer", expected: "https://idp.example.com", actual: "https://other.example.com", matches: false},
+		{
+			name:     "Tenant placeholder with matching tid",
+			expected: "https://login.microsoftonline.com/{tenantid}/v2.0",
+			actual:   "https://login.microsoftonline.com/tenant-1/v2.0",
+			tenantID: "tenant-1",
+			matches:  true,
+		},
+		{
+			name:     "Tenant placeholder with other tid",
+			expected: "https://login.microsoftonline.com/{tenantid}/v2.0",
+			actual:   "https://login.microsoftonline.com/tenant-1/v2.0",
+			tenantID: "tenant-2",
+			matches:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.matches, issuerMatches(tt.expected, tt.actual, tt.tenantID))
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachChecker tells whether a password appeared in a known data breach.
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// rangeChecker looks passwords up in a local copy of the Pwned Passwords
+// range files: one file per five-character SHA-1 prefix, named
+// <PREFIX>.txt, holding the SUFFIX:COUNT lines the range API returns for
+// it. Only the file for the password's prefix is read, and passwords never
+// leave the server.
+type rangeChecker struct {
+	dir string
+}
+
+func NewRangeChecker(dir string) BreachChecker {
+	return &rangeChecker{dir: dir}
+}
+
+func (c *rangeChecker) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padded range files list suffixes that were never breached with a
+		// count of zero.
+		if strings.EqualFold(line, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+type noBreachChecker struct{}
+
+// NoBreachChecker is used when no range files are configured.
+func NoBreachChecker() BreachChecker {
+	return noBreachChecker{}
+}
+
+func (noBreachChecker) Breached(string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,157 @@
+package password
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
+)
+
+// providerName is the provider reported in the auth responses of password
+// sign-ins.
+const providerName = "password"
+
+type PasswordHandler struct {
+	passwordService PasswordService
+	tokenIssuer     mfa.TokenIssuer
+}
+
+func NewPasswordHandler(passwordService PasswordService, tokenIssuer mfa.TokenIssuer) *PasswordHandler {
+	return &PasswordHandler{
+		passwordService: passwordService,
+		tokenIssuer:     tokenIssuer,
+	}
+}
+
+func (h *PasswordHandler) HandleRegister(c *gin.Context) {
+	var request RegisterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.passwordService.Register(c.Request.Context(), Registration{
+		FirstName: request.FirstName,
+		LastName:  request.LastName,
+		Email:     request.Email,
+		Password:  request.Password,
+	})
+	if err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, RegisterResponse{UserId: user.ID.String(), Email: user.Email})
+}
+
+func (h *PasswordHandler) HandleLogin(c *gin.Context) {
+	var request LoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.passwordService.Login(c.Request.Context(), request.Email, request.Password)
+	if err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	h.respondWithToken(c, user)
+}
+
+func (h *PasswordHandler) HandleResendVerification(c *gin.Context) {
+	var request EmailRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordService.SendVerification(c.Request.Context(), request.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// HandleVerifyEmail is the target of the link in verification emails.
+func (h *PasswordHandler) HandleVerifyEmail(c *gin.Context) {
+	user, err := h.passwordService.VerifyEmail(c.Request.Context(), c.Query("token"))
+	if err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"email": user.Email, "verified": true})
+}
+
+func (h *PasswordHandler) HandleForgotPassword(c *gin.Context) {
+	var request EmailRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordService.RequestReset(c.Request.Context(), request.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+func (h *PasswordHandler) HandleResetPassword(c *gin.Context) {
+	var request ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.passwordService.ResetPassword(c.Request.Context(), request.Token, request.Password)
+	if err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	h.respondWithToken(c, user)
+}
+
+func (h *PasswordHandler) respondWithToken(c *gin.Context, user *users.User) {
+	token, challenge, err := h.tokenIssuer.Issue(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, auth.AuthResponse{
+		Token:     token,
+		UserId:    user.ID.String(),
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Provider:  providerName,
+	})
+}
+
+func respondPasswordError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrPasswordTooShort), errors.Is(err, ErrPasswordTooLong), errors.Is(err, ErrPasswordBreached), errors.Is(err, ErrInvalidToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
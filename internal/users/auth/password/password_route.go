@@ -0,0 +1,16 @@
+package password
+
+import "github.com/gin-gonic/gin"
+
+func PasswordRoutes(router *gin.Engine, passwordHandler *PasswordHandler) {
+
+	password := router.Group("/auth/password")
+	{
+		password.POST("/register", passwordHandler.HandleRegister)
+		password.POST("/login", passwordHandler.HandleLogin)
+		password.GET("/verify", passwordHandler.HandleVerifyEmail)
+		password.POST("/verify/resend", passwordHandler.HandleResendVerification)
+		password.POST("/forgot", passwordHandler.HandleForgotPassword)
+		password.POST("/reset", passwordHandler.HandleResetPassword)
+	}
+}
@@ -0,0 +1,319 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nantestech/note-api/internal/mail"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+const (
+	// maxPasswordLength bounds the work a single login can cause.
+	maxPasswordLength = 256
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrEmailNotVerified   = errors.New("email is not verified")
+	ErrEmailTaken         = errors.New("an account with this email already exists")
+	ErrPasswordTooShort   = errors.New("password is too short")
+	ErrPasswordTooLong    = errors.New("password is too long")
+	ErrPasswordBreached   = errors.New("password appeared in a data breach; choose another one")
+	ErrInvalidToken       = errors.New("link is invalid or has expired")
+)
+
+type Config struct {
+	Params    Params
+	MinLength int
+	// VerificationTTL and ResetTTL are how long verification and reset
+	// links work.
+	VerificationTTL time.Duration
+	ResetTTL        time.Duration
+	// BaseURL is where this API is served, for verification links.
+	// ResetURL is the page that asks for the new password; the reset
+	// token is added to it as the token parameter.
+	BaseURL  string
+	ResetURL string
+	Locale   string
+}
+
+type Registration struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Password  string
+}
+
+// PasswordService signs users in with an email and a password. Addresses
+// have to be verified before they can sign in.
+type PasswordService interface {
+	Register(ctx context.Context, registration Registration) (*users.User, error)
+	Login(ctx context.Context, email, password string) (*users.User, error)
+	SendVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) (*users.User, error)
+	RequestReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) (*users.User, error)
+}
+
+type passwordService struct {
+	config    Config
+	userRepo  users.Repository
+	tokenRepo ResetTokenRepository
+	hasher    *Hasher
+	breaches  BreachChecker
+	signer    *verificationSigner
+	outbox    mail.OutboxService
+	renderer  mail.Renderer
+	// dummyHash is verified against for unknown emails, so that a login
+	// takes as long whether or not the account exists.
+	dummyHash string
+}
+
+func NewPasswordService(config Config, secret string, userRepo users.Repository, tokenRepo ResetTokenRepository, breaches BreachChecker, outbox mail.OutboxService, renderer mail.Renderer) (PasswordService, error) {
+	hasher := NewHasher(config.Params)
+	dummyHash, err := hasher.Hash("not a password")
+	if err != nil {
+		return nil, err
+	}
+
+	return &passwordService{
+		config:    config,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		hasher:    hasher,
+		breaches:  breaches,
+		signer:    newVerificationSigner(secret),
+		outbox:    outbox,
+		renderer:  renderer,
+		dummyHash: dummyHash,
+	}, nil
+}
+
+func (s *passwordService) Register(ctx context.Context, registration Registration) (*users.User, error) {
+	email := normalizeEmail(registration.Email)
+	if err := s.checkPassword(registration.Password); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.userRepo.ExistsByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrEmailTaken
+	}
+
+	hash, err := s.hasher.Hash(registration.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := users.NewUser(registration.FirstName, registration.LastName, email)
+	user.SetPasswordHash(hash)
+	if err := s.userRepo.Add(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.sendVerification(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *passwordService) Login(ctx context.Context, email, password string) (*users.User, error) {
+	if len(password) > maxPasswordLength {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.HasPassword() {
+		_, _, _ = s.hasher.Verify(password, s.dummyHash)
+		return nil, ErrInvalidCredentials
+	}
+
+	match, rehash, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.IsEmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
+
+	if rehash {
+		if hash, err := s.hasher.Hash(password); err == nil {
+			user.SetPasswordHash(hash)
+			if err := s.userRepo.Update(ctx, user); err != nil {
+				log.Printf("Failed to rehash password of user %s: %v", user.ID, err)
+			}
+		}
+	}
+
+	return user, nil
+}
+
+// SendVerification sends a new verification link to an unverified
+// password account. It does nothing for other emails, and doesn't say so.
+func (s *passwordService) SendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.HasPassword() || user.IsEmailVerified() {
+		return nil
+	}
+	return s.sendVerification(ctx, user)
+}
+
+func (s *passwordService) VerifyEmail(ctx context.Context, token string) (*users.User, error) {
+	userID, email, err := s.signer.Verify(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Email != email {
+		return nil, ErrInvalidToken
+	}
+
+	if !user.IsEmailVerified() {
+		user.MarkEmailVerified()
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// RequestReset emails a reset link to any account with the email,
+// including ones that only signed in with a provider so far. It doesn't
+// say whether the account exists.
+func (s *passwordService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	token, record, err := newResetToken(user.ID, s.config.ResetTTL)
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.Add(ctx, record); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(s.config.ResetURL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	content, err := s.renderer.Render(mail.TemplatePasswordReset, s.config.Locale, mail.PasswordResetData{
+		Name:         user.FirstName,
+		Link:         link.String(),
+		ValidMinutes: int(s.config.ResetTTL.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.outbox.Enqueue(ctx, &user.ID, mail.Message{
+		To:      user.Email,
+		Subject: content.Subject,
+		Text:    content.Text,
+		HTML:    content.HTML,
+	})
+}
+
+// ResetPassword sets the password of the token's user. Following the link
+// proves the user reads the address, so it's verified too.
+func (s *passwordService) ResetPassword(ctx context.Context, token, password string) (*users.User, error) {
+	// Check first, so that a rejected password doesn't spend the token.
+	if err := s.checkPassword(password); err != nil {
+		return nil, err
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *users.User
+	err = s.tokenRepo.Consume(ctx, hashToken(token), time.Now(), func(record *ResetToken) error {
+		user, err = s.userRepo.GetByID(ctx, record.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrInvalidToken
+		}
+
+		user.SetPasswordHash(hash)
+		user.MarkEmailVerified()
+		return s.userRepo.Update(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *passwordService) checkPassword(password string) error {
+	if utf8.RuneCountInString(password) < s.config.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrPasswordTooShort, s.config.MinLength)
+	}
+	if len(password) > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	breached, err := s.breaches.Breached(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+func (s *passwordService) sendVerification(ctx context.Context, user *users.User) error {
+	token := s.signer.Token(user.ID, user.Email, time.Now().Add(s.config.VerificationTTL))
+
+	content, err := s.renderer.Render(mail.TemplateVerifyEmail, s.config.Locale, mail.VerifyEmailData{
+		Name: user.FirstName,
+		Link: strings.TrimRight(s.config.BaseURL, "/") + "/auth/password/verify?token=" + url.QueryEscape(token),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.outbox.Enqueue(ctx, &user.ID, mail.Message{
+		To:      user.Email,
+		Subject: content.Subject,
+		Text:    content.Text,
+		HTML:    content.HTML,
+	})
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
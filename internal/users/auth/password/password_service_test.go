@@ -0,0 +1,285 @@
+package password
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/mail"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testParams = Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+type mockResetTokenRepository struct {
+	tokens map[string]*ResetToken
+}
+
+func (m *mockResetTokenRepository) Add(_ context.Context, token *ResetToken) error {
+	m.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *mockResetTokenRepository) Consume(_ context.Context, tokenHash string, now time.Time, apply func(token *ResetToken) error) error {
+	token := m.tokens[tokenHash]
+	if token == nil || token.UsedAt != nil || !token.ExpiresAt.After(now) {
+		return ErrInvalidToken
+	}
+	if err := apply(token); err != nil {
+		return err
+	}
+	for _, other := range m.tokens {
+		if other.UserID == token.UserID && other.UsedAt == nil {
+			other.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// fakeOutbox keeps enqueued messages instead of sending them
+type fakeOutbox struct {
+	messages []mail.Message
+}
+
+func (o *fakeOutbox) Enqueue(_ context.Context, _ *uuid.UUID, message mail.Message) error {
+	o.messages = append(o.messages, message)
+	return nil
+}
+
+func (o *fakeOutbox) DispatchDue(context.Context) (int, error) { return 0, nil }
+
+func (o *fakeOutbox) Run(context.Context) {}
+
+// lastToken returns the token parameter of the link in the last message.
+func (o *fakeOutbox) lastToken(t *testing.T) string {
+	t.Helper()
+	require.NotEmpty(t, o.messages)
+	link := regexp.MustCompile(`https?://\S+`).FindString(o.messages[len(o.messages)-1].Text)
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+	return parsed.Query().Get("token")
+}
+
+type serviceTest struct {
+	service  PasswordService
+	userRepo *userstest.UserRepository
+	tokens   *mockResetTokenRepository
+	outbox   *fakeOutbox
+}
+
+func setupService(t *testing.T, breaches BreachChecker) *serviceTest {
+	t.Helper()
+	renderer, err := mail.NewTemplateRenderer("en")
+	require.NoError(t, err)
+
+	st := &serviceTest{
+		userRepo: userstest.NewUserRepository(),
+		tokens:   &mockResetTokenRepository{tokens: make(map[string]*ResetToken)},
+		outbox:   &fakeOutbox{},
+	}
+	st.service, err = NewPasswordService(Config{
+		Params:          testParams,
+		MinLength:       8,
+		VerificationTTL: time.Hour,
+		ResetTTL:        30 * time.Minute,
+		BaseURL:         "http://localhost:8080",
+		ResetURL:        "http://localhost:3000/reset-password",
+		Locale:          "en",
+	}, "secret", st.userRepo, st.tokens, breaches, st.outbox, renderer)
+	require.NoError(t, err)
+	return st
+}
+
+func TestHasherRehashesWeakerHashes(t *testing.T) {
+	// Arrange
+	weak := NewHasher(testParams)
+	strong := NewHasher(Params{Memory: 128, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hash, err := weak.Hash("correct horse")
+	require.NoError(t, err)
+
+	// Act
+	match, rehash, err := strong.Verify("correct horse", hash)
+	wrong, _, _ := strong.Verify("wrong horse", hash)
+	_, _, malformedErr := strong.Verify("correct horse", "$2a$10$bcrypt")
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"))
+	assert.True(t, match)
+	assert.True(t, rehash)
+	assert.False(t, wrong)
+	assert.ErrorIs(t, malformedErr, ErrInvalidHash)
+}
+
+func TestRangeChecker(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("password123"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	ranges := "0018A45C4D1DEF81644B54AB7F969B88D65:1\n" + hash[5:] + ":251682\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(ranges), 0o600))
+	checker := NewRangeChecker(dir)
+
+	// Act
+	breached, err := checker.Breached("password123")
+	safe, safeErr := checker.Breached("a perfectly unique passphrase")
+
+	// Assert
+	require.NoError(t, err)
+	require.NoError(t, safeErr)
+	assert.True(t, breached)
+	assert.False(t, safe)
+}
+
+func TestRegisterVerifyAndLogin(t *testing.T) {
+	// Arrange
+	st := setupService(t, NoBreachChecker())
+	ctx := context.Background()
+
+	// Act & Assert: registration sends a verification link
+	user, err := st.service.Register(ctx, Registration{FirstName: "Jane", Email: " Jane@Example.com ", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.NotContains(t, user.PasswordHash, "correct horse")
+	require.Len(t, st.outbox.messages, 1)
+
+	// Act & Assert: the email has to be verified first
+	_, err = st.service.Login(ctx, "jane@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	_, err = st.service.VerifyEmail(ctx, st.outbox.lastToken(t))
+	require.NoError(t, err)
+
+	// Act & Assert: login
+	loggedIn, err := st.service.Login(ctx, "JANE@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+
+	_, err = st.service.Login(ctx, "jane@example.com", "wrong horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = st.service.Login(ctx, "nobody@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Act & Assert: the email can't be registered twice
+	_, err = st.service.Register(ctx, Registration{FirstName: "Eve", Email: "jane@example.com", Password: "another password"})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+}
+
+func TestRegisterRejectsWeakPasswords(t *testing.T) {
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("password123"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(hash[5:]+":3\n"), 0o600))
+
+	tests := []struct {
+		name        string
+		password    string
+		expectedErr error
+	}{
+		{name: "Too short", password: "short", expectedErr: ErrPasswordTooShort},
+		{name: "Too long", password: strings.Repeat("a", maxPasswordLength+1), expectedErr: ErrPasswordTooLong},
+		{name: "Breached", password: "password123", expectedErr: ErrPasswordBreached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			st := setupService(t, NewRangeChecker(dir))
+
+			// Act
+			_, err := st.service.Register(context.Background(), Registration{FirstName: "Jane", Email: "jane@example.com", Password: tt.password})
+
+			// Assert
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Empty(t, st.userRepo.Users)
+		})
+	}
+}
+
+func TestVerifyEmailRejectsTokens(t *testing.T) {
+	// Arrange
+	st := setupService(t, NoBreachChecker())
+	user, err := st.service.Register(context.Background(), Registration{FirstName: "Jane", Email: "jane@example.com", Password: "correct horse"})
+	require.NoError(t, err)
+	signer := newVerificationSigner("secret")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "Expired", token: signer.Token(user.ID, user.Email, time.Now().Add(-time.Minute))},
+		{name: "For an older email", token: signer.Token(user.ID, "old@example.com", time.Now().Add(time.Hour))},
+		{name: "Signed with another secret", token: newVerificationSigner("other").Token(user.ID, user.Email, time.Now().Add(time.Hour))},
+		{name: "Garbage", token: "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := st.service.VerifyEmail(context.Background(), tt.token)
+
+			// Assert
+			assert.ErrorIs(t, err, ErrInvalidToken)
+			assert.False(t, user.IsEmailVerified())
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	// Arrange: a user who so far only signed in with Google
+	st := setupService(t, NoBreachChecker())
+	ctx := context.Background()
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	st.userRepo.Users[user.ID] = user
+
+	require.NoError(t, st.service.RequestReset(ctx, "nobody@example.com"))
+	assert.Empty(t, st.outbox.messages, "Unknown emails get no mail")
+
+	require.NoError(t, st.service.RequestReset(ctx, "jane@example.com"))
+	token := st.outbox.lastToken(t)
+
+	// Act
+	_, weakErr := st.service.ResetPassword(ctx, token, "short")
+	resetUser, err := st.service.ResetPassword(ctx, token, "new password")
+	_, reuseErr := st.service.ResetPassword(ctx, token, "newer password")
+
+	// Assert
+	assert.ErrorIs(t, weakErr, ErrPasswordTooShort, "A rejected password doesn't spend the token")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, resetUser.ID)
+	assert.True(t, user.IsEmailVerified())
+	assert.ErrorIs(t, reuseErr, ErrInvalidToken)
+
+	loggedIn, err := st.service.Login(ctx, "jane@example.com", "new password")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+}
+
+func TestResetTokenExpires(t *testing.T) {
+	// Arrange
+	st := setupService(t, NoBreachChecker())
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	st.userRepo.Users[user.ID] = user
+	require.NoError(t, st.service.RequestReset(context.Background(), "jane@example.com"))
+	for _, record := range st.tokens.tokens {
+		record.ExpiresAt = time.Now().Add(-time.Second)
+	}
+
+	// Act
+	_, err := st.service.ResetPassword(context.Background(), st.outbox.lastToken(t), "new password")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.False(t, user.HasPassword())
+}
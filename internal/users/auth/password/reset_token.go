@@ -0,0 +1,47 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResetToken lets the holder of a password reset link set a new password
+// once before it expires. Only the token's hash is stored.
+type ResetToken struct {
+	TokenHash string `gorm:"primaryKey"`
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (ResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// newResetToken returns the token to send to the user and its record.
+func newResetToken(userID uuid.UUID, ttl time.Duration) (string, *ResetToken, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	return token, &ResetToken{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
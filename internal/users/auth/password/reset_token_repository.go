@@ -0,0 +1,57 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ResetTokenRepository interface {
+	Add(ctx context.Context, token *ResetToken) error
+	Consume(ctx context.Context, tokenHash string, now time.Time, apply func(token *ResetToken) error) error
+}
+
+type resetTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *resetTokenRepository) Add(ctx context.Context, token *ResetToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// Consume marks the token used and calls apply in the same transaction, so
+// the token stays usable when apply fails. Every other reset token of the
+// user is spent along with it.
+func (r *resetTokenRepository) Consume(ctx context.Context, tokenHash string, now time.Time, apply func(token *ResetToken) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var token ResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).First(&token).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		if token.UsedAt != nil || !token.ExpiresAt.After(now) {
+			return ErrInvalidToken
+		}
+
+		err = tx.Model(&ResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		token.UsedAt = &now
+
+		return apply(&token)
+	})
+}
+
+func NewResetTokenRepository(db *gorm.DB) ResetTokenRepository {
+	return &resetTokenRepository{db: db}
+}
@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	"github.com/nantestech/note-api/internal/users/auth/oidc"
+	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
+)
+
+type AuthHandler struct {
+	authService AuthService
+	tokenIssuer mfa.TokenIssuer
+}
+
+func NewAuthHandler(authService AuthService, tokenIssuer mfa.TokenIssuer) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+		tokenIssuer: tokenIssuer,
+	}
+}
+
+func createAuthResponse(token string, identity *Identity, user *users.User) auth.AuthResponse {
+	return auth.AuthResponse{
+		Token:          token,
+		UserId:         user.ID.String(),
+		FirstName:      user.FirstName,
+		LastName:       user.LastName,
+		Email:          user.Email,
+		ProfilePicture: identity.Picture,
+		Provider:       identity.Provider,
+	}
+}
+
+func (h *AuthHandler) HandleSignIn(c *gin.Context) {
+	credentials := Credentials{
+		Code:        c.Query("code"),
+		IDToken:     c.Query("id_token"),
+		RedirectURI: c.Query("redirect_uri"),
+	}
+	if credentials.Code == "" && credentials.IDToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code parameter"})
+		return
+	}
+
+	user, identity, err := h.authService.SignIn(c.Request.Context(), c.Param("provider"), credentials)
+	if err != nil {
+		RespondAuthError(c, err)
+		return
+	}
+
+	token, challenge, err := h.tokenIssuer.Issue(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, createAuthResponse(token, identity, user))
+}
+
+// RespondAuthError maps errors from signing in or linking with a provider,
+// for every handler that does either.
+func RespondAuthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrMissingCredentials):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, oidc.ErrInvalidToken), errors.Is(err, ErrNonceMismatch), errors.Is(err, oidc.ErrCodeRejected):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAccountExists), errors.Is(err, ErrIdentityLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, oidc.ErrProviderUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	case errors.Is(err, oidc.ErrKeysUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
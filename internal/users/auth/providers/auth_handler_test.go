@@ -0,0 +1,174 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/auth/mfa"
+	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider returns its identity for the code "valid"
+type fakeProvider struct {
+	name     string
+	identity Identity
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Authenticate(_ context.Context, credentials Credentials) (*Identity, error) {
+	if credentials.Code != "valid" {
+		return nil, ErrMissingCredentials
+	}
+	identity := p.identity
+	identity.Provider = p.name
+	return &identity, nil
+}
+
+func setupRouter(t *testing.T, providers ...Provider) (*gin.Engine, *userstest.UserRepository) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	userRepo := userstest.NewUserRepository()
+	handler := NewAuthHandler(NewAuthService(NewRegistry(providers...), userRepo, userstest.NewIdentityRepository(), PasswordSignIn(userRepo)), mfa.NewTokenIssuer(jwt.Config{SecretKey: "secret", ExpiresInHours: 1}, userstest.NoMFA{}))
+	router := gin.New()
+	AuthRoutes(router, handler)
+	return router, userRepo
+}
+
+func TestHandleSignIn(t *testing.T) {
+	github := &fakeProvider{name: "github", identity: Identity{Subject: "42", Email: "mona@example.com", EmailVerified: true, GivenName: "Mona", Picture: "https://avatars.test/42"}}
+	unverified := &fakeProvider{name: "acme", identity: Identity{Subject: "1", Email: "jane@example.com"}}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Signs in with the provider in the path", path: "/auth/github?code=valid", expectedStatus: http.StatusOK},
+		{name: "Unknown provider", path: "/auth/myspace?code=valid", expectedStatus: http.StatusNotFound},
+		{name: "Missing code", path: "/auth/github", expectedStatus: http.StatusBadRequest},
+		{name: "Unverified email", path: "/auth/acme?code=valid", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, userRepo := setupRouter(t, github, unverified)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.Empty(t, userRepo.Users)
+				return
+			}
+
+			var response auth.AuthResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, "github", response.Provider)
+			assert.Equal(t, "mona@example.com", response.Email)
+			assert.Equal(t, "https://avatars.test/42", response.ProfilePicture)
+			assert.NotEmpty(t, response.Token)
+			assert.Len(t, userRepo.Users, 1)
+		})
+	}
+}
+
+func TestSignInMatchesIdentities(t *testing.T) {
+	existing := users.NewUser("Mona", "Octocat", "mona@example.com")
+
+	tests := []struct {
+		name        string
+		provider    string
+		identity    Identity
+		linked      []*users.Identity
+		hasPassword bool
+		expectedErr error
+		expectNew   bool
+	}{
+		{
+			name:     "Finds the user by subject after an email change",
+			provider: "github",
+			identity: Identity{Subject: "42", Email: "new@example.com"},
+			linked:   []*users.Identity{users.NewIdentity(existing.ID, "github", "42", "mona@example.com")},
+		},
+		{
+			name:     "Links a legacy Google account by verified email",
+			provider: "google",
+			identity: Identity{Subject: "g-1", Email: "mona@example.com", EmailVerified: true},
+		},
+		{
+			name:        "Refuses another provider with the same email",
+			provider:    "github",
+			identity:    Identity{Subject: "42", Email: "mona@example.com", EmailVerified: true},
+			expectedErr: ErrAccountExists,
+		},
+		{
+			name:        "Refuses a second Google account with the same email",
+			provider:    "google",
+			identity:    Identity{Subject: "g-2", Email: "mona@example.com", EmailVerified: true},
+			linked:      []*users.Identity{users.NewIdentity(existing.ID, "google", "g-1", "mona@example.com")},
+			expectedErr: ErrAccountExists,
+		},
+		{
+			name:        "Refuses Google for a password account with the same email",
+			provider:    "google",
+			identity:    Identity{Subject: "g-1", Email: "mona@example.com", EmailVerified: true},
+			hasPassword: true,
+			expectedErr: ErrAccountExists,
+		},
+		{
+			name:      "Creates a user for a new email",
+			provider:  "github",
+			identity:  Identity{Subject: "7", Email: "octo@example.com", EmailVerified: true},
+			expectNew: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			existing.PasswordHash = ""
+			if tt.hasPassword {
+				existing.SetPasswordHash("$argon2id$hash")
+			}
+			userRepo := userstest.NewUserRepository(existing)
+			identityRepo := userstest.NewIdentityRepository()
+			for _, identity := range tt.linked {
+				identityRepo.Identities[identity.ID] = identity
+			}
+			service := NewAuthService(NewRegistry(&fakeProvider{name: tt.provider, identity: tt.identity}), userRepo, identityRepo, PasswordSignIn(userRepo))
+
+			// Act
+			user, _, err := service.SignIn(context.Background(), tt.provider, Credentials{Code: "valid"})
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expectNew {
+				assert.NotEqual(t, existing.ID, user.ID)
+			} else {
+				assert.Equal(t, existing.ID, user.ID)
+			}
+			linked, _ := identityRepo.GetByProviderSubject(context.Background(), tt.provider, tt.identity.Subject)
+			require.NotNil(t, linked)
+			assert.Equal(t, user.ID, linked.UserID)
+			assert.Equal(t, tt.identity.Email, linked.Email)
+		})
+	}
+}
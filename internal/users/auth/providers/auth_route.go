@@ -0,0 +1,32 @@
+package providers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+// identityFreshness is how recently the user must have signed in to link
+// or unlink an identity.
+const identityFreshness = 10 * time.Minute
+
+func AuthRoutes(router *gin.Engine, authHandler *AuthHandler) {
+
+	auth := router.Group("/auth")
+	{
+		auth.GET("/:provider", authHandler.HandleSignIn)
+	}
+}
+
+// IdentityRoutes registers the identity endpoints on the authenticated
+// api group.
+func IdentityRoutes(api *gin.RouterGroup, identityHandler *IdentityHandler) {
+
+	identities := api.Group("/auth/identities")
+	{
+		identities.GET("", identityHandler.HandleListIdentities)
+		identities.POST("/:provider", middleware.RequireFreshLogin(identityFreshness), identityHandler.HandleLinkIdentity)
+		identities.DELETE("/:id", middleware.RequireFreshLogin(identityFreshness), identityHandler.HandleUnlinkIdentity)
+	}
+}
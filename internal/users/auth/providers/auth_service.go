@@ -0,0 +1,201 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+var (
+	ErrAccountExists    = errors.New("an account with this email already exists; sign in and link this provider instead")
+	ErrIdentityLinked   = errors.New("this sign-in is already linked to another account")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrLastIdentity     = errors.New("cannot remove the only way to sign in")
+)
+
+// legacyProvider is the provider every account signed in with before
+// identities were recorded.
+const legacyProvider = "google"
+
+type AuthService interface {
+	SignIn(ctx context.Context, providerName string, credentials Credentials) (*users.User, *Identity, error)
+	Link(ctx context.Context, userID uuid.UUID, providerName string, credentials Credentials) (*users.Identity, error)
+	Unlink(ctx context.Context, userID, identityID uuid.UUID) error
+	Identities(ctx context.Context, userID uuid.UUID) ([]*users.Identity, error)
+}
+
+type authService struct {
+	registry     *Registry
+	userRepo     users.Repository
+	identityRepo users.IdentityRepository
+	// signIn tells whether a user can sign in without their identities.
+	signIn SignInMethod
+}
+
+func NewAuthService(registry *Registry, userRepo users.Repository, identityRepo users.IdentityRepository, signIn SignInMethod) AuthService {
+	return &authService{
+		registry:     registry,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		signIn:       signIn,
+	}
+}
+
+// SignIn authenticates with the named provider and returns the user the
+// identity is linked to, creating both on first sign-in. Identities are
+// found by the provider's subject, never by email, so a changed email
+// keeps its account and an email alone can't take one over.
+func (s *authService) SignIn(ctx context.Context, providerName string, credentials Credentials) (*users.User, *Identity, error) {
+	identity, err := s.authenticate(ctx, providerName, credentials)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	linked, err := s.identityRepo.GetByProviderSubject(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if linked != nil {
+		user, err := s.userRepo.GetByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if user == nil {
+			return nil, nil, fmt.Errorf("user %s not found", linked.UserID)
+		}
+		linked.MarkUsed(identity.Email)
+		if err := s.identityRepo.Update(ctx, linked); err != nil {
+			return nil, nil, err
+		}
+		return user, identity, nil
+	}
+
+	// A new identity needs an email the provider vouches for, since it
+	// becomes the email of the account.
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, nil, fmt.Errorf("%w: %s", ErrEmailNotVerified, providerName)
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user != nil {
+		if err := s.adoptLegacy(ctx, user, identity); err != nil {
+			return nil, nil, err
+		}
+		return user, identity, nil
+	}
+
+	user = users.NewUser(identity.GivenName, identity.FamilyName, identity.Email)
+	user.MarkEmailVerified()
+	if err := s.userRepo.Add(ctx, user); err != nil {
+		return nil, nil, err
+	}
+	if err := s.identityRepo.Add(ctx, users.NewIdentity(user.ID, identity.Provider, identity.Subject, identity.Email)); err != nil {
+		return nil, nil, err
+	}
+
+	return user, identity, nil
+}
+
+// adoptLegacy records the identity of an account created before
+// identities were, which could only have signed in with Google by email.
+// Any other sign-in to an existing email has to be linked explicitly. That
+// includes password accounts, whose email may never have been verified.
+func (s *authService) adoptLegacy(ctx context.Context, user *users.User, identity *Identity) error {
+	if identity.Provider != legacyProvider || user.HasPassword() {
+		return ErrAccountExists
+	}
+
+	existing, err := s.identityRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return ErrAccountExists
+	}
+
+	return s.identityRepo.Add(ctx, users.NewIdentity(user.ID, identity.Provider, identity.Subject, identity.Email))
+}
+
+// Link adds the identity the credentials authenticate to the user's
+// account. The provider's email doesn't have to match the account's.
+func (s *authService) Link(ctx context.Context, userID uuid.UUID, providerName string, credentials Credentials) (*users.Identity, error) {
+	identity, err := s.authenticate(ctx, providerName, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	linked, err := s.identityRepo.GetByProviderSubject(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if linked != nil {
+		if linked.UserID != userID {
+			return nil, ErrIdentityLinked
+		}
+		return linked, nil
+	}
+
+	added := users.NewIdentity(userID, identity.Provider, identity.Subject, identity.Email)
+	if err := s.identityRepo.Add(ctx, added); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// Unlink removes one of the user's identities, unless it's the last way
+// they can sign in. A password or a passkey counts as one.
+func (s *authService) Unlink(ctx context.Context, userID, identityID uuid.UUID) error {
+	identities, err := s.identityRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, identity := range identities {
+		if identity.ID == identityID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrIdentityNotFound
+	}
+	if len(identities) == 1 {
+		enabled, err := s.signIn.Enabled(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return ErrLastIdentity
+		}
+	}
+
+	return s.identityRepo.Delete(ctx, userID, identityID)
+}
+
+func (s *authService) Identities(ctx context.Context, userID uuid.UUID) ([]*users.Identity, error) {
+	return s.identityRepo.ListByUser(ctx, userID)
+}
+
+func (s *authService) authenticate(ctx context.Context, providerName string, credentials Credentials) (*Identity, error) {
+	provider, err := s.registry.Get(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := provider.Authenticate(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%s returned an identity without a subject", providerName)
+	}
+	return identity, nil
+}
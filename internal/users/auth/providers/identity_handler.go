@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+type IdentityHandler struct {
+	authService AuthService
+}
+
+func NewIdentityHandler(authService AuthService) *IdentityHandler {
+	return &IdentityHandler{
+		authService: authService,
+	}
+}
+
+func (h *IdentityHandler) HandleListIdentities(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	identities, err := h.authService.Identities(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, newIdentityResponse(identity))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *IdentityHandler) HandleLinkIdentity(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request LinkIdentityRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Code == "" && request.IDToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrMissingCredentials.Error()})
+		return
+	}
+
+	identity, err := h.authService.Link(c.Request.Context(), userID, c.Param("provider"), Credentials{
+		Code:        request.Code,
+		IDToken:     request.IDToken,
+		RedirectURI: request.RedirectURI,
+	})
+	if err != nil {
+		RespondAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newIdentityResponse(identity))
+}
+
+func (h *IdentityHandler) HandleUnlinkIdentity(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	identityID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	if err := h.authService.Unlink(c.Request.Context(), userID, identityID); err != nil {
+		switch {
+		case errors.Is(err, ErrIdentityNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrLastIdentity):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+// passkeys stands in for the passkeys a user may have registered.
+type passkeys bool
+
+func (p passkeys) Enabled(_ context.Context, _ uuid.UUID) (bool, error) {
+	return bool(p), nil
+}
+
+func setupIdentityRouter(t *testing.T, user *users.User, hasPasskey bool, signedInAt time.Time, identityRepo *userstest.IdentityRepository) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	github := &fakeProvider{name: "github", identity: Identity{Subject: "42", Email: "mona@example.com"}}
+	userRepo := userstest.NewUserRepository(user)
+	userID := user.ID
+	handler := NewIdentityHandler(NewAuthService(NewRegistry(github), userRepo, identityRepo, AnySignInMethod(PasswordSignIn(userRepo), passkeys(hasPasskey))))
+
+	router := gin.New()
+	api := router.Group("/api", func(c *gin.Context) {
+		c.Set("userID", userID)
+		middleware.SetClaims(c, &jwt.Claims{UserID: userID, AuthTime: jwtlib.NewNumericDate(signedInAt)})
+	})
+	IdentityRoutes(api, handler)
+	return router
+}
+
+func TestHandleIdentities(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		signedInAgo    time.Duration
+		identities     int
+		hasPassword    bool
+		hasPasskey     bool
+		expectedStatus int
+		expectedCount  int
+	}{
+		{name: "Links with a fresh sign-in", method: http.MethodPost, path: "/api/auth/identities/github", body: `{"code":"valid"}`, signedInAgo: time.Minute, identities: 1, expectedStatus: http.StatusOK, expectedCount: 2},
+		{name: "Linking needs a fresh sign-in", method: http.MethodPost, path: "/api/auth/identities/github", body: `{"code":"valid"}`, signedInAgo: time.Hour, identities: 1, expectedStatus: http.StatusUnauthorized, expectedCount: 1},
+		{name: "Unlinks one of several identities", method: http.MethodDelete, path: "/api/auth/identities/{first}", signedInAgo: time.Minute, identities: 2, expectedStatus: http.StatusNoContent, expectedCount: 1},
+		{name: "Keeps the last identity", method: http.MethodDelete, path: "/api/auth/identities/{first}", signedInAgo: time.Minute, identities: 1, expectedStatus: http.StatusConflict, expectedCount: 1},
+		{name: "Unlinks the last identity of a password account", method: http.MethodDelete, path: "/api/auth/identities/{first}", signedInAgo: time.Minute, identities: 1, hasPassword: true, expectedStatus: http.StatusNoContent, expectedCount: 0},
+		{name: "Unlinks the last identity of a passkey account", method: http.MethodDelete, path: "/api/auth/identities/{first}", signedInAgo: time.Minute, identities: 1, hasPasskey: true, expectedStatus: http.StatusNoContent, expectedCount: 0},
+		{name: "Unlinking needs a fresh sign-in", method: http.MethodDelete, path: "/api/auth/identities/{first}", signedInAgo: time.Hour, identities: 2, expectedStatus: http.StatusUnauthorized, expectedCount: 2},
+		{name: "Unknown identity", method: http.MethodDelete, path: "/api/auth/identities/" + uuid.NewString(), signedInAgo: time.Minute, identities: 2, expectedStatus: http.StatusNotFound, expectedCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			user := users.NewUser("Mona", "Octocat", "mona@example.com")
+			if tt.hasPassword {
+				user.SetPasswordHash("$argon2id$hash")
+			}
+			userID := user.ID
+			identityRepo := userstest.NewIdentityRepository()
+			var first *users.Identity
+			for i := 0; i < tt.identities; i++ {
+				identity := users.NewIdentity(userID, "google", uuid.NewString(), "mona@example.com")
+				identityRepo.Identities[identity.ID] = identity
+				if first == nil {
+					first = identity
+				}
+			}
+			router := setupIdentityRouter(t, user, tt.hasPasskey, time.Now().Add(-tt.signedInAgo), identityRepo)
+			path := strings.Replace(tt.path, "{first}", first.ID.String(), 1)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			router.ServeHTTP(recorder, httptest.NewRequest(tt.method, path, strings.NewReader(tt.body)))
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			identities, _ := identityRepo.ListByUser(context.Background(), userID)
+			assert.Len(t, identities, tt.expectedCount)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package providers
+
+import (
+	"time"
+
+	"github.com/nantestech/note-api/internal/users"
+)
+
+// LinkIdentityRequest carries what the client got back from the provider
+// it signed in to, as for sign-in.
+type LinkIdentityRequest struct {
+	Code        string `json:"code"`
+	IDToken     string `json:"idToken"`
+	RedirectURI string `json:"redirectUri"`
+}
+
+type IdentityResponse struct {
+	ID         string    `json:"id"`
+	Provider   string    `json:"provider"`
+	Email      string    `json:"email"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+func newIdentityResponse(i *users.Identity) IdentityResponse {
+	return IdentityResponse{
+		ID:         i.ID.String(),
+		Provider:   i.Provider,
+		Email:      i.Email,
+		CreatedAt:  i.CreatedAt,
+		LastUsedAt: i.LastUsedAt,
+	}
+}
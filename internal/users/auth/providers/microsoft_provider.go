@@ -0,0 +1,45 @@
+package providers
+
+import (
+	"strings"
+
+	"github.com/nantestech/note-api/internal/users/auth/oidc"
+)
+
+type MicrosoftConfig struct {
+	// TenantID is a directory ID, or "common", "organizations" or
+	// "consumers" for multi-tenant sign-in.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthorityURL string
+}
+
+// NewMicrosoftProvider signs users in with the Microsoft identity platform,
+// which is an OpenID Connect provider per tenant.
+//
+// Its ID tokens have no email_verified claim. The email counts as verified
+// when the xms_edov optional claim says the tenant owns its domain, so the
+// app registration must add the email and xms_edov optional claims to ID
+// tokens. Without them, users can only link Microsoft to an account that
+// already exists.
+func NewMicrosoftProvider(config MicrosoftConfig) Provider {
+	if config.TenantID == "" {
+		config.TenantID = "common"
+	}
+	if config.AuthorityURL == "" {
+		config.AuthorityURL = "https://login.microsoftonline.com"
+	}
+
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "microsoft",
+		IssuerURL:    strings.TrimRight(config.AuthorityURL, "/") + "/" + config.TenantID + "/v2.0",
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  config.RedirectURL,
+		EmailVerified: func(idToken *oidc.IDToken) bool {
+			return bool(idToken.EmailVerified || idToken.EmailDomainOwnerVerified)
+		},
+	})
+}
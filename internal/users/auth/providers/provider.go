@@ -0,0 +1,72 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrUnknownProvider    = errors.New("unknown identity provider")
+	ErrMissingCredentials = errors.New("missing code or id_token")
+	ErrEmailNotVerified   = errors.New("email is not verified")
+	ErrNonceMismatch      = errors.New("ID token nonce does not match")
+)
+
+// Identity is a signed-in user as an identity provider describes them.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Picture       string
+}
+
+// Credentials is what the client got back from the provider: an ID token,
+// or an authorization code for the server to exchange. When Nonce is set,
+// the ID token must carry it.
+type Credentials struct {
+	Code        string
+	IDToken     string
+	RedirectURI string
+	Nonce       string
+}
+
+// Provider signs users in with an external identity provider.
+type Provider interface {
+	Name() string
+	Authenticate(ctx context.Context, credentials Credentials) (*Identity, error)
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	registry := &Registry{providers: make(map[string]Provider)}
+	for _, provider := range providers {
+		registry.providers[provider.Name()] = provider
+	}
+	return registry
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,237 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nantestech/note-api/internal/users/auth/oidc"
+	"github.com/nantestech/note-api/internal/users/auth/oidc/oidctest"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCProviderWithIDToken(t *testing.T) {
+	// Arrange
+	server := oidctest.NewServer()
+	defer server.Close()
+	provider := NewOIDCProvider(OIDCConfig{Name: "acme", IssuerURL: server.Issuer(), ClientID: "client-123"})
+	idToken := server.IDToken(map[string]any{
+		"sub":            "user-1",
+		"aud":            "client-123",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	})
+
+	// Act
+	identity, err := provider.Authenticate(context.Background(), Credentials{IDToken: idToken})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Provider:      "acme",
+		Subject:       "user-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		GivenName:     "Jane",
+		FamilyName:    "Doe",
+	}, identity)
+}
+
+func TestOIDCProviderExchangesCode(t *testing.T) {
+	// Arrange
+	server := oidctest.NewServer()
+	defer server.Close()
+	provider := NewOIDCProvider(OIDCConfig{
+		Name:         "acme",
+		IssuerURL:    server.Issuer(),
+		ClientID:     "client-123",
+		ClientSecret: "secret",
+		RedirectURL:  "https://note.local/callback",
+	})
+	code := server.IssueCode(map[string]any{"sub": "user-1", "aud": "client-123", "email": "jane@example.com"})
+
+	// Act
+	identity, err := provider.Authenticate(context.Background(), Credentials{Code: code})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", identity.Subject)
+	assert.False(t, identity.EmailVerified)
+	requests := server.TokenRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "secret", requests[0].Get("client_secret"))
+	assert.Equal(t, "https://note.local/callback", requests[0].Get("redirect_uri"))
+}
+
+func TestOIDCProviderRejectsTokenForOtherClient(t *testing.T) {
+	server := oidctest.NewServer()
+	defer server.Close()
+	provider := NewOIDCProvider(OIDCConfig{Name: "acme", IssuerURL: server.Issuer(), ClientID: "client-123"})
+
+	_, err := provider.Authenticate(context.Background(), Credentials{
+		IDToken: server.IDToken(map[string]any{"sub": "user-1", "aud": "another-app"}),
+	})
+
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+}
+
+func TestGitHubProvider(t *testing.T) {
+	// Arrange
+	var exchanged, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			require.NoError(t, r.ParseForm())
+			exchanged = r.PostForm.Get("code")
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "gho_token", "token_type": "bearer"})
+		case "/user":
+			authorization = r.Header.Get("Authorization")
+			json.NewEncoder(w).Encode(map[string]any{"id": 42, "login": "octocat", "name": "Mona Lisa Octocat", "avatar_url": "https://avatars.test/42"})
+		case "/user/emails":
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"email": "public@example.com", "primary": false, "verified": true},
+				{"email": "mona@example.com", "primary": true, "verified": true},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	provider := NewGitHubProvider(GitHubConfig{ClientID: "gh-client", ClientSecret: "gh-secret", BaseURL: server.URL, APIURL: server.URL})
+
+	// Act
+	identity, err := provider.Authenticate(context.Background(), Credentials{Code: "gh-code"})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "gh-code", exchanged)
+	assert.Equal(t, "Bearer gho_token", authorization)
+	assert.Equal(t, &Identity{
+		Provider:      "github",
+		Subject:       "42",
+		Email:         "mona@example.com",
+		EmailVerified: true,
+		GivenName:     "Mona",
+		FamilyName:    "Lisa Octocat",
+		Picture:       "https://avatars.test/42",
+	}, identity)
+}
+
+func TestGitHubProviderExchangeError(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":"bad_verification_code","error_description":"The code passed is incorrect or expired."}`))
+	}))
+	defer server.Close()
+	provider := NewGitHubProvider(GitHubConfig{BaseURL: server.URL, APIURL: server.URL})
+
+	// Act
+	_, err := provider.Authenticate(context.Background(), Credentials{Code: "expired"})
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad_verification_code")
+}
+
+// microsoftAuthority serves the discovery document of the multi-tenant
+// Microsoft authority, whose issuer has a {tenantid} placeholder, with the
+// keys of server.
+func microsoftAuthority(t *testing.T, server *oidctest.Server) *httptest.Server {
+	t.Helper()
+	var authority *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/common/v2.0/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":         authority.URL + "/{tenantid}/v2.0",
+			"token_endpoint": server.TokenURL(),
+			"jwks_uri":       server.JWKSURL(),
+		})
+	})
+	authority = httptest.NewServer(mux)
+	t.Cleanup(authority.Close)
+	return authority
+}
+
+// microsoftIDToken has the claims of a Microsoft identity platform v2.0 ID
+// token, with the email optional claim and no email_verified.
+func microsoftIDToken(authorityURL string, claims map[string]any) map[string]any {
+	tenantID := "9188040d-6c67-4c5b-b112-36a304b66dad"
+	token := map[string]any{
+		"ver":                "2.0",
+		"iss":                authorityURL + "/" + tenantID + "/v2.0",
+		"tid":                tenantID,
+		"sub":                "ms-user",
+		"oid":                "00000000-0000-0000-66f3-3332eca7ea81",
+		"aud":                "ms-client",
+		"name":               "Jane Doe",
+		"preferred_username": "jane@contoso.com",
+		"email":              "jane@contoso.com",
+	}
+	for key, value := range claims {
+		token[key] = value
+	}
+	return token
+}
+
+func TestMicrosoftProviderAcceptsTenantIssuer(t *testing.T) {
+	// Arrange
+	server := oidctest.NewServer()
+	defer server.Close()
+	authority := microsoftAuthority(t, server)
+	provider := NewMicrosoftProvider(MicrosoftConfig{ClientID: "ms-client", AuthorityURL: authority.URL})
+
+	// Act
+	identity, err := provider.Authenticate(context.Background(), Credentials{IDToken: server.IDToken(microsoftIDToken(authority.URL, nil))})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "microsoft", identity.Provider)
+	assert.Equal(t, "ms-user", identity.Subject)
+}
+
+func TestMicrosoftSignIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		claims      map[string]any
+		expectedErr error
+	}{
+		{name: "Creates an account for a domain-verified email", claims: map[string]any{"xms_edov": true}},
+		{name: "Refuses an email the tenant hasn't verified", claims: map[string]any{"xms_edov": false}, expectedErr: ErrEmailNotVerified},
+		{name: "Refuses a token without xms_edov", expectedErr: ErrEmailNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := oidctest.NewServer()
+			defer server.Close()
+			authority := microsoftAuthority(t, server)
+			userRepo := userstest.NewUserRepository()
+			service := NewAuthService(
+				NewRegistry(NewMicrosoftProvider(MicrosoftConfig{ClientID: "ms-client", AuthorityURL: authority.URL})),
+				userRepo, userstest.NewIdentityRepository(), PasswordSignIn(userRepo),
+			)
+
+			// Act
+			user, _, err := service.SignIn(context.Background(), "microsoft", Credentials{IDToken: server.IDToken(microsoftIDToken(authority.URL, tt.claims))})
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Empty(t, userRepo.Users)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "jane@contoso.com", user.Email)
+			assert.True(t, user.IsEmailVerified())
+		})
+	}
+}
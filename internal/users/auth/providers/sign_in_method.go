@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+// SignInMethod tells whether a user can sign in without any of their
+// linked identities, with a password or a passkey for instance.
+type SignInMethod interface {
+	Enabled(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+type anySignInMethod []SignInMethod
+
+// AnySignInMethod is enabled when any of methods is, so Unlink lets users
+// with either a password or a passkey remove their last identity.
+func AnySignInMethod(methods ...SignInMethod) SignInMethod {
+	return anySignInMethod(methods)
+}
+
+func (m anySignInMethod) Enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	for _, method := range m {
+		enabled, err := method.Enabled(ctx, userID)
+		if err != nil || enabled {
+			return enabled, err
+		}
+	}
+	return false, nil
+}
+
+type passwordSignIn struct {
+	userRepo users.Repository
+}
+
+// PasswordSignIn is enabled for users who have set a password.
+func PasswordSignIn(userRepo users.Repository) SignInMethod {
+	return &passwordSignIn{userRepo: userRepo}
+}
+
+func (m *passwordSignIn) Enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	user, err := m.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user != nil && user.HasPassword(), nil
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+type SessionHandler struct {
+	userRepo  users.Repository
+	jwtConfig jwt.Config
+}
+
+func NewSessionHandler(userRepo users.Repository, jwtConfig jwt.Config) *SessionHandler {
+	return &SessionHandler{
+		userRepo:  userRepo,
+		jwtConfig: jwtConfig,
+	}
+}
+
+// HandleRefreshToken issues a new token from the stored user, so claims
+// such as isPremium pick up changes made since the old token was issued.
+func (h *SessionHandler) HandleRefreshToken(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Only the user's own session becomes a new session, never an API key
+	// or an app's token.
+	claims, ok := middleware.GetClaims(c)
+	if !ok || claims.IsScoped() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a session can be refreshed"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	token, err := jwt.RefreshSessionToken(h.jwtConfig, user, claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
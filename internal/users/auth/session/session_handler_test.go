@@ -0,0 +1,72 @@
+package session
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = jwt.Config{SecretKey: "secret", ExpiresInHours: 1}
+
+func TestHandleRefreshToken(t *testing.T) {
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	signedInAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	session, err := jwt.GenerateTokenAt(testConfig, user, signedInAt)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		token            string
+		expectedStatus   int
+		expectedAuthTime *time.Time
+	}{
+		{name: "Keeps the sign-in time", token: session, expectedStatus: http.StatusOK, expectedAuthTime: &signedInAt},
+		{name: "Keeps a missing sign-in time", token: userstest.LegacySessionToken(t, testConfig, user), expectedStatus: http.StatusOK},
+		{name: "API key", token: middleware.APIKeyPrefix + "key", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			userRepo := userstest.NewUserRepository(user)
+			router := gin.New()
+			api := router.Group("/api", middleware.NewAuthMiddleware(testConfig, userstest.AdminAPIKey{UserID: user.ID}, nil).Authenticate())
+			SessionRoutes(api, NewSessionHandler(userRepo, testConfig))
+			request := httptest.NewRequest(http.MethodPost, "/api/auth/refresh-token", nil)
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			router.ServeHTTP(recorder, request)
+
+			// Assert
+			require.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var response struct {
+				Token string `json:"token"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			claims, err := jwt.ValidateToken(testConfig, response.Token)
+			require.NoError(t, err)
+			if tt.expectedAuthTime == nil {
+				assert.Nil(t, claims.AuthTime, "Refreshing isn't signing in")
+			} else {
+				require.NotNil(t, claims.AuthTime)
+				assert.Equal(t, *tt.expectedAuthTime, claims.AuthTime.Time)
+			}
+		})
+	}
+}
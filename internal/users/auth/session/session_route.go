@@ -0,0 +1,11 @@
+package session
+
+import "github.com/gin-gonic/gin"
+
+func SessionRoutes(api *gin.RouterGroup, sessionHandler *SessionHandler) {
+
+	auth := api.Group("/auth")
+	{
+		auth.POST("/refresh-token", sessionHandler.HandleRefreshToken)
+	}
+}
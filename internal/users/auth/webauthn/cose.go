@@ -0,0 +1,129 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/nantestech/note-api/pkg/cbor"
+)
+
+// COSE algorithms (RFC 9053) passkeys may use, in order of preference.
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+var supportedAlgorithms = []int64{algES256, algEdDSA, algRS256}
+
+// COSE key parameters.
+const (
+	keyType       = 1
+	keyAlgorithm  = 3
+	keyCurve      = -1
+	keyX          = -2
+	keyY          = -3
+	keyRSAModulus = -1
+	keyRSAExp     = -2
+
+	keyTypeOKP = 1
+	keyTypeEC2 = 2
+	keyTypeRSA = 3
+
+	curveP256    = 1
+	curveEd25519 = 6
+
+	minRSABits = 2048
+)
+
+// publicKey is a credential public key and the algorithm it signs with.
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey parses a COSE_Key (RFC 9052) for one of the supported
+// algorithms.
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	decoded, err := cbor.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: key is not a map", ErrUnsupportedKey)
+	}
+	kty, _ := params[int64(keyType)].(int64)
+	alg, _ := params[int64(keyAlgorithm)].(int64)
+
+	switch {
+	case kty == keyTypeEC2 && alg == algES256:
+		if crv, _ := params[int64(keyCurve)].(int64); crv != curveP256 {
+			return nil, fmt.Errorf("%w: curve %d", ErrUnsupportedKey, crv)
+		}
+		x, _ := params[int64(keyX)].([]byte)
+		y, _ := params[int64(keyY)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: bad P-256 coordinates", ErrUnsupportedKey)
+		}
+		// ecdh rejects points that aren't on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+		}
+		return &publicKey{algorithm: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case kty == keyTypeOKP && alg == algEdDSA:
+		if crv, _ := params[int64(keyCurve)].(int64); crv != curveEd25519 {
+			return nil, fmt.Errorf("%w: curve %d", ErrUnsupportedKey, crv)
+		}
+		x, _ := params[int64(keyX)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: bad Ed25519 key", ErrUnsupportedKey)
+		}
+		return &publicKey{algorithm: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == keyTypeRSA && alg == algRS256:
+		n, _ := params[int64(keyRSAModulus)].([]byte)
+		e, _ := params[int64(keyRSAExp)].([]byte)
+		modulus := new(big.Int).SetBytes(n)
+		exponent := new(big.Int).SetBytes(e)
+		if modulus.BitLen() < minRSABits || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: weak RSA key", ErrUnsupportedKey)
+		}
+		return &publicKey{algorithm: alg, key: &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}}, nil
+	}
+	return nil, fmt.Errorf("%w: key type %d, algorithm %d", ErrUnsupportedKey, kty, alg)
+}
+
+// verify checks signature over data.
+func (k *publicKey) verify(data, signature []byte) error {
+	return verifySignature(k.algorithm, k.key, data, signature)
+}
+
+func verifySignature(algorithm int64, key crypto.PublicKey, data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	switch algorithm {
+	case algES256:
+		if key, ok := key.(*ecdsa.PublicKey); ok && ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case algEdDSA:
+		if key, ok := key.(ed25519.PublicKey); ok && ed25519.Verify(key, data, signature) {
+			return nil
+		}
+	case algRS256:
+		if key, ok := key.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: bad signature", ErrVerificationFailed)
+}
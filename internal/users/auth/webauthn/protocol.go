@@ -0,0 +1,211 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nantestech/note-api/pkg/cbor"
+)
+
+// Client data types (WebAuthn §5.8.1).
+const (
+	clientDataCreate = "webauthn.create"
+	clientDataGet    = "webauthn.get"
+)
+
+// Authenticator data flags (WebAuthn §6.1).
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+	flagExtensions   = 0x80
+)
+
+// authDataMinLength is the RP ID hash, the flags and the sign count.
+const authDataMinLength = 37
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// parseClientData checks the client data the browser collected and
+// returns it with its hash, which the authenticator signed.
+func parseClientData(raw []byte, expectedType string, origins []string) (*clientData, []byte, error) {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, nil, fmt.Errorf("%w: client data: %v", ErrVerificationFailed, err)
+	}
+	if data.Type != expectedType {
+		return nil, nil, fmt.Errorf("%w: client data type %q", ErrVerificationFailed, data.Type)
+	}
+	if !slices.Contains(origins, data.Origin) {
+		return nil, nil, fmt.Errorf("%w: origin %q is not allowed", ErrVerificationFailed, data.Origin)
+	}
+	if data.CrossOrigin {
+		return nil, nil, fmt.Errorf("%w: cross-origin ceremony", ErrVerificationFailed)
+	}
+	hash := sha256.Sum256(raw)
+	return &data, hash[:], nil
+}
+
+type authenticatorData struct {
+	raw       []byte
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// credentialID and publicKey are only in registrations.
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < authDataMinLength {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerificationFailed)
+	}
+	data := &authenticatorData{
+		raw:       raw,
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[authDataMinLength:]
+
+	if data.flags&flagAttestedData != 0 {
+		// AAGUID, then the credential ID and its length.
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrVerificationFailed)
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("%w: bad credential ID", ErrVerificationFailed)
+		}
+		data.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, after, err := cbor.DecodeFirst(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %v", ErrVerificationFailed, err)
+		}
+		data.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if data.flags&flagExtensions != 0 {
+		extensions, after, err := cbor.DecodeFirst(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: extensions: %v", ErrVerificationFailed, err)
+		}
+		if _, ok := extensions.(map[any]any); !ok {
+			return nil, fmt.Errorf("%w: extensions are not a map", ErrVerificationFailed)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrVerificationFailed)
+	}
+	return data, nil
+}
+
+// check verifies the data is for rpID and the user was present, and
+// verified when requireUV.
+func (d *authenticatorData) check(rpID string, requireUV bool) error {
+	expected := sha256.Sum256([]byte(rpID))
+	if subtle.ConstantTimeCompare(d.rpIDHash, expected[:]) != 1 {
+		return fmt.Errorf("%w: RP ID mismatch", ErrVerificationFailed)
+	}
+	if d.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrVerificationFailed)
+	}
+	if requireUV && d.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrVerificationFailed)
+	}
+	return nil
+}
+
+type attestationObject struct {
+	format    string
+	statement map[any]any
+	authData  *authenticatorData
+}
+
+func parseAttestationObject(raw []byte) (*attestationObject, error) {
+	decoded, err := cbor.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrVerificationFailed, err)
+	}
+	fields, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrVerificationFailed)
+	}
+	format, _ := fields["fmt"].(string)
+	statement, _ := fields["attStmt"].(map[any]any)
+	rawAuthData, _ := fields["authData"].([]byte)
+	if format == "" || statement == nil || rawAuthData == nil {
+		return nil, fmt.Errorf("%w: incomplete attestation object", ErrVerificationFailed)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrVerificationFailed)
+	}
+	return &attestationObject{format: format, statement: statement, authData: authData}, nil
+}
+
+// verifyAttestation checks the attestation statement is consistent with
+// the new credential. It makes no trust decision about the authenticator:
+// "none" and self attestation are accepted, and so is "packed" with a
+// certificate whatever its issuer.
+func (o *attestationObject) verify(clientDataHash []byte, key *publicKey) error {
+	signed := append(bytes.Clone(o.authData.raw), clientDataHash...)
+
+	switch o.format {
+	case "none":
+		if len(o.statement) != 0 {
+			return fmt.Errorf("%w: none attestation with a statement", ErrVerificationFailed)
+		}
+		return nil
+	case "packed":
+		alg, _ := o.statement["alg"].(int64)
+		signature, _ := o.statement["sig"].([]byte)
+		chain, hasChain := o.statement["x5c"].([]any)
+		if !hasChain {
+			if alg != key.algorithm {
+				return fmt.Errorf("%w: self attestation algorithm mismatch", ErrVerificationFailed)
+			}
+			return key.verify(signed, signature)
+		}
+		if len(chain) == 0 {
+			return fmt.Errorf("%w: empty certificate chain", ErrVerificationFailed)
+		}
+		der, _ := chain[0].([]byte)
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("%w: attestation certificate: %v", ErrVerificationFailed, err)
+		}
+		return verifySignature(alg, certificate.PublicKey, signed, signature)
+	}
+	return fmt.Errorf("%w: attestation format %q is not supported", ErrVerificationFailed, o.format)
+}
+
+// decodeBase64 decodes the base64url fields of credentials, which some
+// clients pad.
+func decodeBase64(value string) ([]byte, error) {
+	decoded, err := encoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,62 @@
+package webauthn
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+type StepUpMiddleware interface {
+	Require(maxAge time.Duration) gin.HandlerFunc
+}
+
+type stepUpMiddleware struct {
+	webAuthnService WebAuthnService
+}
+
+func NewStepUpMiddleware(webAuthnService WebAuthnService) StepUpMiddleware {
+	return &stepUpMiddleware{webAuthnService: webAuthnService}
+}
+
+// Require rejects requests unless the user used a passkey less than maxAge
+// ago, through POST /api/auth/webauthn/step-up or a passkey sign-in. Users
+// without a passkey can't step up, so for them a sign-in less than maxAge
+// ago is enough, as with middleware.RequireFreshLogin.
+func (m *stepUpMiddleware) Require(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := middleware.GetClaims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		now := time.Now()
+		if claims.SteppedUpWithin(maxAge, now) {
+			c.Next()
+			return
+		}
+
+		enabled, err := m.webAuthnService.Enabled(c.Request.Context(), claims.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if enabled {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":  "Passkey verification required",
+				"stepUp": true,
+			})
+			return
+		}
+		if !claims.AuthenticatedWithin(maxAge, now) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":          "Recent sign-in required",
+				"reauthenticate": true,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,285 @@
+package webauthn
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	auth "github.com/nantestech/note-api/internal/users/auth/schemas"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+// providerName is the provider reported in the auth responses of passkey
+// sign-ins.
+const providerName = "webauthn"
+
+type WebAuthnHandler struct {
+	webAuthnService WebAuthnService
+	jwtConfig       jwt.Config
+}
+
+func NewWebAuthnHandler(webAuthnService WebAuthnService, jwtConfig jwt.Config) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webAuthnService: webAuthnService,
+		jwtConfig:       jwtConfig,
+	}
+}
+
+func (h *WebAuthnHandler) HandleRegistrationOptions(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	options, err := h.webAuthnService.BeginRegistration(c.Request.Context(), userID)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, CreationOptionsResponse{PublicKey: options})
+}
+
+func (h *WebAuthnHandler) HandleRegister(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request RegisterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := h.webAuthnService.FinishRegistration(c.Request.Context(), userID, request.Name, &request.Credential)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCredentialResponse(credential))
+}
+
+func (h *WebAuthnHandler) HandleListCredentials(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	credentials, err := h.webAuthnService.Credentials(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]CredentialResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		response = append(response, toCredentialResponse(credential))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *WebAuthnHandler) HandleRemoveCredential(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	if err := h.webAuthnService.Remove(c.Request.Context(), userID, id); err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebAuthnHandler) HandleLoginOptions(c *gin.Context) {
+	var request LoginOptionsRequest
+	// The body is optional: without an email the browser offers
+	// discoverable passkeys.
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	options, err := h.webAuthnService.BeginLogin(c.Request.Context(), request.Email)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RequestOptionsResponse{PublicKey: options})
+}
+
+// HandleLogin signs in with a passkey. A passkey the authenticator
+// unlocked with a PIN or biometrics is two factors already, so there's no
+// MFA challenge, and the sign-in counts as a step-up.
+func (h *WebAuthnHandler) HandleLogin(c *gin.Context) {
+	var request AssertionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.webAuthnService.FinishLogin(c.Request.Context(), &request.Credential)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	now := time.Now()
+	h.respondWithToken(c, user, now, now)
+}
+
+func (h *WebAuthnHandler) HandleSecondFactorOptions(c *gin.Context) {
+	var request SecondFactorOptionsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := jwt.ValidateMFAPendingToken(h.jwtConfig, request.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	options, err := h.webAuthnService.BeginAssertion(c.Request.Context(), claims.UserID, CeremonySecondFactor)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RequestOptionsResponse{PublicKey: options})
+}
+
+// HandleSecondFactor trades an mfa_pending token and a passkey assertion
+// for a session token, like POST /auth/mfa/verify does with a TOTP code.
+func (h *WebAuthnHandler) HandleSecondFactor(c *gin.Context) {
+	var request SecondFactorRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := jwt.ValidateMFAPendingToken(h.jwtConfig, request.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := h.webAuthnService.FinishAssertion(c.Request.Context(), claims.UserID, CeremonySecondFactor, &request.Credential)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	now := time.Now()
+	h.respondWithToken(c, user, now, now)
+}
+
+func (h *WebAuthnHandler) HandleStepUpOptions(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	options, err := h.webAuthnService.BeginAssertion(c.Request.Context(), userID, CeremonyStepUp)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RequestOptionsResponse{PublicKey: options})
+}
+
+// HandleStepUp returns a token that records the passkey assertion, for
+// the endpoints behind StepUpMiddleware. The sign-in time carries over.
+func (h *WebAuthnHandler) HandleStepUp(c *gin.Context) {
+	// Only the user's own session is stepped up, never an API key or an
+	// app's token, which would come out of it as a session.
+	claims, ok := middleware.GetClaims(c)
+	if !ok || claims.IsScoped() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a session can be stepped up"})
+		return
+	}
+
+	var request AssertionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.webAuthnService.FinishAssertion(c.Request.Context(), claims.UserID, CeremonyStepUp, &request.Credential)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	token, err := jwt.StepUpSessionToken(h.jwtConfig, user, claims, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+func (h *WebAuthnHandler) respondWithToken(c *gin.Context, user *users.User, authTime, stepUpAt time.Time) {
+	token, err := jwt.GenerateSteppedUpToken(h.jwtConfig, user, authTime, stepUpAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, auth.AuthResponse{
+		Token:     token,
+		UserId:    user.ID.String(),
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Provider:  providerName,
+	})
+}
+
+func toCredentialResponse(credential *Credential) CredentialResponse {
+	return CredentialResponse{
+		ID:         credential.ID.String(),
+		Name:       credential.Name,
+		CreatedAt:  credential.CreatedAt,
+		LastUsedAt: credential.LastUsedAt,
+	}
+}
+
+func respondWebAuthnError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidChallenge), errors.Is(err, ErrVerificationFailed), errors.Is(err, ErrCredentialCloned):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUnsupportedKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrCredentialExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
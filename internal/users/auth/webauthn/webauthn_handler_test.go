@@ -0,0 +1,351 @@
+package webauthn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/internal/users/auth/webauthn/webauthntest"
+	"github.com/nantestech/note-api/internal/users/userstest"
+	"github.com/nantestech/note-api/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOrigin = "https://app.note.test"
+
+type mockRepository struct {
+	credentials map[uuid.UUID]*Credential
+	challenges  map[string]*Challenge
+}
+
+func (m *mockRepository) AddCredential(_ context.Context, credential *Credential) error {
+	copied := *credential
+	m.credentials[credential.ID] = &copied
+	return nil
+}
+
+func (m *mockRepository) UpdateCredential(ctx context.Context, credential *Credential) error {
+	return m.AddCredential(ctx, credential)
+}
+
+func (m *mockRepository) GetCredential(_ context.Context, credentialID string) (*Credential, error) {
+	for _, credential := range m.credentials {
+		if credential.CredentialID == credentialID {
+			copied := *credential
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRepository) ListCredentials(_ context.Context, userID uuid.UUID) ([]*Credential, error) {
+	var credentials []*Credential
+	for _, credential := range m.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (m *mockRepository) CountCredentials(ctx context.Context, userID uuid.UUID) (int64, error) {
+	credentials, _ := m.ListCredentials(ctx, userID)
+	return int64(len(credentials)), nil
+}
+
+func (m *mockRepository) DeleteCredential(_ context.Context, userID, id uuid.UUID) (bool, error) {
+	credential := m.credentials[id]
+	if credential == nil || credential.UserID != userID {
+		return false, nil
+	}
+	delete(m.credentials, id)
+	return true, nil
+}
+
+func (m *mockRepository) AddChallenge(_ context.Context, challenge *Challenge) error {
+	m.challenges[challenge.ChallengeHash] = challenge
+	return nil
+}
+
+func (m *mockRepository) ConsumeChallenge(_ context.Context, challengeHash string, ceremony Ceremony, now time.Time) (*Challenge, error) {
+	challenge := m.challenges[challengeHash]
+	if challenge == nil || challenge.Ceremony != ceremony || challenge.UsedAt != nil || !challenge.ExpiresAt.After(now) {
+		return nil, ErrInvalidChallenge
+	}
+	challenge.UsedAt = &now
+	return challenge, nil
+}
+
+type flowTest struct {
+	*userstest.Flow
+	user          *users.User
+	authenticator *webauthntest.Authenticator
+}
+
+func setupFlow(t *testing.T, attestation string) *flowTest {
+	t.Helper()
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	flow := &flowTest{Flow: userstest.NewFlow(t, user), user: user, authenticator: webauthntest.NewAuthenticator(testOrigin)}
+	repo := &mockRepository{credentials: make(map[uuid.UUID]*Credential), challenges: make(map[string]*Challenge)}
+	service := NewWebAuthnService(Config{
+		RPID:        "note.test",
+		RPName:      "Note",
+		Origins:     []string{testOrigin},
+		Attestation: attestation,
+		Timeout:     time.Minute,
+	}, repo, flow.UserRepo)
+	stepUp := NewStepUpMiddleware(service)
+
+	api := flow.Router.Group("/api")
+	api.Use(middleware.NewAuthMiddleware(flow.JWTConfig, userstest.AdminAPIKey{UserID: user.ID}, nil).Authenticate())
+	api.DELETE("/sensitive", stepUp.Require(StepUpMaxAge), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	WebAuthnRoutes(flow.Router, api, NewWebAuthnHandler(service, flow.JWTConfig), stepUp)
+	return flow
+}
+
+func (f *flowTest) session(t *testing.T) string {
+	t.Helper()
+	return f.Session(t, f.user)
+}
+
+func (f *flowTest) post(path, token, body string) *httptest.ResponseRecorder {
+	return f.Do(http.MethodPost, path, token, body)
+}
+
+// register adds a passkey for the user with the software authenticator.
+func (f *flowTest) register(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+	token := f.session(t)
+	options := f.post("/api/auth/webauthn/register/options", token, "")
+	require.Equal(t, http.StatusOK, options.Code, options.Body.String())
+	credential, err := f.authenticator.Register(options.Body.Bytes())
+	require.NoError(t, err)
+	return f.post("/api/auth/webauthn/register", token, `{"name":"Laptop","credential":`+string(credential)+`}`)
+}
+
+// loginCredential runs the authenticator against fresh login options.
+func (f *flowTest) loginCredential(t *testing.T, authenticator *webauthntest.Authenticator) string {
+	t.Helper()
+	options := f.post("/auth/webauthn/login/options", "", "")
+	require.Equal(t, http.StatusOK, options.Code, options.Body.String())
+	credential, err := authenticator.Assert(options.Body.Bytes())
+	require.NoError(t, err)
+	return `{"credential":` + string(credential) + `}`
+}
+
+func tokenFrom(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.NotEmpty(t, response.Token)
+	return response.Token
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	for _, attestation := range []string{"none", "direct"} {
+		t.Run("Attestation "+attestation, func(t *testing.T) {
+			// Arrange
+			flow := setupFlow(t, attestation)
+			if attestation == "direct" {
+				flow.authenticator.Attestation = "packed"
+			}
+
+			// Act
+			registered := flow.register(t)
+			login := flow.post("/auth/webauthn/login", "", flow.loginCredential(t, flow.authenticator))
+			again := flow.post("/auth/webauthn/login", "", flow.loginCredential(t, flow.authenticator))
+
+			// Assert
+			require.Equal(t, http.StatusCreated, registered.Code, registered.Body.String())
+			require.Equal(t, http.StatusOK, login.Code, login.Body.String())
+			assert.Equal(t, http.StatusOK, again.Code, again.Body.String())
+			claims, err := jwt.ValidateToken(flow.JWTConfig, tokenFrom(t, login))
+			require.NoError(t, err)
+			assert.Equal(t, flow.user.ID, claims.UserID)
+			assert.True(t, claims.SteppedUpWithin(time.Minute, time.Now()), "A passkey sign-in should count as a step-up")
+		})
+	}
+}
+
+func TestPasskeyRejections(t *testing.T) {
+	tests := []struct {
+		name   string
+		attack func(t *testing.T, flow *flowTest) *httptest.ResponseRecorder
+	}{
+		{
+			name: "Wrong origin",
+			attack: func(t *testing.T, flow *flowTest) *httptest.ResponseRecorder {
+				flow.authenticator.Origin = "https://phishing.test"
+				return flow.post("/auth/webauthn/login", "", flow.loginCredential(t, flow.authenticator))
+			},
+		},
+		{
+			name: "Replayed assertion",
+			attack: func(t *testing.T, flow *flowTest) *httptest.ResponseRecorder {
+				body := flow.loginCredential(t, flow.authenticator)
+				require.Equal(t, http.StatusOK, flow.post("/auth/webauthn/login", "", body).Code)
+				return flow.post("/auth/webauthn/login", "", body)
+			},
+		},
+		{
+			name: "Cloned authenticator",
+			attack: func(t *testing.T, flow *flowTest) *httptest.ResponseRecorder {
+				clone := flow.authenticator.Clone()
+				require.Equal(t, http.StatusOK, flow.post("/auth/webauthn/login", "", flow.loginCredential(t, flow.authenticator)).Code)
+				return flow.post("/auth/webauthn/login", "", flow.loginCredential(t, clone))
+			},
+		},
+		{
+			name: "User not verified",
+			attack: func(t *testing.T, flow *flowTest) *httptest.ResponseRecorder {
+				flow.authenticator.UserVerified = false
+				return flow.post("/auth/webauthn/login", "", flow.loginCredential(t, flow.authenticator))
+			},
+		},
+		{
+			name: "Step-up challenge used to sign in",
+			attack: func(t *testing.T, flow *flowTest) *httptest.ResponseRecorder {
+				options := flow.post("/api/auth/webauthn/step-up/options", flow.session(t), "")
+				require.Equal(t, http.StatusOK, options.Code)
+				credential, err := flow.authenticator.Assert(options.Body.Bytes())
+				require.NoError(t, err)
+				return flow.post("/auth/webauthn/login", "", `{"credential":`+string(credential)+`}`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			flow := setupFlow(t, "none")
+			require.Equal(t, http.StatusCreated, flow.register(t).Code)
+
+			// Act
+			recorder := tt.attack(t, flow)
+
+			// Assert
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+func TestStepUp(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t, "none")
+	withoutPasskey := flow.Do(http.MethodDelete, "/api/sensitive", flow.session(t), "")
+	require.Equal(t, http.StatusCreated, flow.register(t).Code)
+	token := flow.session(t)
+
+	// Act
+	before := flow.Do(http.MethodDelete, "/api/sensitive", token, "")
+	options := flow.post("/api/auth/webauthn/step-up/options", token, "")
+	credential, err := flow.authenticator.Assert(options.Body.Bytes())
+	require.NoError(t, err)
+	stepUp := flow.post("/api/auth/webauthn/step-up", token, `{"credential":`+string(credential)+`}`)
+	require.Equal(t, http.StatusOK, stepUp.Code, stepUp.Body.String())
+	after := flow.Do(http.MethodDelete, "/api/sensitive", tokenFrom(t, stepUp), "")
+
+	// Assert
+	assert.Equal(t, http.StatusNoContent, withoutPasskey.Code, "A fresh sign-in should do for users without a passkey")
+	assert.Equal(t, http.StatusUnauthorized, before.Code)
+	assert.Contains(t, before.Body.String(), `"stepUp":true`)
+	assert.Equal(t, http.StatusNoContent, after.Code, after.Body.String())
+}
+
+func TestStepUpKeepsSession(t *testing.T) {
+	signedInAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name             string
+		token            func(flow *flowTest) string
+		expectedStatus   int
+		expectedAuthTime *time.Time
+	}{
+		{
+			name: "Keeps the sign-in time",
+			token: func(flow *flowTest) string {
+				token, err := jwt.GenerateTokenAt(flow.JWTConfig, flow.user, signedInAt)
+				require.NoError(t, err)
+				return token
+			},
+			expectedStatus:   http.StatusOK,
+			expectedAuthTime: &signedInAt,
+		},
+		{
+			name: "Keeps a missing sign-in time",
+			token: func(flow *flowTest) string {
+				return userstest.LegacySessionToken(t, flow.JWTConfig, flow.user)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "API key",
+			token: func(*flowTest) string {
+				return middleware.APIKeyPrefix + "key"
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			flow := setupFlow(t, "none")
+			require.Equal(t, http.StatusCreated, flow.register(t).Code)
+			options := flow.post("/api/auth/webauthn/step-up/options", flow.session(t), "")
+			credential, err := flow.authenticator.Assert(options.Body.Bytes())
+			require.NoError(t, err)
+
+			// Act
+			recorder := flow.post("/api/auth/webauthn/step-up", tt.token(flow), `{"credential":`+string(credential)+`}`)
+
+			// Assert
+			require.Equal(t, tt.expectedStatus, recorder.Code, recorder.Body.String())
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			claims, err := jwt.ValidateToken(flow.JWTConfig, tokenFrom(t, recorder))
+			require.NoError(t, err)
+			assert.True(t, claims.SteppedUpWithin(time.Minute, time.Now()))
+			if tt.expectedAuthTime == nil {
+				assert.Nil(t, claims.AuthTime, "Stepping up isn't signing in")
+			} else {
+				require.NotNil(t, claims.AuthTime)
+				assert.Equal(t, *tt.expectedAuthTime, claims.AuthTime.Time)
+			}
+		})
+	}
+}
+
+func TestPasskeyAsSecondFactor(t *testing.T) {
+	// Arrange
+	flow := setupFlow(t, "none")
+	require.Equal(t, http.StatusCreated, flow.register(t).Code)
+	// Second factors don't need user verification.
+	flow.authenticator.UserVerified = false
+	pending, err := jwt.GenerateMFAPendingToken(flow.JWTConfig, flow.user, time.Now(), 5*time.Minute)
+	require.NoError(t, err)
+
+	// Act
+	options := flow.post("/auth/webauthn/mfa/options", "", `{"mfaToken":"`+pending+`"}`)
+	require.Equal(t, http.StatusOK, options.Code, options.Body.String())
+	credential, err := flow.authenticator.Assert(options.Body.Bytes())
+	require.NoError(t, err)
+	recorder := flow.post("/auth/webauthn/mfa", "", `{"mfaToken":"`+pending+`","credential":`+string(credential)+`}`)
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	claims, err := jwt.ValidateToken(flow.JWTConfig, tokenFrom(t, recorder))
+	require.NoError(t, err)
+	assert.Equal(t, flow.user.ID, claims.UserID)
+}
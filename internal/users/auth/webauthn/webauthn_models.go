@@ -0,0 +1,115 @@
+package webauthn
+
+import "time"
+
+// CreationOptions are the PublicKeyCredentialCreationOptions to pass to
+// navigator.credentials.create, with binary fields base64url encoded.
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the PublicKeyCredentialRequestOptions to pass to
+// navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// RegistrationCredential is the PublicKeyCredential returned by
+// navigator.credentials.create, serialized with toJSON().
+type RegistrationCredential struct {
+	ID       string `json:"id" binding:"required"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AttestationObject string `json:"attestationObject" binding:"required"`
+	} `json:"response"`
+}
+
+// AssertionCredential is the PublicKeyCredential returned by
+// navigator.credentials.get, serialized with toJSON().
+type AssertionCredential struct {
+	ID       string `json:"id" binding:"required"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AuthenticatorData string `json:"authenticatorData" binding:"required"`
+		Signature         string `json:"signature" binding:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type CreationOptionsResponse struct {
+	PublicKey *CreationOptions `json:"publicKey"`
+}
+
+type RequestOptionsResponse struct {
+	PublicKey *RequestOptions `json:"publicKey"`
+}
+
+type RegisterRequest struct {
+	Name       string                 `json:"name"`
+	Credential RegistrationCredential `json:"credential" binding:"required"`
+}
+
+type LoginOptionsRequest struct {
+	Email string `json:"email"`
+}
+
+type AssertionRequest struct {
+	Credential AssertionCredential `json:"credential" binding:"required"`
+}
+
+type SecondFactorOptionsRequest struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+}
+
+type SecondFactorRequest struct {
+	MFAToken   string              `json:"mfaToken" binding:"required"`
+	Credential AssertionCredential `json:"credential" binding:"required"`
+}
+
+type CredentialResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
@@ -0,0 +1,93 @@
+package webauthn
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	AddCredential(ctx context.Context, credential *Credential) error
+	UpdateCredential(ctx context.Context, credential *Credential) error
+	GetCredential(ctx context.Context, credentialID string) (*Credential, error)
+	ListCredentials(ctx context.Context, userID uuid.UUID) ([]*Credential, error)
+	CountCredentials(ctx context.Context, userID uuid.UUID) (int64, error)
+	// DeleteCredential removes the user's passkey with id and reports
+	// whether there was one.
+	DeleteCredential(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	AddChallenge(ctx context.Context, challenge *Challenge) error
+	// ConsumeChallenge marks the challenge used and returns it, or returns
+	// ErrInvalidChallenge when it's unknown, used, expired or for another
+	// ceremony.
+	ConsumeChallenge(ctx context.Context, challengeHash string, ceremony Ceremony, now time.Time) (*Challenge, error)
+}
+
+type webAuthnRepository struct {
+	db *gorm.DB
+}
+
+func (r *webAuthnRepository) AddCredential(ctx context.Context, credential *Credential) error {
+	return r.db.WithContext(ctx).Create(credential).Error
+}
+
+func (r *webAuthnRepository) UpdateCredential(ctx context.Context, credential *Credential) error {
+	return r.db.WithContext(ctx).Save(credential).Error
+}
+
+func (r *webAuthnRepository) GetCredential(ctx context.Context, credentialID string) (*Credential, error) {
+	var credential Credential
+	err := r.db.WithContext(ctx).Where("credential_id = ?", credentialID).First(&credential).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *webAuthnRepository) ListCredentials(ctx context.Context, userID uuid.UUID) ([]*Credential, error) {
+	var credentials []*Credential
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *webAuthnRepository) CountCredentials(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Credential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *webAuthnRepository) DeleteCredential(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&Credential{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *webAuthnRepository) AddChallenge(ctx context.Context, challenge *Challenge) error {
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+func (r *webAuthnRepository) ConsumeChallenge(ctx context.Context, challengeHash string, ceremony Ceremony, now time.Time) (*Challenge, error) {
+	var challenge Challenge
+	// A single conditional update, so a challenge can't complete two
+	// ceremonies even with concurrent requests.
+	result := r.db.WithContext(ctx).Model(&challenge).
+		Clauses(clause.Returning{}).
+		Where("challenge_hash = ? AND ceremony = ? AND used_at IS NULL AND expires_at > ?", challengeHash, ceremony, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidChallenge
+	}
+	return &challenge, nil
+}
+
+func NewWebAuthnRepository(db *gorm.DB) Repository {
+	return &webAuthnRepository{db: db}
+}
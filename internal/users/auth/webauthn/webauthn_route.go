@@ -0,0 +1,41 @@
+package webauthn
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/nantestech/note-api/internal/api/middlewares"
+)
+
+const (
+	// registrationFreshness is how recently the user must have signed in
+	// to add a passkey.
+	registrationFreshness = 10 * time.Minute
+	// StepUpMaxAge is how long a passkey assertion unlocks the endpoints
+	// that require a step-up.
+	StepUpMaxAge = 5 * time.Minute
+)
+
+// WebAuthnRoutes registers passkey sign-in and the second factor on
+// router, and passkey management and step-up on the authenticated api
+// group.
+func WebAuthnRoutes(router *gin.Engine, api *gin.RouterGroup, webAuthnHandler *WebAuthnHandler, stepUp StepUpMiddleware) {
+
+	public := router.Group("/auth/webauthn")
+	{
+		public.POST("/login/options", webAuthnHandler.HandleLoginOptions)
+		public.POST("/login", webAuthnHandler.HandleLogin)
+		public.POST("/mfa/options", webAuthnHandler.HandleSecondFactorOptions)
+		public.POST("/mfa", webAuthnHandler.HandleSecondFactor)
+	}
+
+	webauthn := api.Group("/auth/webauthn")
+	{
+		webauthn.POST("/register/options", middleware.RequireFreshLogin(registrationFreshness), webAuthnHandler.HandleRegistrationOptions)
+		webauthn.POST("/register", middleware.RequireFreshLogin(registrationFreshness), webAuthnHandler.HandleRegister)
+		webauthn.GET("/credentials", webAuthnHandler.HandleListCredentials)
+		webauthn.DELETE("/credentials/:id", stepUp.Require(StepUpMaxAge), webAuthnHandler.HandleRemoveCredential)
+		webauthn.POST("/step-up/options", webAuthnHandler.HandleStepUpOptions)
+		webauthn.POST("/step-up", webAuthnHandler.HandleStepUp)
+	}
+}
@@ -0,0 +1,365 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+const (
+	defaultCredentialName = "Passkey"
+	maxCredentialName     = 100
+)
+
+type Config struct {
+	// RPID is the domain passkeys are scoped to, such as "example.com".
+	RPID   string
+	RPName string
+	// Origins are the origins ceremonies may come from, such as
+	// "https://app.example.com".
+	Origins []string
+	// Attestation is the conveyance preference sent to clients: "none",
+	// "indirect" or "direct".
+	Attestation string
+	// Timeout is how long the user has to complete a ceremony.
+	Timeout time.Duration
+}
+
+type WebAuthnService interface {
+	// Enabled reports whether the user has a passkey, which makes it a
+	// second factor for their other sign-in methods.
+	Enabled(ctx context.Context, userID uuid.UUID) (bool, error)
+	BeginRegistration(ctx context.Context, userID uuid.UUID) (*CreationOptions, error)
+	FinishRegistration(ctx context.Context, userID uuid.UUID, name string, credential *RegistrationCredential) (*Credential, error)
+	// BeginLogin starts a passkey sign-in. With an email the options list
+	// that user's passkeys, otherwise the browser offers discoverable ones.
+	BeginLogin(ctx context.Context, email string) (*RequestOptions, error)
+	FinishLogin(ctx context.Context, credential *AssertionCredential) (*users.User, error)
+	// BeginAssertion starts a second factor or step-up ceremony for a
+	// user who is already known.
+	BeginAssertion(ctx context.Context, userID uuid.UUID, ceremony Ceremony) (*RequestOptions, error)
+	FinishAssertion(ctx context.Context, userID uuid.UUID, ceremony Ceremony, credential *AssertionCredential) (*users.User, error)
+	Credentials(ctx context.Context, userID uuid.UUID) ([]*Credential, error)
+	Remove(ctx context.Context, userID, id uuid.UUID) error
+}
+
+type webAuthnService struct {
+	config   Config
+	repo     Repository
+	userRepo users.Repository
+}
+
+func NewWebAuthnService(config Config, repo Repository, userRepo users.Repository) WebAuthnService {
+	if config.Attestation == "" {
+		config.Attestation = "none"
+	}
+	return &webAuthnService{
+		config:   config,
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+func (s *webAuthnService) Enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	count, err := s.repo.CountCredentials(ctx, userID)
+	return count > 0, err
+}
+
+func (s *webAuthnService) BeginRegistration(ctx context.Context, userID uuid.UUID) (*CreationOptions, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.ListCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.newChallenge(ctx, &userID, CeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if displayName == "" {
+		displayName = user.Email
+	}
+	params := make([]CredentialParameter, 0, len(supportedAlgorithms))
+	for _, alg := range supportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return &CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingParty{ID: s.config.RPID, Name: s.config.RPName},
+		User: UserEntity{
+			ID:          encoding.EncodeToString(user.ID[:]),
+			Name:        user.Email,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            s.config.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(existing),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: s.config.Attestation,
+	}, nil
+}
+
+func (s *webAuthnService) FinishRegistration(ctx context.Context, userID uuid.UUID, name string, credential *RegistrationCredential) (*Credential, error) {
+	rawClientData, err := decodeBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	clientData, clientDataHash, err := parseClientData(rawClientData, clientDataCreate, s.config.Origins)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.consumeChallenge(ctx, clientData.Challenge, CeremonyRegistration, &userID); err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := decodeBase64(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, err := parseAttestationObject(rawAttestation)
+	if err != nil {
+		return nil, err
+	}
+	authData := attestation.authData
+	if err := authData.check(s.config.RPID, false); err != nil {
+		return nil, err
+	}
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	// Without a request for attestation, authenticators may still send a
+	// statement, which there is no reason to look at.
+	if s.config.Attestation != "none" {
+		if err := attestation.verify(clientDataHash, key); err != nil {
+			return nil, err
+		}
+	}
+
+	credentialID := encoding.EncodeToString(authData.credentialID)
+	existing, err := s.repo.GetCredential(ctx, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrCredentialExists
+	}
+
+	if name = strings.TrimSpace(name); name == "" {
+		name = defaultCredentialName
+	}
+	if runes := []rune(name); len(runes) > maxCredentialName {
+		name = string(runes[:maxCredentialName])
+	}
+	registered := &Credential{
+		ID:           uuid.New(),
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		Name:         name,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.repo.AddCredential(ctx, registered); err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+func (s *webAuthnService) BeginLogin(ctx context.Context, email string) (*RequestOptions, error) {
+	challenge, err := s.newChallenge(ctx, nil, CeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+	options := &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.config.Timeout.Milliseconds(),
+		RPID:             s.config.RPID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}
+	if email == "" {
+		return options, nil
+	}
+
+	// Unknown emails get the same answer as users without passkeys, so
+	// this can't be used to find out who has an account.
+	user, err := s.userRepo.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil || user == nil {
+		return options, err
+	}
+	credentials, err := s.repo.ListCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	options.AllowCredentials = descriptors(credentials)
+	return options, nil
+}
+
+// FinishLogin signs the user in with a passkey alone, so it requires the
+// authenticator to have verified the user, with a PIN or biometrics.
+func (s *webAuthnService) FinishLogin(ctx context.Context, credential *AssertionCredential) (*users.User, error) {
+	return s.verifyAssertion(ctx, nil, CeremonyLogin, credential)
+}
+
+func (s *webAuthnService) BeginAssertion(ctx context.Context, userID uuid.UUID, ceremony Ceremony) (*RequestOptions, error) {
+	credentials, err := s.repo.ListCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) == 0 {
+		return nil, ErrCredentialNotFound
+	}
+	challenge, err := s.newChallenge(ctx, &userID, ceremony)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.config.Timeout.Milliseconds(),
+		RPID:             s.config.RPID,
+		AllowCredentials: descriptors(credentials),
+		UserVerification: "preferred",
+	}, nil
+}
+
+func (s *webAuthnService) FinishAssertion(ctx context.Context, userID uuid.UUID, ceremony Ceremony, credential *AssertionCredential) (*users.User, error) {
+	return s.verifyAssertion(ctx, &userID, ceremony, credential)
+}
+
+func (s *webAuthnService) Credentials(ctx context.Context, userID uuid.UUID) ([]*Credential, error) {
+	return s.repo.ListCredentials(ctx, userID)
+}
+
+func (s *webAuthnService) Remove(ctx context.Context, userID, id uuid.UUID) error {
+	deleted, err := s.repo.DeleteCredential(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// verifyAssertion runs the checks of WebAuthn §7.2 for userID, or for
+// whoever owns the passkey when userID is nil.
+func (s *webAuthnService) verifyAssertion(ctx context.Context, userID *uuid.UUID, ceremony Ceremony, credential *AssertionCredential) (*users.User, error) {
+	rawClientData, err := decodeBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	clientData, clientDataHash, err := parseClientData(rawClientData, clientDataGet, s.config.Origins)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.consumeChallenge(ctx, clientData.Challenge, ceremony, userID); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.GetCredential(ctx, strings.TrimRight(credential.ID, "="))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || (userID != nil && stored.UserID != *userID) {
+		return nil, fmt.Errorf("%w: unknown passkey", ErrVerificationFailed)
+	}
+	if userID == nil {
+		// A discoverable passkey says whose it is, which must match.
+		userHandle, err := decodeBase64(credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, stored.UserID[:]) {
+			return nil, fmt.Errorf("%w: user handle mismatch", ErrVerificationFailed)
+		}
+	}
+
+	rawAuthData, err := decodeBase64(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := authData.check(s.config.RPID, ceremony == CeremonyLogin); err != nil {
+		return nil, err
+	}
+	key, err := parsePublicKey(stored.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := decodeBase64(credential.Response.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.verify(append(rawAuthData, clientDataHash...), signature); err != nil {
+		return nil, err
+	}
+
+	if (authData.signCount != 0 || stored.SignCount != 0) && authData.signCount <= stored.SignCount {
+		return nil, ErrCredentialCloned
+	}
+	now := time.Now()
+	stored.SignCount = authData.signCount
+	stored.LastUsedAt = &now
+	if err := s.repo.UpdateCredential(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	return s.user(ctx, stored.UserID)
+}
+
+func (s *webAuthnService) newChallenge(ctx context.Context, userID *uuid.UUID, ceremony Ceremony) (string, error) {
+	challenge, record, err := newChallenge(userID, ceremony, s.config.Timeout)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.AddChallenge(ctx, record); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumeChallenge spends the challenge the client signed, which must have
+// been issued for ceremony and, when it names one, for userID.
+func (s *webAuthnService) consumeChallenge(ctx context.Context, challenge string, ceremony Ceremony, userID *uuid.UUID) error {
+	record, err := s.repo.ConsumeChallenge(ctx, hashChallenge(challenge), ceremony, time.Now())
+	if err != nil {
+		return err
+	}
+	if record.UserID != nil && (userID == nil || *record.UserID != *userID) {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+func (s *webAuthnService) user(ctx context.Context, userID uuid.UUID) (*users.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+	return user, nil
+}
+
+func descriptors(credentials []*Credential) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: credential.CredentialID})
+	}
+	return list
+}
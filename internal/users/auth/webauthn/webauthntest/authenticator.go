@@ -0,0 +1,282 @@
+// Package webauthntest provides a software authenticator, so passkey
+// ceremonies can be tested without a browser.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var encoding = base64.RawURLEncoding
+
+// Authenticator creates ES256 passkeys and signs assertions with them, as
+// navigator.credentials would with the options the server sent. It takes
+// and returns JSON so tests exercise the same encoding browsers use.
+type Authenticator struct {
+	// Origin is the origin the browser reports in client data.
+	Origin string
+	// UserVerified sets the UV flag, as if the user entered a PIN.
+	UserVerified bool
+	// Attestation is the statement format: "none", or "packed" for self
+	// attestation.
+	Attestation string
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	userHandle []byte
+	signCount  uint32
+}
+
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerified: true, Attestation: "none"}
+}
+
+// Clone returns an authenticator with copies of a's passkeys, as an
+// attacker who extracted them would have.
+func (a *Authenticator) Clone() *Authenticator {
+	clone := *a
+	clone.credentials = nil
+	for _, c := range a.credentials {
+		copied := *c
+		clone.credentials = append(clone.credentials, &copied)
+	}
+	return &clone
+}
+
+type creationOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		ExcludeCredentials []struct {
+			ID string `json:"id"`
+		} `json:"excludeCredentials"`
+	} `json:"publicKey"`
+}
+
+type requestOptions struct {
+	PublicKey struct {
+		Challenge        string `json:"challenge"`
+		RPID             string `json:"rpId"`
+		AllowCredentials []struct {
+			ID string `json:"id"`
+		} `json:"allowCredentials"`
+	} `json:"publicKey"`
+}
+
+// Register creates a passkey for the creation options in optionsJSON and
+// returns the registration credential JSON.
+func (a *Authenticator) Register(optionsJSON []byte) ([]byte, error) {
+	var options creationOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+	for _, excluded := range options.PublicKey.ExcludeCredentials {
+		if a.find(excluded.ID) != nil {
+			return nil, errors.New("webauthntest: passkey already registered")
+		}
+	}
+	userHandle, err := encoding.DecodeString(options.PublicKey.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	c := &credential{id: id, key: key, userHandle: userHandle}
+	a.credentials = append(a.credentials, c)
+
+	clientData := a.clientData("webauthn.create", options.PublicKey.Challenge)
+	authData := a.authData(options.PublicKey.RP.ID, 0x40, c.signCount)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, coseKey(&key.PublicKey)...)
+
+	statement := []mapEntry{}
+	if a.Attestation == "packed" {
+		signature, err := sign(key, authData, clientData)
+		if err != nil {
+			return nil, err
+		}
+		statement = []mapEntry{{"alg", int64(-7)}, {"sig", signature}}
+	}
+	attestationObject := encodeMap([]mapEntry{
+		{"fmt", a.Attestation},
+		{"attStmt", statement},
+		{"authData", authData},
+	})
+
+	return json.Marshal(map[string]any{
+		"id":    encoding.EncodeToString(id),
+		"rawId": encoding.EncodeToString(id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encoding.EncodeToString(clientData),
+			"attestationObject": encoding.EncodeToString(attestationObject),
+		},
+	})
+}
+
+// Assert signs the request options in optionsJSON with the first passkey
+// they allow, or any passkey when they allow all, and returns the
+// assertion credential JSON.
+func (a *Authenticator) Assert(optionsJSON []byte) ([]byte, error) {
+	var options requestOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+
+	var c *credential
+	if len(options.PublicKey.AllowCredentials) == 0 && len(a.credentials) > 0 {
+		c = a.credentials[0]
+	}
+	for _, allowed := range options.PublicKey.AllowCredentials {
+		if c = a.find(allowed.ID); c != nil {
+			break
+		}
+	}
+	if c == nil {
+		return nil, errors.New("webauthntest: no passkey for these options")
+	}
+
+	c.signCount++
+	clientData := a.clientData("webauthn.get", options.PublicKey.Challenge)
+	authData := a.authData(options.PublicKey.RPID, 0, c.signCount)
+	signature, err := sign(c.key, authData, clientData)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    encoding.EncodeToString(c.id),
+		"rawId": encoding.EncodeToString(c.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encoding.EncodeToString(clientData),
+			"authenticatorData": encoding.EncodeToString(authData),
+			"signature":         encoding.EncodeToString(signature),
+			"userHandle":        encoding.EncodeToString(c.userHandle),
+		},
+	})
+}
+
+func (a *Authenticator) find(id string) *credential {
+	for _, c := range a.credentials {
+		if encoding.EncodeToString(c.id) == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremonyType, challenge string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremonyType,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// authData returns the authenticator data header with the user present
+// flag, UV when the authenticator verifies users, and extra flags.
+func (a *Authenticator) authData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	data := append(slices.Clone(rpIDHash[:]), flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func sign(key *ecdsa.PrivateKey, authData, clientData []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(slices.Clone(authData), clientDataHash[:]...))
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+// coseKey encodes key as an ES256 COSE_Key.
+func coseKey(key *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return encodeMap([]mapEntry{
+		{int64(1), int64(2)},
+		{int64(3), int64(-7)},
+		{int64(-1), int64(1)},
+		{int64(-2), x},
+		{int64(-3), y},
+	})
+}
+
+// mapEntry is a CBOR map entry. Maps are written in the order given.
+type mapEntry struct {
+	key   any
+	value any
+}
+
+func encodeMap(entries []mapEntry) []byte {
+	data := head(5, uint64(len(entries)))
+	for _, entry := range entries {
+		data = append(data, encode(entry.key)...)
+		data = append(data, encode(entry.value)...)
+	}
+	return data
+}
+
+// encode writes the CBOR types the authenticator needs.
+func encode(value any) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []mapEntry:
+		return encodeMap(v)
+	}
+	panic(fmt.Sprintf("webauthntest: can't encode %T", value))
+}
+
+func head(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(argument))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(argument))
+	}
+}
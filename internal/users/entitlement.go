@@ -0,0 +1,37 @@
+package users
+
+// Entitlement is a feature a user's plan gives access to.
+type Entitlement string
+
+const (
+	EntitlementNotes Entitlement = "notes"
+	EntitlementAI    Entitlement = "ai"
+)
+
+var (
+	freeEntitlements    = []Entitlement{EntitlementNotes}
+	premiumEntitlements = []Entitlement{EntitlementNotes, EntitlementAI}
+)
+
+// EntitlementsFor returns the entitlements of the free or premium plan.
+func EntitlementsFor(premium bool) []Entitlement {
+	if premium {
+		return append([]Entitlement(nil), premiumEntitlements...)
+	}
+	return append([]Entitlement(nil), freeEntitlements...)
+}
+
+// IsFree reports whether e comes with the free plan, which keeps it usable
+// after premium runs out.
+func (e Entitlement) IsFree() bool {
+	for _, free := range freeEntitlements {
+		if e == free {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) Entitlements() []Entitlement {
+	return EntitlementsFor(u.IsPremium())
+}
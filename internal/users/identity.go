@@ -0,0 +1,44 @@
+package users
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity is a way of signing in to a user's account: an account at an
+// identity provider, known by the provider's stable subject ID. Email is
+// kept up to date for display only; it is never used to find the user.
+type Identity struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID
+	Provider   string
+	Subject    string
+	Email      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func (Identity) TableName() string {
+	return "user_identities"
+}
+
+func NewIdentity(userID uuid.UUID, provider, subject, email string) *Identity {
+	now := time.Now()
+	return &Identity{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Provider:   provider,
+		Subject:    subject,
+		Email:      email,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+// MarkUsed records a sign-in with the identity, with the email the
+// provider reported for it this time.
+func (i *Identity) MarkUsed(email string) {
+	i.Email = email
+	i.LastUsedAt = time.Now()
+}
@@ -0,0 +1,55 @@
+package users
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type IdentityRepository interface {
+	Add(ctx context.Context, identity *Identity) error
+	Update(ctx context.Context, identity *Identity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*Identity, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*Identity, error)
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func (r *identityRepository) Add(ctx context.Context, identity *Identity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+func (r *identityRepository) Update(ctx context.Context, identity *Identity) error {
+	return r.db.WithContext(ctx).Save(identity).Error
+}
+
+func (r *identityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*Identity, error) {
+	var identity Identity
+	err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*Identity, error) {
+	var identities []*Identity
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	return identities, err
+}
+
+func (r *identityRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&Identity{}).Error
+}
+
+func NewIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
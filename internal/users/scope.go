@@ -0,0 +1,57 @@
+package users
+
+import "strings"
+
+// Scope is what a personal API key or a third-party app may be used for.
+type Scope string
+
+const (
+	ScopeNotesRead   Scope = "notes:read"
+	ScopeNotesWrite  Scope = "notes:write"
+	ScopeAttachments Scope = "attachments"
+	// ScopeAdmin grants every scope, and the routes that don't ask for one.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopes = []Scope{ScopeNotesRead, ScopeNotesWrite, ScopeAttachments, ScopeAdmin}
+
+// IsValid reports whether s is a scope keys can be given.
+func (s Scope) IsValid() bool {
+	for _, scope := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantsScope reports whether a key with granted may use a route that
+// requires scope.
+func GrantsScope(granted []Scope, scope Scope) bool {
+	for _, g := range granted {
+		if g == scope || g == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes splits a space-separated list of scopes, as OAuth writes
+// them. It doesn't check that they're valid.
+func ParseScopes(s string) []Scope {
+	fields := strings.Fields(s)
+	parsed := make([]Scope, 0, len(fields))
+	for _, field := range fields {
+		parsed = append(parsed, Scope(field))
+	}
+	return parsed
+}
+
+// FormatScopes joins scopes the way ParseScopes reads them.
+func FormatScopes(scopes []Scope) string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+	return strings.Join(names, " ")
+}
@@ -14,7 +14,11 @@ type User struct {
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	PremiumUntil *time.Time
-	isActive     bool
+	GraceUntil   *time.Time
+	// PasswordHash is empty for users who only sign in with a provider.
+	PasswordHash    string `json:"-"`
+	EmailVerifiedAt *time.Time
+	isActive        bool
 }
 
 func NewUser(firstName, lastName, email string) *User {
@@ -26,12 +30,28 @@ func NewUser(firstName, lastName, email string) *User {
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 		PremiumUntil: nil,
+		GraceUntil:   nil,
 		isActive:     true,
 	}
 }
 
+// IsPremium is true while premium is paid for and during the grace period
+// after a failed payment.
 func (u *User) IsPremium() bool {
-	return u.PremiumUntil != nil && u.PremiumUntil.After(time.Now())
+	now := time.Now()
+	if u.PremiumUntil != nil && u.PremiumUntil.After(now) {
+		return true
+	}
+	return u.GraceUntil != nil && u.GraceUntil.After(now)
+}
+
+// PremiumEndsAt is when premium runs out, including any grace period, or nil
+// for users who never had premium.
+func (u *User) PremiumEndsAt() *time.Time {
+	if u.GraceUntil != nil && (u.PremiumUntil == nil || u.GraceUntil.After(*u.PremiumUntil)) {
+		return u.GraceUntil
+	}
+	return u.PremiumUntil
 }
 
 func (u *User) ActivatePremium30Days() {
@@ -40,3 +60,78 @@ func (u *User) ActivatePremium30Days() {
 	u.PremiumUntil = &premiumUntil
 	u.UpdatedAt = now
 }
+
+// ExtendPremiumUntil moves PremiumUntil forward to until and ends any grace
+// period. It never shortens premium that already runs past until.
+func (u *User) ExtendPremiumUntil(until time.Time) {
+	u.GraceUntil = nil
+	u.UpdatedAt = time.Now()
+	if u.PremiumUntil != nil && !until.After(*u.PremiumUntil) {
+		return
+	}
+	u.PremiumUntil = &until
+}
+
+// ExtendPremium adds d to premium. Time left on premium that hasn't expired
+// yet is kept, so extensions stack.
+func (u *User) ExtendPremium(d time.Duration) {
+	now := time.Now()
+	start := now
+	if u.PremiumUntil != nil && u.PremiumUntil.After(now) {
+		start = *u.PremiumUntil
+	}
+	premiumUntil := start.Add(d)
+	u.PremiumUntil = &premiumUntil
+	u.GraceUntil = nil
+	u.UpdatedAt = now
+}
+
+// StartGracePeriod keeps the user premium for d after paid premium runs out.
+// Grace counts from the end of paid premium, even one that has passed, and
+// a running grace period is kept, so retried payments that fail again don't
+// extend it.
+func (u *User) StartGracePeriod(d time.Duration) {
+	now := time.Now()
+	if u.GraceUntil != nil && u.GraceUntil.After(now) {
+		return
+	}
+	start := now
+	if u.PremiumUntil != nil {
+		start = *u.PremiumUntil
+	}
+	graceUntil := start.Add(d)
+	u.GraceUntil = &graceUntil
+	u.UpdatedAt = now
+}
+
+// CancelPremium ends premium and any grace period immediately.
+func (u *User) CancelPremium() {
+	now := time.Now()
+	if u.PremiumUntil != nil && u.PremiumUntil.After(now) {
+		u.PremiumUntil = &now
+	}
+	u.GraceUntil = nil
+	u.UpdatedAt = now
+}
+
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u *User) MarkEmailVerified() {
+	if u.EmailVerifiedAt != nil {
+		return
+	}
+	now := time.Now()
+	u.EmailVerifiedAt = &now
+	u.UpdatedAt = now
+}
+
+func (u *User) SetPasswordHash(hash string) {
+	u.PasswordHash = hash
+	u.UpdatedAt = time.Now()
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
@@ -13,6 +14,9 @@ type Repository interface {
 	Update(ctx context.Context, user *User) error
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
+	// GetByIDForUpdate is GetByID that locks the user's row until the
+	// transaction the repository is bound to ends.
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*User, error)
 	ExistsByEmail(ctx context.Context, email string) (bool, error)
 }
 
@@ -54,6 +58,18 @@ func (u *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*User, erro
 	return &user, nil
 }
 
+func (u *userRepository) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*User, error) {
+	var user User
+	err := u.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (u *userRepository) Update(ctx context.Context, user *User) error {
 	return u.db.WithContext(ctx).Save(user).Error
 }
@@ -32,6 +32,7 @@ func TestIsPremium(t *testing.T) {
 	tests := []struct {
 		name           string
 		premiumUntil   *time.Time
+		graceUntil     *time.Time
 		expectedResult bool
 	}{
 		{
@@ -49,12 +50,24 @@ func TestIsPremium(t *testing.T) {
 			premiumUntil:   timePtr(time.Now().Add(24 * time.Hour)),
 			expectedResult: true,
 		},
+		{
+			name:           "User in grace period",
+			premiumUntil:   timePtr(time.Now().Add(-24 * time.Hour)),
+			graceUntil:     timePtr(time.Now().Add(24 * time.Hour)),
+			expectedResult: true,
+		},
+		{
+			name:           "User with expired grace period",
+			premiumUntil:   timePtr(time.Now().Add(-48 * time.Hour)),
+			graceUntil:     timePtr(time.Now().Add(-24 * time.Hour)),
+			expectedResult: false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Arrange
-			user := &User{PremiumUntil: tt.premiumUntil}
+			user := &User{PremiumUntil: tt.premiumUntil, GraceUntil: tt.graceUntil}
 
 			// Act
 			result := user.IsPremium()
@@ -87,6 +100,134 @@ func TestActivatePremium30Days(t *testing.T) {
 	assert.True(t, user.IsPremium(), "User should be premium after activation")
 }
 
+func TestExtendPremiumUntil(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		premiumUntil *time.Time
+		until        time.Time
+		expected     time.Time
+	}{
+		{
+			name:         "Free user",
+			premiumUntil: nil,
+			until:        now.Add(24 * time.Hour),
+			expected:     now.Add(24 * time.Hour),
+		},
+		{
+			name:         "Later date extends",
+			premiumUntil: timePtr(now.Add(24 * time.Hour)),
+			until:        now.Add(48 * time.Hour),
+			expected:     now.Add(48 * time.Hour),
+		},
+		{
+			name:         "Earlier date is ignored",
+			premiumUntil: timePtr(now.Add(48 * time.Hour)),
+			until:        now.Add(24 * time.Hour),
+			expected:     now.Add(48 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			user := &User{PremiumUntil: tt.premiumUntil}
+
+			// Act
+			user.ExtendPremiumUntil(tt.until)
+
+			// Assert
+			assert.Equal(t, tt.expected, *user.PremiumUntil)
+		})
+	}
+}
+
+func TestCancelPremium(t *testing.T) {
+	// Arrange
+	user := NewUser("Jane", "Doe", "jane.doe@example.com")
+	user.ActivatePremium30Days()
+
+	// Act
+	user.CancelPremium()
+
+	// Assert
+	assert.False(t, user.IsPremium(), "User should not be premium after cancelling")
+	assert.NotNil(t, user.PremiumUntil)
+}
+
+func TestCancelPremiumEndsGracePeriod(t *testing.T) {
+	// Arrange
+	user := &User{
+		PremiumUntil: timePtr(time.Now().Add(-time.Hour)),
+		GraceUntil:   timePtr(time.Now().Add(24 * time.Hour)),
+	}
+
+	// Act
+	user.CancelPremium()
+
+	// Assert
+	assert.False(t, user.IsPremium())
+	assert.Nil(t, user.GraceUntil)
+}
+
+func TestExtendPremiumStacks(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		premiumUntil *time.Time
+		expected     time.Time
+	}{
+		{name: "Free user starts now", premiumUntil: nil, expected: now.Add(7 * 24 * time.Hour)},
+		{name: "Expired premium starts now", premiumUntil: timePtr(now.Add(-time.Hour)), expected: now.Add(7 * 24 * time.Hour)},
+		{name: "Active premium is extended", premiumUntil: timePtr(now.Add(3 * 24 * time.Hour)), expected: now.Add(10 * 24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			user := &User{PremiumUntil: tt.premiumUntil, GraceUntil: timePtr(now.Add(time.Hour))}
+
+			// Act
+			user.ExtendPremium(7 * 24 * time.Hour)
+
+			// Assert
+			assert.LessOrEqual(t, tt.expected.Sub(*user.PremiumUntil).Abs(), 2*time.Second)
+			assert.Nil(t, user.GraceUntil, "Extending premium should end the grace period")
+		})
+	}
+}
+
+func TestStartGracePeriod(t *testing.T) {
+	// Arrange
+	premiumUntil := time.Now().Add(24 * time.Hour)
+	user := &User{PremiumUntil: timePtr(premiumUntil)}
+
+	// Act
+	user.StartGracePeriod(3 * 24 * time.Hour)
+
+	// Assert
+	assert.Equal(t, premiumUntil.Add(3*24*time.Hour), *user.GraceUntil, "Grace starts when paid premium ends")
+	assert.Equal(t, user.GraceUntil, user.PremiumEndsAt())
+	assert.True(t, user.IsPremium())
+}
+
+func TestStartGracePeriodAfterPremiumLapsed(t *testing.T) {
+	// Arrange
+	lapsedAt := time.Now().Add(-2 * 24 * time.Hour)
+	user := &User{PremiumUntil: timePtr(lapsedAt)}
+
+	// Act
+	user.StartGracePeriod(7 * 24 * time.Hour)
+	first := *user.GraceUntil
+	user.StartGracePeriod(7 * 24 * time.Hour)
+
+	// Assert
+	assert.Equal(t, lapsedAt.Add(7*24*time.Hour), first, "Grace starts when paid premium ended")
+	assert.Equal(t, first, *user.GraceUntil, "Another failure doesn't extend grace")
+}
+
 // Helper function to create time pointer
 func timePtr(t time.Time) *time.Time {
 	return &t
@@ -0,0 +1,63 @@
+package userstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+// Flow runs requests through a router the way a client would, for tests
+// of sign-in flows. Tests embed it and add the steps of their flow.
+type Flow struct {
+	Router    *gin.Engine
+	JWTConfig jwt.Config
+	UserRepo  *UserRepository
+}
+
+// NewFlow returns a flow with an empty router and existing users. Like the
+// server by default, the router trusts no proxies.
+func NewFlow(t testing.TB, existing ...*users.User) *Flow {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatalf("trust no proxies: %v", err)
+	}
+	return &Flow{
+		Router:    router,
+		JWTConfig: jwt.Config{SecretKey: "secret", ExpiresInHours: 1},
+		UserRepo:  NewUserRepository(existing...),
+	}
+}
+
+// Session returns a session token for user, who just signed in.
+func (f *Flow) Session(t testing.TB, user *users.User) string {
+	t.Helper()
+	token, err := jwt.GenerateToken(f.JWTConfig, user)
+	if err != nil {
+		t.Fatalf("generate session token: %v", err)
+	}
+	return token
+}
+
+// Serve runs request through the router.
+func (f *Flow) Serve(request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	f.Router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Do sends a JSON body, with token as the bearer token unless it's empty.
+func (f *Flow) Do(method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return f.Serve(request)
+}
@@ -0,0 +1,153 @@
+// Package userstest provides in-memory users and identities, and a harness
+// for sign-in flows, so auth code can be tested without a database.
+package userstest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+)
+
+// UserRepository keeps users in memory. Tests may seed and inspect Users
+// directly.
+type UserRepository struct {
+	mu    sync.Mutex
+	Users map[uuid.UUID]*users.User
+	// UpdateErr, when set, fails every Update.
+	UpdateErr error
+	// Updates counts the Updates that succeeded.
+	Updates int
+}
+
+func NewUserRepository(existing ...*users.User) *UserRepository {
+	repo := &UserRepository{Users: make(map[uuid.UUID]*users.User)}
+	for _, user := range existing {
+		repo.Users[user.ID] = user
+	}
+	return repo
+}
+
+func (r *UserRepository) Add(_ context.Context, user *users.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Users[user.ID] = user
+	return nil
+}
+
+func (r *UserRepository) Update(_ context.Context, user *users.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.UpdateErr != nil {
+		return r.UpdateErr
+	}
+	r.Updates++
+	// Saving into the stored user keeps the pointers tests seeded it with
+	// up to date, like a row read back after the save.
+	if existing := r.Users[user.ID]; existing != nil {
+		*existing = *user
+		return nil
+	}
+	r.Users[user.ID] = user
+	return nil
+}
+
+func (r *UserRepository) GetByEmail(_ context.Context, email string) (*users.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.Users {
+		if user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *UserRepository) GetByID(_ context.Context, id uuid.UUID) (*users.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return copyUser(r.Users[id]), nil
+}
+
+func (r *UserRepository) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*users.User, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *UserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	user, _ := r.GetByEmail(ctx, email)
+	return user != nil, nil
+}
+
+// copyUser returns a copy of user, as a database read would, so changes
+// only show once they're saved with Update.
+func copyUser(user *users.User) *users.User {
+	if user == nil {
+		return nil
+	}
+	copied := *user
+	return &copied
+}
+
+// IdentityRepository keeps identities in memory. Tests may seed and
+// inspect Identities directly.
+type IdentityRepository struct {
+	mu         sync.Mutex
+	Identities map[uuid.UUID]*users.Identity
+}
+
+func NewIdentityRepository(existing ...*users.Identity) *IdentityRepository {
+	repo := &IdentityRepository{Identities: make(map[uuid.UUID]*users.Identity)}
+	for _, identity := range existing {
+		repo.Identities[identity.ID] = identity
+	}
+	return repo
+}
+
+func (r *IdentityRepository) Add(_ context.Context, identity *users.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Identities[identity.ID] = identity
+	return nil
+}
+
+func (r *IdentityRepository) Update(ctx context.Context, identity *users.Identity) error {
+	return r.Add(ctx, identity)
+}
+
+func (r *IdentityRepository) GetByProviderSubject(_ context.Context, provider, subject string) (*users.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.Identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *IdentityRepository) ListByUser(_ context.Context, userID uuid.UUID) ([]*users.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var identities []*users.Identity
+	for _, identity := range r.Identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *IdentityRepository) Delete(_ context.Context, userID, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if identity := r.Identities[id]; identity != nil && identity.UserID == userID {
+		delete(r.Identities, id)
+	}
+	return nil
+}
+
+// NoMFA reports two-factor authentication off for every user.
+type NoMFA struct{}
+
+func (NoMFA) Enabled(context.Context, uuid.UUID) (bool, error) { return false, nil }
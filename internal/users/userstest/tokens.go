@@ -0,0 +1,37 @@
+package userstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/nantestech/note-api/pkg/jwt"
+)
+
+// AdminAPIKey accepts any API key as one of UserID's with the admin scope.
+type AdminAPIKey struct {
+	UserID uuid.UUID
+}
+
+func (k AdminAPIKey) Verify(_ context.Context, _ string) (*jwt.Claims, error) {
+	return &jwt.Claims{UserID: k.UserID, TokenType: jwt.TokenTypeAPIKey, Scopes: []users.Scope{users.ScopeAdmin}}, nil
+}
+
+// LegacySessionToken returns a session token for user as issued before
+// tokens had auth_time.
+func LegacySessionToken(t testing.TB, config jwt.Config, user *users.User) string {
+	t.Helper()
+	token, err := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, jwt.Claims{
+		UserID: user.ID,
+		RegisteredClaims: jwtlib.RegisteredClaims{
+			ExpiresAt: jwtlib.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(config.SecretKey))
+	if err != nil {
+		t.Fatalf("sign legacy session token: %v", err)
+	}
+	return token
+}
@@ -0,0 +1,196 @@
+// Package cbor decodes the subset of CBOR (RFC 8949) that WebAuthn
+// authenticators produce: definite-length integers, byte and text strings,
+// arrays, maps and the simple values false, true and null.
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+var ErrMalformed = errors.New("malformed CBOR")
+
+// maxDepth bounds nesting, so hostile input can't exhaust the stack.
+const maxDepth = 16
+
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorSimple   = 7
+)
+
+// Decode decodes data, which must hold exactly one item. Integers decode
+// to int64, byte strings to []byte, text strings to string, arrays to
+// []any, maps to map[any]any with int64 or string keys, and simple values
+// to bool or nil.
+func Decode(data []byte) (any, error) {
+	value, rest, err := DecodeFirst(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrMalformed, len(rest))
+	}
+	return value, nil
+}
+
+// DecodeFirst decodes the item at the start of data and returns the bytes
+// after it.
+func DecodeFirst(data []byte) (any, []byte, error) {
+	d := &decoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, d.data[d.offset:], nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *decoder) decode(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", ErrMalformed)
+	}
+
+	major, argument, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUnsigned:
+		if argument > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflows int64", ErrMalformed)
+		}
+		return int64(argument), nil
+	case majorNegative:
+		if argument > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflows int64", ErrMalformed)
+		}
+		return -1 - int64(argument), nil
+	case majorBytes:
+		return d.bytes(argument)
+	case majorText:
+		text, err := d.bytes(argument)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(text) {
+			return nil, fmt.Errorf("%w: text string is not UTF-8", ErrMalformed)
+		}
+		return string(text), nil
+	case majorArray:
+		// Every item takes at least a byte, which bounds the allocation.
+		if argument > uint64(d.remaining()) {
+			return nil, fmt.Errorf("%w: truncated array", ErrMalformed)
+		}
+		array := make([]any, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+	case majorMap:
+		if argument > uint64(d.remaining())/2 {
+			return nil, fmt.Errorf("%w: truncated map", ErrMalformed)
+		}
+		entries := make(map[any]any, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: map key is not an integer or text", ErrMalformed)
+			}
+			if _, ok := entries[key]; ok {
+				return nil, fmt.Errorf("%w: duplicate map key %v", ErrMalformed, key)
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			entries[key] = value
+		}
+		return entries, nil
+	case majorSimple:
+		switch argument {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: unsupported simple value %d", ErrMalformed, argument)
+	}
+	return nil, fmt.Errorf("%w: unsupported major type %d", ErrMalformed, major)
+}
+
+// head reads an item's initial byte and argument.
+func (d *decoder) head() (byte, uint64, error) {
+	if d.remaining() < 1 {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+	}
+	initial := d.data[d.offset]
+	d.offset++
+	major, info := initial>>5, initial&0x1f
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// 28-30 are reserved and 31 is indefinite length, which
+		// authenticators don't use.
+		return 0, 0, fmt.Errorf("%w: unsupported additional information %d", ErrMalformed, info)
+	}
+	if major == majorSimple && size > 1 {
+		return 0, 0, fmt.Errorf("%w: floating-point numbers are not supported", ErrMalformed)
+	}
+	if d.remaining() < size {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+	}
+
+	buf := make([]byte, 8)
+	copy(buf[8-size:], d.data[d.offset:d.offset+size])
+	d.offset += size
+	return major, binary.BigEndian.Uint64(buf), nil
+}
+
+func (d *decoder) bytes(length uint64) ([]byte, error) {
+	if length > uint64(d.remaining()) {
+		return nil, fmt.Errorf("%w: truncated string", ErrMalformed)
+	}
+	value := make([]byte, length)
+	copy(value, d.data[d.offset:])
+	d.offset += int(length)
+	return value, nil
+}
+
+func (d *decoder) remaining() int {
+	return len(d.data) - d.offset
+}
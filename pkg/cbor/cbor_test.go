@@ -0,0 +1,86 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Examples from RFC 8949 Appendix A.
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		hex      string
+		expected any
+	}{
+		{name: "Small integer", hex: "17", expected: int64(23)},
+		{name: "One-byte integer", hex: "1818", expected: int64(24)},
+		{name: "Eight-byte integer", hex: "1b000000e8d4a51000", expected: int64(1000000000000)},
+		{name: "Negative integer", hex: "3903e7", expected: int64(-1000)},
+		{name: "Byte string", hex: "4401020304", expected: []byte{1, 2, 3, 4}},
+		{name: "Text string", hex: "62c3bc", expected: "ü"},
+		{name: "Nested array", hex: "8301820203820405", expected: []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{name: "Map", hex: "a201020304", expected: map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{name: "Map with text keys", hex: "a26161016162820203", expected: map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{name: "Simple values", hex: "83f4f5f6", expected: []any{false, true, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			data, err := hex.DecodeString(tt.hex)
+			require.NoError(t, err)
+
+			// Act
+			value, err := Decode(data)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
+
+func TestDecodeRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{name: "Empty", hex: ""},
+		{name: "Truncated byte string", hex: "4401"},
+		{name: "Array longer than the data", hex: "9bffffffffffffffff"},
+		{name: "Indefinite length", hex: "5f42010243030405ff"},
+		{name: "Float", hex: "f93c00"},
+		{name: "Duplicate map key", hex: "a201020103"},
+		{name: "Array map key", hex: "a18001"},
+		{name: "Invalid UTF-8", hex: "61ff"},
+		{name: "Trailing bytes", hex: "0101"},
+		{name: "Nested too deeply", hex: "818181818181818181818181818181818181"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			data, err := hex.DecodeString(tt.hex)
+			require.NoError(t, err)
+
+			// Act
+			_, err = Decode(data)
+
+			// Assert
+			assert.ErrorIs(t, err, ErrMalformed)
+		})
+	}
+}
+
+func TestDecodeFirstReturnsRest(t *testing.T) {
+	// Act
+	value, rest, err := DecodeFirst([]byte{0x01, 0xa0})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+	assert.Equal(t, []byte{0xa0}, rest)
+}
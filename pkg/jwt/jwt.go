@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -8,15 +10,81 @@ import (
 	"github.com/nantestech/note-api/internal/users"
 )
 
+// TokenType tells session tokens from tokens that only prove part of a
+// sign-in.
+type TokenType string
+
+const (
+	TokenTypeSession TokenType = "session"
+	// TokenTypeMFAPending proves the first factor of a sign-in and can
+	// only be traded for a session token with a second factor.
+	TokenTypeMFAPending TokenType = "mfa_pending"
+	// TokenTypeAPIKey marks the claims of a request made with a personal
+	// API key. They are built per request and never signed.
+	TokenTypeAPIKey TokenType = "api_key"
+	// TokenTypeOAuthAccess lets a third-party app act for a user, within
+	// the scopes the user consented to.
+	TokenTypeOAuthAccess TokenType = "oauth_access"
+)
+
+var ErrWrongTokenType = errors.New("token is not valid for this use")
+
 type Claims struct {
-	Email        string    `json:"email"`
-	Name         string    `json:"name"`
-	UserID       uuid.UUID `json:"userId"`
-	IsPremium    bool      `json:"isPremium"`
-	PremiumUntil string    `json:"premiumUntil"`
+	Email        string              `json:"email"`
+	Name         string              `json:"name"`
+	UserID       uuid.UUID           `json:"userId"`
+	IsPremium    bool                `json:"isPremium"`
+	PremiumUntil *time.Time          `json:"premiumUntil,omitempty"`
+	Entitlements []users.Entitlement `json:"entitlements"`
+	// AuthTime is when the user last actually signed in. Refreshed tokens
+	// keep it, so sensitive actions can ask for a recent sign-in.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// StepUpAt is when the user last confirmed their presence with a
+	// passkey, which the most sensitive actions ask for.
+	StepUpAt *jwt.NumericDate `json:"step_up_at,omitempty"`
+	// TokenType is empty in session tokens issued before it existed.
+	TokenType TokenType `json:"token_type,omitempty"`
+	// Scopes limits what an API key or OAuth access token may do.
+	// Sessions have none and may do anything.
+	Scopes []users.Scope `json:"scopes,omitempty"`
+	// ClientID is the third-party app an OAuth access token was issued to.
+	ClientID string `json:"client_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
+func (c *Claims) IsMFAPending() bool {
+	return c.TokenType == TokenTypeMFAPending
+}
+
+func (c *Claims) IsAPIKey() bool {
+	return c.TokenType == TokenTypeAPIKey
+}
+
+func (c *Claims) IsOAuthAccess() bool {
+	return c.TokenType == TokenTypeOAuthAccess
+}
+
+// IsScoped reports whether the claims may only do what Scopes allow.
+func (c *Claims) IsScoped() bool {
+	return c.IsAPIKey() || c.IsOAuthAccess()
+}
+
+// PremiumAt reports whether the token grants premium at t. A token issued
+// while the user was premium stops granting it once premiumUntil passes,
+// even if the token itself is still valid.
+func (c *Claims) PremiumAt(t time.Time) bool {
+	return c.IsPremium && c.PremiumUntil != nil && c.PremiumUntil.After(t)
+}
+
+// HasEntitlementAt reports whether the token grants e at t. Entitlements
+// that come with premium only are granted while PremiumAt(t).
+func (c *Claims) HasEntitlementAt(e users.Entitlement, t time.Time) bool {
+	if !slices.Contains(c.Entitlements, e) {
+		return false
+	}
+	return e.IsFree() || c.PremiumAt(t)
+}
+
 type Config struct {
 	SecretKey      string
 	Issuer         string
@@ -24,17 +92,127 @@ type Config struct {
 	ExpiresInHours int //hours
 }
 
+// AuthenticatedWithin reports whether the user signed in less than maxAge
+// before now.
+func (c *Claims) AuthenticatedWithin(maxAge time.Duration, now time.Time) bool {
+	return c.AuthTime != nil && now.Sub(c.AuthTime.Time) < maxAge
+}
+
+// SteppedUpWithin reports whether the user confirmed their presence with a
+// passkey less than maxAge before now.
+func (c *Claims) SteppedUpWithin(maxAge time.Duration, now time.Time) bool {
+	return c.StepUpAt != nil && now.Sub(c.StepUpAt.Time) < maxAge
+}
+
+// GenerateToken issues a token for a user who just signed in.
 func GenerateToken(config Config, user *users.User) (string, error) {
+	return GenerateTokenAt(config, user, time.Now())
+}
+
+// GenerateTokenAt issues a token for a user who signed in at authTime.
+func GenerateTokenAt(config Config, user *users.User, authTime time.Time) (string, error) {
+	return generateSessionToken(config, user, jwt.NewNumericDate(authTime), nil)
+}
+
+// GenerateSteppedUpToken issues a token for a user who signed in at
+// authTime and last used a passkey at stepUpAt.
+func GenerateSteppedUpToken(config Config, user *users.User, authTime, stepUpAt time.Time) (string, error) {
+	return generateSessionToken(config, user, jwt.NewNumericDate(authTime), jwt.NewNumericDate(stepUpAt))
+}
+
+// RefreshSessionToken issues a new token for the session of claims.
+// Refreshing isn't signing in, so the sign-in and step-up times carry over
+// as they are, missing ones included.
+func RefreshSessionToken(config Config, user *users.User, claims *Claims) (string, error) {
+	return generateSessionToken(config, user, claims.AuthTime, claims.StepUpAt)
+}
+
+// StepUpSessionToken issues a new token for the session of claims, whose
+// user just used a passkey at stepUpAt. The sign-in time carries over as
+// it is, a missing one included.
+func StepUpSessionToken(config Config, user *users.User, claims *Claims, stepUpAt time.Time) (string, error) {
+	return generateSessionToken(config, user, claims.AuthTime, jwt.NewNumericDate(stepUpAt))
+}
+
+func generateSessionToken(config Config, user *users.User, authTime, stepUpAt *jwt.NumericDate) (string, error) {
 	expirationTime := time.Now().Add(time.Hour * time.Duration(config.ExpiresInHours))
 
+	claims := userClaims(user)
+	claims.AuthTime = authTime
+	claims.StepUpAt = stepUpAt
+	claims.TokenType = TokenTypeSession
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expirationTime),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    config.Issuer,
+		Audience:  []string{config.Audience},
+		ID:        user.ID.String(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(config.SecretKey))
+
+	return tokenString, err
+}
+
+// APIKeyClaims returns the claims of a request user made with an API key
+// limited to scopes. They have no auth_time, so routes that ask for a
+// recent sign-in refuse API keys.
+func APIKeyClaims(user *users.User, scopes []users.Scope) *Claims {
+	claims := userClaims(user)
+	claims.TokenType = TokenTypeAPIKey
+	claims.Scopes = scopes
+	return claims
+}
+
+// GenerateOAuthAccessToken issues a token, valid for ttl, that lets the
+// app clientID act for user within scopes. Its ID is grantID, so revoking
+// the grant revokes the token.
+func GenerateOAuthAccessToken(config Config, user *users.User, clientID string, grantID uuid.UUID, scopes []users.Scope, ttl time.Duration) (string, error) {
+	claims := userClaims(user)
+	claims.TokenType = TokenTypeOAuthAccess
+	claims.Scopes = scopes
+	claims.ClientID = clientID
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Subject:   user.ID.String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    config.Issuer,
+		Audience:  []string{config.Audience},
+		ID:        grantID.String(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.SecretKey))
+}
+
+func userClaims(user *users.User) *Claims {
 	claims := &Claims{
 		Email:        user.Email,
 		Name:         user.FirstName + " " + user.LastName,
 		UserID:       user.ID,
 		IsPremium:    user.IsPremium(),
-		PremiumUntil: user.PremiumUntil.Format(time.RFC3339),
+		Entitlements: user.Entitlements(),
+	}
+
+	// Free users carry no premiumUntil at all; expired users keep it so
+	// clients can tell when premium ended.
+	if endsAt := user.PremiumEndsAt(); endsAt != nil {
+		premiumUntil := endsAt.UTC().Truncate(time.Second)
+		claims.PremiumUntil = &premiumUntil
+	}
+	return claims
+}
+
+// GenerateMFAPendingToken issues a token, valid for ttl, for a user who
+// passed the first factor of a sign-in at authTime.
+func GenerateMFAPendingToken(config Config, user *users.User, authTime time.Time, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:    user.ID,
+		AuthTime:  jwt.NewNumericDate(authTime),
+		TokenType: TokenTypeMFAPending,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    config.Issuer,
 			Audience:  []string{config.Audience},
@@ -43,12 +221,49 @@ func GenerateToken(config Config, user *users.User) (string, error) {
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.SecretKey))
-
-	return tokenString, err
+	return token.SignedString([]byte(config.SecretKey))
 }
 
+// ValidateToken validates a session token. Tokens of any other type are
+// rejected with ErrWrongTokenType.
 func ValidateToken(config Config, tokenString string) (*Claims, error) {
+	claims, err := parse(config, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != "" && claims.TokenType != TokenTypeSession {
+		return nil, ErrWrongTokenType
+	}
+	return claims, nil
+}
+
+// ValidateMFAPendingToken validates a token from GenerateMFAPendingToken.
+func ValidateMFAPendingToken(config Config, tokenString string) (*Claims, error) {
+	claims, err := parse(config, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsMFAPending() {
+		return nil, ErrWrongTokenType
+	}
+	return claims, nil
+}
+
+// ValidateOAuthAccessToken validates a token from
+// GenerateOAuthAccessToken. It doesn't check whether the grant has been
+// revoked since.
+func ValidateOAuthAccessToken(config Config, tokenString string) (*Claims, error) {
+	claims, err := parse(config, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsOAuthAccess() {
+		return nil, ErrWrongTokenType
+	}
+	return claims, nil
+}
+
+func parse(config Config, tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
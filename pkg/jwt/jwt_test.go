@@ -0,0 +1,203 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nantestech/note-api/internal/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{
+	SecretKey:      "test-secret",
+	Issuer:         "note",
+	Audience:       "note-web",
+	ExpiresInHours: 1,
+}
+
+func TestGenerateTokenPremiumClaims(t *testing.T) {
+	activeUntil := time.Now().Add(24 * time.Hour)
+	expiredAt := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name                 string
+		premiumUntil         *time.Time
+		expectedPremium      bool
+		expectedPremiumUntil *time.Time
+		expectedEntitlements []users.Entitlement
+	}{
+		{
+			name:                 "Free user",
+			premiumUntil:         nil,
+			expectedPremium:      false,
+			expectedPremiumUntil: nil,
+			expectedEntitlements: []users.Entitlement{users.EntitlementNotes},
+		},
+		{
+			name:                 "Active premium user",
+			premiumUntil:         &activeUntil,
+			expectedPremium:      true,
+			expectedPremiumUntil: &activeUntil,
+			expectedEntitlements: []users.Entitlement{users.EntitlementNotes, users.EntitlementAI},
+		},
+		{
+			name:                 "Expired premium user",
+			premiumUntil:         &expiredAt,
+			expectedPremium:      false,
+			expectedPremiumUntil: &expiredAt,
+			expectedEntitlements: []users.Entitlement{users.EntitlementNotes},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			user := users.NewUser("Jane", "Doe", "jane@example.com")
+			user.PremiumUntil = tt.premiumUntil
+
+			// Act
+			token, err := GenerateToken(testConfig, user)
+			require.NoError(t, err)
+			claims, err := ValidateToken(testConfig, token)
+			require.NoError(t, err)
+
+			// Assert
+			assert.Equal(t, user.ID, claims.UserID)
+			assert.Equal(t, tt.expectedPremium, claims.IsPremium)
+			assert.Equal(t, tt.expectedPremium, claims.PremiumAt(time.Now()))
+			assert.Equal(t, tt.expectedEntitlements, claims.Entitlements)
+			if tt.expectedPremiumUntil == nil {
+				assert.Nil(t, claims.PremiumUntil)
+				assert.NotContains(t, rawClaims(t, token), "premiumUntil", "Free users should carry no premiumUntil")
+			} else {
+				require.NotNil(t, claims.PremiumUntil)
+				assert.WithinDuration(t, *tt.expectedPremiumUntil, *claims.PremiumUntil, time.Second)
+			}
+		})
+	}
+}
+
+func TestGenerateTokenIncludesGracePeriod(t *testing.T) {
+	// Arrange
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	user.PremiumUntil = timePtr(time.Now().Add(-time.Hour))
+	user.GraceUntil = timePtr(time.Now().Add(48 * time.Hour))
+
+	// Act
+	token, err := GenerateToken(testConfig, user)
+	require.NoError(t, err)
+	claims, err := ValidateToken(testConfig, token)
+	require.NoError(t, err)
+
+	// Assert
+	assert.True(t, claims.IsPremium)
+	assert.WithinDuration(t, *user.GraceUntil, *claims.PremiumUntil, time.Second)
+}
+
+func TestHasEntitlementAt(t *testing.T) {
+	now := time.Now()
+	claims := &Claims{
+		IsPremium:    true,
+		PremiumUntil: timePtr(now.Add(time.Hour)),
+		Entitlements: []users.Entitlement{users.EntitlementNotes, users.EntitlementAI},
+	}
+
+	tests := []struct {
+		name        string
+		entitlement users.Entitlement
+		at          time.Time
+		expected    bool
+	}{
+		{name: "Premium entitlement while premium", entitlement: users.EntitlementAI, at: now, expected: true},
+		{name: "Premium entitlement after premium ended", entitlement: users.EntitlementAI, at: now.Add(2 * time.Hour), expected: false},
+		{name: "Free entitlement after premium ended", entitlement: users.EntitlementNotes, at: now.Add(2 * time.Hour), expected: true},
+		{name: "Entitlement not in token", entitlement: "export", at: now, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, claims.HasEntitlementAt(tt.entitlement, tt.at))
+		})
+	}
+}
+
+func TestValidateTokenRejectsWrongSecret(t *testing.T) {
+	// Arrange
+	token, err := GenerateToken(testConfig, users.NewUser("Jane", "Doe", "jane@example.com"))
+	require.NoError(t, err)
+	otherConfig := testConfig
+	otherConfig.SecretKey = "other-secret"
+
+	// Act
+	_, err = ValidateToken(otherConfig, token)
+
+	// Assert
+	assert.Error(t, err)
+}
+
+func TestMFAPendingTokenIsNotASession(t *testing.T) {
+	// Arrange
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	pending, err := GenerateMFAPendingToken(testConfig, user, time.Now(), 5*time.Minute)
+	require.NoError(t, err)
+	session, err := GenerateToken(testConfig, user)
+	require.NoError(t, err)
+
+	// Act
+	_, sessionErr := ValidateToken(testConfig, pending)
+	claims, pendingErr := ValidateMFAPendingToken(testConfig, pending)
+	_, wrongTypeErr := ValidateMFAPendingToken(testConfig, session)
+
+	// Assert
+	assert.ErrorIs(t, sessionErr, ErrWrongTokenType)
+	require.NoError(t, pendingErr)
+	assert.Equal(t, user.ID, claims.UserID)
+	assert.ErrorIs(t, wrongTypeErr, ErrWrongTokenType)
+}
+
+func TestOAuthAccessTokenIsNotASession(t *testing.T) {
+	// Arrange
+	user := users.NewUser("Jane", "Doe", "jane@example.com")
+	grantID := uuid.New()
+	access, err := GenerateOAuthAccessToken(testConfig, user, "client", grantID, []users.Scope{users.ScopeNotesRead}, time.Hour)
+	require.NoError(t, err)
+	session, err := GenerateToken(testConfig, user)
+	require.NoError(t, err)
+
+	// Act
+	_, sessionErr := ValidateToken(testConfig, access)
+	claims, accessErr := ValidateOAuthAccessToken(testConfig, access)
+	_, wrongTypeErr := ValidateOAuthAccessToken(testConfig, session)
+
+	// Assert
+	assert.ErrorIs(t, sessionErr, ErrWrongTokenType)
+	require.NoError(t, accessErr)
+	assert.True(t, claims.IsScoped())
+	assert.Nil(t, claims.AuthTime, "Apps must not pass fresh sign-in checks")
+	assert.Equal(t, "client", claims.ClientID)
+	assert.Equal(t, grantID.String(), claims.ID)
+	assert.Equal(t, []users.Scope{users.ScopeNotesRead}, claims.Scopes)
+	assert.ErrorIs(t, wrongTypeErr, ErrWrongTokenType)
+}
+
+// rawClaims decodes the payload of token without verifying it.
+func rawClaims(t *testing.T, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
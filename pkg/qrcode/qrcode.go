@@ -0,0 +1,474 @@
+// Package qrcode encodes QR codes (ISO/IEC 18004) in byte mode at error
+// correction level M, which is what otpauth:// URIs and links need.
+package qrcode
+
+import (
+	"errors"
+)
+
+var ErrTooLong = errors.New("data is too long for a QR code")
+
+// Code is an encoded QR code: a square of dark and light modules.
+type Code struct {
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// version describes a QR version at level M: its error correction
+// codewords per block and the number of blocks and data codewords of each
+// of its two block groups.
+type version struct {
+	eccPerBlock int
+	blocks1     int
+	data1       int
+	blocks2     int
+	data2       int
+	alignment   []int
+}
+
+var versions = []version{
+	1:  {10, 1, 16, 0, 0, nil},
+	2:  {16, 1, 28, 0, 0, []int{6, 18}},
+	3:  {26, 1, 44, 0, 0, []int{6, 22}},
+	4:  {18, 2, 32, 0, 0, []int{6, 26}},
+	5:  {24, 2, 43, 0, 0, []int{6, 30}},
+	6:  {16, 4, 27, 0, 0, []int{6, 34}},
+	7:  {18, 4, 31, 0, 0, []int{6, 22, 38}},
+	8:  {22, 2, 38, 2, 39, []int{6, 24, 42}},
+	9:  {22, 3, 36, 2, 37, []int{6, 26, 46}},
+	10: {26, 4, 43, 1, 44, []int{6, 28, 50}},
+	11: {30, 1, 50, 4, 51, []int{6, 30, 54}},
+	12: {22, 6, 36, 2, 37, []int{6, 32, 58}},
+	13: {22, 8, 37, 1, 38, []int{6, 34, 62}},
+	14: {24, 4, 40, 5, 41, []int{6, 26, 46, 66}},
+	15: {24, 5, 41, 5, 42, []int{6, 26, 48, 70}},
+	16: {28, 7, 45, 3, 46, []int{6, 26, 50, 74}},
+	17: {28, 10, 46, 1, 47, []int{6, 30, 54, 78}},
+	18: {26, 9, 43, 4, 44, []int{6, 30, 56, 82}},
+	19: {26, 3, 44, 11, 45, []int{6, 30, 58, 86}},
+	20: {26, 3, 41, 13, 42, []int{6, 34, 62, 90}},
+}
+
+func (v version) dataCodewords() int {
+	return v.blocks1*v.data1 + v.blocks2*v.data2
+}
+
+// Encode encodes data in the smallest version that fits it, with the mask
+// that scores the lowest penalty.
+func Encode(data []byte) (*Code, error) {
+	for number := 1; number < len(versions); number++ {
+		if bits := 4 + countBits(number) + 8*len(data); bits <= versions[number].dataCodewords()*8 {
+			return encode(data, number, -1), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+// encode builds the code for a version, with mask, or the best mask when
+// mask is negative.
+func encode(data []byte, number int, mask int) *Code {
+	size := number*4 + 17
+	code := &Code{size: size, modules: newGrid(size), isFunction: newGrid(size)}
+	code.drawFunctionPatterns(number)
+	code.drawCodewords(interleave(dataCodewords(data, number), versions[number]))
+
+	if mask < 0 {
+		best := 0
+		for candidate := 0; candidate < 8; candidate++ {
+			code.applyMask(candidate)
+			code.drawFormatBits(candidate)
+			if penalty := code.penalty(); candidate == 0 || penalty < best {
+				best, mask = penalty, candidate
+			}
+			code.applyMask(candidate)
+		}
+	}
+
+	code.applyMask(mask)
+	code.drawFormatBits(mask)
+	return code
+}
+
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+func countBits(number int) int {
+	if number < 10 {
+		return 8
+	}
+	return 16
+}
+
+// dataCodewords encodes data as a single byte mode segment, padded to the
+// version's data capacity.
+func dataCodewords(data []byte, number int) []byte {
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), countBits(number))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacity := versions[number].dataCodewords() * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return codewords
+}
+
+// interleave splits data into the version's blocks, adds error correction
+// to each and interleaves the blocks' codewords.
+func interleave(data []byte, v version) []byte {
+	var blocks [][]byte
+	for i := 0; i < v.blocks1+v.blocks2; i++ {
+		length := v.data1
+		if i >= v.blocks1 {
+			length = v.data2
+		}
+		blocks = append(blocks, data[:length])
+		data = data[length:]
+	}
+
+	divisor := reedSolomonDivisor(v.eccPerBlock)
+	var result []byte
+	for i := 0; i < max(v.data1, v.data2); i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	eccBlocks := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		eccBlocks[i] = reedSolomonRemainder(block, divisor)
+	}
+	for i := 0; i < v.eccPerBlock; i++ {
+		for _, ecc := range eccBlocks {
+			result = append(result, ecc[i])
+		}
+	}
+	return result
+}
+
+func (c *Code) drawFunctionPatterns(number int) {
+	for i := 0; i < c.size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	positions := versions[number].alignment
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Alignment patterns don't overlap the finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn with the mask.
+	c.drawFormatBits(0)
+	c.drawVersion(number)
+}
+
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.size || yy < 0 || yy >= c.size {
+				continue
+			}
+			distance := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, distance != 2 && distance != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the level and mask, protected by a
+// BCH code.
+func (c *Code) drawFormatBits(mask int) {
+	// Level M is 00.
+	data := mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.size-8, true)
+}
+
+// drawVersion draws both copies of the version, from version 7 on.
+func (c *Code) drawVersion(number int) {
+	if number < 7 {
+		return
+	}
+
+	remainder := number
+	for i := 0; i < 12; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 11) * 0x1F25)
+	}
+	bits := number<<12 | remainder
+
+	for i := 0; i < 18; i++ {
+		a, b := c.size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in two-module columns, zigzagging up
+// and down from the bottom right corner around the function patterns.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vertical := 0; vertical < c.size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vertical
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vertical
+				}
+				if !c.isFunction[y][x] && i < len(codewords)*8 {
+					c.modules[y][x] = bit(int(codewords[i>>3]), 7-(i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules the mask selects. Applying the same
+// mask twice undoes it.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			c.modules[y][x] = c.modules[y][x] != invert
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to read, by the four rules of the
+// standard: long runs, 2x2 blocks, finder-like patterns and imbalance
+// between dark and light.
+func (c *Code) penalty() int {
+	score := 0
+	for i := 0; i < c.size; i++ {
+		row := make([]bool, c.size)
+		column := make([]bool, c.size)
+		for j := 0; j < c.size; j++ {
+			row[j] = c.modules[i][j]
+			column[j] = c.modules[j][i]
+		}
+		score += linePenalty(row) + linePenalty(column)
+	}
+
+	dark := 0
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.size && y+1 < c.size {
+				color := c.modules[y][x]
+				if color == c.modules[y][x+1] && color == c.modules[y+1][x] && color == c.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	total := c.size * c.size
+	deviation := abs(dark*20-total*10) / total
+	return score + deviation*10
+}
+
+var finderLike = []bool{true, false, true, true, true, false, true}
+
+func linePenalty(line []bool) int {
+	score := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += 3 + run - 5
+		}
+		run = 1
+	}
+
+	for i := 0; i+len(finderLike) <= len(line); i++ {
+		if !matches(line[i:], finderLike) {
+			continue
+		}
+		if lightRun(line, i-4, i) || lightRun(line, i+7, i+11) {
+			score += 40
+		}
+	}
+	return score
+}
+
+func matches(line, pattern []bool) bool {
+	for i, dark := range pattern {
+		if line[i] != dark {
+			return false
+		}
+	}
+	return true
+}
+
+// lightRun reports whether modules from up to to are light, counting those
+// outside the symbol, which are quiet zone.
+func lightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 != 0)
+	}
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+func bit(value, i int) bool {
+	return (value>>i)&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
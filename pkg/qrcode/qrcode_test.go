@@ -0,0 +1,105 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeMatchesReferenceSymbol(t *testing.T) {
+	// Arrange: "otpauth://x" at version 1, level M, mask 3
+	expected := []string{
+		"#######.#####.#######",
+		"#.....#.#.###.#.....#",
+		"#.###.#....##.#.###.#",
+		"#.###.#.#.##..#.###.#",
+		"#.###.#..###..#.###.#",
+		"#.....#..#.##.#.....#",
+		"#######.#.#.#.#######",
+		"........#####........",
+		"#.##.###...##.#..#.##",
+		"#####..#...##.#.#####",
+		"##..#####.##.....#.##",
+		"#####....#.#.#..##..#",
+		"#.#..####.#.#.####.##",
+		"........#..#.#..##...",
+		"#######.#####.###....",
+		"#.....#.#......#.####",
+		"#.###.#..##.#..#.##..",
+		"#.###.#.##....##...#.",
+		"#.###.#.###.###..##..",
+		"#.....#....#.###....#",
+		"#######.###.#.#####..",
+	}
+
+	// Act
+	code := encode([]byte("otpauth://x"), 1, 3)
+
+	// Assert
+	require.Equal(t, len(expected), code.Size())
+	for y, row := range expected {
+		var actual strings.Builder
+		for x := 0; x < code.Size(); x++ {
+			if code.Dark(x, y) {
+				actual.WriteByte('#')
+			} else {
+				actual.WriteByte('.')
+			}
+		}
+		assert.Equal(t, row, actual.String(), "row %d", y)
+	}
+}
+
+func TestEncodePicksSmallestVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		length       int
+		expectedSize int
+		expectedErr  error
+	}{
+		{name: "Version 1", length: 14, expectedSize: 21},
+		{name: "Version 2", length: 15, expectedSize: 25},
+		{name: "Typical otpauth URI", length: 150, expectedSize: 49},
+		{name: "Version 20", length: 666, expectedSize: 97},
+		{name: "Too long", length: 667, expectedErr: ErrTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			code, err := Encode(bytes.Repeat([]byte("a"), tt.length))
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSize, code.Size())
+		})
+	}
+}
+
+func TestPNG(t *testing.T) {
+	// Arrange
+	code, err := Encode([]byte("otpauth://totp/Note:jane@example.com"))
+	require.NoError(t, err)
+
+	// Act
+	encoded, err := code.PNG(4)
+
+	// Assert
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(encoded))
+	require.NoError(t, err)
+	width := (code.Size() + 2*quietZone) * 4
+	assert.Equal(t, width, img.Bounds().Dx())
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.NotZero(t, r, "Quiet zone is light")
+	r, _, _, _ = img.At(quietZone*4, quietZone*4).RGBA()
+	assert.Zero(t, r, "Finder pattern corner is dark")
+}
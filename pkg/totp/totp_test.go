@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFCVectors(t *testing.T) {
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			// Act
+			code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+}
+
+func TestValidateAllowsOneStepOfDrift(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		name     string
+		offset   time.Duration
+		expected bool
+	}{
+		{name: "Current step", offset: 0, expected: true},
+		{name: "Previous step", offset: -Period, expected: true},
+		{name: "Next step", offset: Period, expected: true},
+		{name: "Two steps behind", offset: -2 * Period, expected: false},
+		{name: "Two steps ahead", offset: 2 * Period, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			code, err := Code(rfcSecret, Step(now.Add(tt.offset)))
+			require.NoError(t, err)
+
+			// Act
+			step, ok := Validate(rfcSecret, code, now)
+
+			// Assert
+			assert.Equal(t, tt.expected, ok)
+			if ok {
+				assert.Equal(t, Step(now.Add(tt.offset)), step)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	// Act
+	uri, err := url.Parse(URI("Note", "jane@example.com", rfcSecret))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Note:jane@example.com", uri.Path)
+	assert.Equal(t, rfcSecret, uri.Query().Get("secret"))
+	assert.Equal(t, "Note", uri.Query().Get("issuer"))
+}
@@ -0,0 +1,29 @@
+CREATE TABLE plan_limits (
+    plan VARCHAR(20) NOT NULL,
+    metric VARCHAR(50) NOT NULL,
+    period VARCHAR(20) NOT NULL,
+    "limit" BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (plan, metric)
+);
+
+-- A limit of -1 means unlimited. Rows can be changed at runtime; the API
+-- picks them up within a minute.
+INSERT INTO plan_limits (plan, metric, period, "limit") VALUES
+    ('free', 'notes_created', 'month', 200),
+    ('free', 'storage_bytes', 'lifetime', 104857600),
+    ('free', 'llm_tokens', 'month', 50000),
+    ('free', 'api_calls', 'day', 5000),
+    ('premium', 'notes_created', 'month', -1),
+    ('premium', 'storage_bytes', 'lifetime', 10737418240),
+    ('premium', 'llm_tokens', 'month', 2000000),
+    ('premium', 'api_calls', 'day', 100000);
+
+CREATE TABLE usage_counters (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    value BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, metric, period_start)
+);
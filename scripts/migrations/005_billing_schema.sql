@@ -0,0 +1,21 @@
+CREATE TABLE billing_customers (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    customer_id VARCHAR(255) NOT NULL UNIQUE,
+    subscription_id VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE billing_events (
+    id VARCHAR(255) PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    type VARCHAR(100) NOT NULL,
+    user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    transition VARCHAR(50) NOT NULL,
+    premium_until_before TIMESTAMP NULL,
+    premium_until_after TIMESTAMP NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_billing_events_user ON billing_events (user_id, received_at);
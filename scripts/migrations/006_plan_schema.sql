@@ -0,0 +1,52 @@
+ALTER TABLE users ADD COLUMN grace_until TIMESTAMP NULL;
+
+ALTER TABLE billing_customers ADD COLUMN plan_code VARCHAR(50) NOT NULL DEFAULT 'premium_monthly';
+
+CREATE TABLE plans (
+    code VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    term VARCHAR(20) NOT NULL,
+    price_id VARCHAR(255) NOT NULL DEFAULT '',
+    trial_days INTEGER NOT NULL DEFAULT 0,
+    grace_days INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO plans (code, name, term, trial_days, grace_days) VALUES
+    ('premium_monthly', 'Premium monthly', 'monthly', 14, 7),
+    ('premium_yearly', 'Premium yearly', 'yearly', 14, 14);
+
+CREATE TABLE promo_codes (
+    code VARCHAR(50) PRIMARY KEY,
+    days INTEGER NOT NULL,
+    max_redemptions INTEGER NOT NULL DEFAULT 0,
+    redemptions INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE promo_redemptions (
+    code VARCHAR(50) NOT NULL REFERENCES promo_codes(code) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (code, user_id)
+);
+
+CREATE TABLE plan_changes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    plan_code VARCHAR(50) NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    premium_until_before TIMESTAMP NULL,
+    premium_until_after TIMESTAMP NULL,
+    grace_until TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_plan_changes_user ON plan_changes (user_id, created_at DESC);
+
+-- A user gets one free trial.
+CREATE UNIQUE INDEX idx_plan_changes_one_trial ON plan_changes (user_id) WHERE kind = 'trial_started';
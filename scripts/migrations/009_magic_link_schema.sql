@@ -0,0 +1,13 @@
+CREATE TABLE magic_links (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    user_agent_hash VARCHAR(64) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Rate limits count the links requested recently per email and per IP.
+CREATE INDEX idx_magic_links_email_created ON magic_links (email, created_at);
+CREATE INDEX idx_magic_links_ip_created ON magic_links (ip, created_at);